@@ -1,73 +1,231 @@
-package config
-
-import (
-	"os"
-	"strconv"
-
-	"github.com/joho/godotenv"
-)
-
-type Config struct {
-	Database DatabaseConfig
-	Bunny    BunnyConfig
-	Auth     AuthConfig
-}
-
-type DatabaseConfig struct {
-	Host string
-	User string
-	Pass string
-	Name string
-	Port string
-}
-
-type BunnyConfig struct {
-	StorageZone          string
-	AccessKey            string
-	Region               string
-	DownloadBaseURL      string
-	StreamLibraryID      uint64
-	StreamAccessKey      string
-	StreamExpirationTime uint64
-}
-
-type AuthConfig struct {
-	JWTSecret string
-}
-
-func ProvideConfig() (*Config, error) {
-	err := godotenv.Load()
-	if err != nil {
-		panic("⚠️ No .env file found!")
-	}
-	streamLibraryID, _ := strconv.ParseUint(getEnv("BUNNY_STREAM_LIBRARY_ID", ""), 10, 32)
-	streamExpirationTime, _ := strconv.ParseUint(getEnv("BUNNY_STREAM_UPLOAD_EXPIRATION_TIME", ""), 10, 32)
-	return &Config{
-		Database: DatabaseConfig{
-			Host: getEnv("DB_HOST", ""),
-			Port: getEnv("DB_PORT", ""),
-			User: getEnv("DB_USER", ""),
-			Pass: getEnv("DB_PASS", ""),
-			Name: getEnv("DB_NAME", ""),
-		},
-		Bunny: BunnyConfig{
-			StorageZone:          getEnv("BUNNY_STORAGE_ZONE", ""),
-			AccessKey:            getEnv("BUNNY_STORAGE_ACCESS_KEY", ""),
-			Region:               getEnv("BUNNY_STORAGE_REGION", ""),
-			DownloadBaseURL:      getEnv("BUNNY_STORAGE_DOWNLOAD_BASE_URL", ""),
-			StreamLibraryID:      streamLibraryID,
-			StreamAccessKey:      getEnv("BUNNY_STREAM_ACCESS_KEY", ""),
-			StreamExpirationTime: streamExpirationTime,
-		},
-		Auth: AuthConfig{
-			JWTSecret: getEnv("JWT_SECRET", ""),
-		},
-	}, nil
-}
-
-func getEnv(key, fallback string) string {
-	if value, ok := os.LookupEnv(key); ok {
-		return value
-	}
-	return fallback
-}
+package config
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/joho/godotenv"
+)
+
+type Config struct {
+	App      AppConfig
+	Database DatabaseConfig
+	Bunny    BunnyConfig
+	Auth     AuthConfig
+	Mail     MailConfig
+	OIDC     OIDCConfig
+	Password PasswordConfig
+}
+
+type AppConfig struct {
+	FrontendURL string
+}
+
+type DatabaseConfig struct {
+	Host string
+	User string
+	Pass string
+	Name string
+	Port string
+}
+
+type BunnyConfig struct {
+	StorageZone          string
+	AccessKey            string
+	Region               string
+	DownloadBaseURL      string
+	StreamLibraryID      uint64
+	StreamAccessKey      string
+	StreamExpirationTime uint64
+}
+
+type AuthConfig struct {
+	JWTSecret                       string
+	JWTIssuer                       string
+	JWTAudience                     string
+	JWTAlgorithm                    string
+	JWTKeyRotationInterval          uint64
+	JWTKeyGracePeriod               uint64
+	AccessTokenExpirationTime       uint64
+	RefreshTokenExpirationTime      uint64
+	TokenPrecedence                 string
+	PasswordResetExpirationTime     uint64
+	EmailVerificationExpirationTime uint64
+	TwoFactorIssuer                 string
+	TwoFactorRequiredRoles          []string
+	SigninMaxAttempts               uint64
+	SigninIPMaxAttempts             uint64
+	SigninLockoutTime               uint64
+	SigninMaxLockoutTime            uint64
+	ImpersonationExpirationTime     uint64
+	MagicLinkExpirationTime         uint64
+	// SignupMode is one of open, invite, domain or closed
+	SignupMode           string
+	SignupAllowedDomains []string
+	// Attributes of the auth and CSRF cookies, CookieSameSite is one of lax, strict or none
+	CookieSecure   bool
+	CookieSameSite string
+	CookieDomain   string
+	// PasskeyRPID defaults to the host of App.FrontendURL and PasskeyOrigins to App.FrontendURL
+	PasskeyRPID    string
+	PasskeyRPName  string
+	PasskeyOrigins []string
+}
+
+type PasswordConfig struct {
+	MinLength           uint64
+	MinCharacterClasses uint64
+	// BreachedHashesDir holds range files named after SHA-1 hash prefixes, in the format of the Have I Been Pwned downloader
+	BreachedHashesDir string
+}
+
+type MailConfig struct {
+	Driver  string
+	Host    string
+	Port    string
+	User    string
+	Pass    string
+	From    string
+	LogPath string
+}
+
+type OIDCConfig struct {
+	// RedirectBaseURL is the public URL of this API, providers redirect back to RedirectBaseURL/auth/oidc/<name>/callback
+	RedirectBaseURL string
+	Providers       []OIDCProviderConfig
+}
+
+type OIDCProviderConfig struct {
+	Name         string
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+}
+
+func ProvideConfig() (*Config, error) {
+	err := godotenv.Load()
+	if err != nil {
+		panic("⚠️ No .env file found!")
+	}
+	streamLibraryID, _ := strconv.ParseUint(getEnv("BUNNY_STREAM_LIBRARY_ID", ""), 10, 32)
+	streamExpirationTime, _ := strconv.ParseUint(getEnv("BUNNY_STREAM_UPLOAD_EXPIRATION_TIME", ""), 10, 32)
+	accessTokenExpirationTime, _ := strconv.ParseUint(getEnv("JWT_ACCESS_TOKEN_EXPIRATION_TIME", "3600"), 10, 32)
+	refreshTokenExpirationTime, _ := strconv.ParseUint(getEnv("JWT_REFRESH_TOKEN_EXPIRATION_TIME", "2592000"), 10, 32)
+	passwordResetExpirationTime, _ := strconv.ParseUint(getEnv("AUTH_PASSWORD_RESET_EXPIRATION_TIME", "3600"), 10, 32)
+	emailVerificationExpirationTime, _ := strconv.ParseUint(getEnv("AUTH_EMAIL_VERIFICATION_EXPIRATION_TIME", "86400"), 10, 32)
+	signinMaxAttempts, _ := strconv.ParseUint(getEnv("AUTH_SIGNIN_MAX_ATTEMPTS", "5"), 10, 32)
+	signinIPMaxAttempts, _ := strconv.ParseUint(getEnv("AUTH_SIGNIN_IP_MAX_ATTEMPTS", "50"), 10, 32)
+	signinLockoutTime, _ := strconv.ParseUint(getEnv("AUTH_SIGNIN_LOCKOUT_TIME", "60"), 10, 32)
+	signinMaxLockoutTime, _ := strconv.ParseUint(getEnv("AUTH_SIGNIN_MAX_LOCKOUT_TIME", "3600"), 10, 32)
+	impersonationExpirationTime, _ := strconv.ParseUint(getEnv("AUTH_IMPERSONATION_EXPIRATION_TIME", "900"), 10, 32)
+	magicLinkExpirationTime, _ := strconv.ParseUint(getEnv("AUTH_MAGIC_LINK_EXPIRATION_TIME", "900"), 10, 32)
+	passwordMinLength, _ := strconv.ParseUint(getEnv("PASSWORD_MIN_LENGTH", "10"), 10, 32)
+	passwordMinCharacterClasses, _ := strconv.ParseUint(getEnv("PASSWORD_MIN_CHARACTER_CLASSES", "3"), 10, 32)
+	jwtKeyRotationInterval, _ := strconv.ParseUint(getEnv("JWT_KEY_ROTATION_INTERVAL", "2592000"), 10, 32)
+	jwtKeyGracePeriod, _ := strconv.ParseUint(getEnv("JWT_KEY_GRACE_PERIOD", "86400"), 10, 32)
+	cookieSecure, _ := strconv.ParseBool(getEnv("AUTH_COOKIE_SECURE", "true"))
+	return &Config{
+		App: AppConfig{
+			FrontendURL: getEnv("APP_FRONTEND_URL", "http://localhost:3000"),
+		},
+		Database: DatabaseConfig{
+			Host: getEnv("DB_HOST", ""),
+			Port: getEnv("DB_PORT", ""),
+			User: getEnv("DB_USER", ""),
+			Pass: getEnv("DB_PASS", ""),
+			Name: getEnv("DB_NAME", ""),
+		},
+		Bunny: BunnyConfig{
+			StorageZone:          getEnv("BUNNY_STORAGE_ZONE", ""),
+			AccessKey:            getEnv("BUNNY_STORAGE_ACCESS_KEY", ""),
+			Region:               getEnv("BUNNY_STORAGE_REGION", ""),
+			DownloadBaseURL:      getEnv("BUNNY_STORAGE_DOWNLOAD_BASE_URL", ""),
+			StreamLibraryID:      streamLibraryID,
+			StreamAccessKey:      getEnv("BUNNY_STREAM_ACCESS_KEY", ""),
+			StreamExpirationTime: streamExpirationTime,
+		},
+		Auth: AuthConfig{
+			JWTSecret:                       getEnv("JWT_SECRET", ""),
+			JWTIssuer:                       getEnv("JWT_ISSUER", "gourze"),
+			JWTAudience:                     getEnv("JWT_AUDIENCE", "gourze-api"),
+			JWTAlgorithm:                    getEnv("JWT_ALGORITHM", "RS256"),
+			JWTKeyRotationInterval:          jwtKeyRotationInterval,
+			JWTKeyGracePeriod:               jwtKeyGracePeriod,
+			AccessTokenExpirationTime:       accessTokenExpirationTime,
+			RefreshTokenExpirationTime:      refreshTokenExpirationTime,
+			TokenPrecedence:                 getEnv("AUTH_TOKEN_PRECEDENCE", "header"),
+			PasswordResetExpirationTime:     passwordResetExpirationTime,
+			EmailVerificationExpirationTime: emailVerificationExpirationTime,
+			TwoFactorIssuer:                 getEnv("AUTH_2FA_ISSUER", "Gourze"),
+			TwoFactorRequiredRoles:          getEnvList("AUTH_2FA_REQUIRED_ROLES", ""),
+			SigninMaxAttempts:               signinMaxAttempts,
+			SigninIPMaxAttempts:             signinIPMaxAttempts,
+			SigninLockoutTime:               signinLockoutTime,
+			SigninMaxLockoutTime:            signinMaxLockoutTime,
+			ImpersonationExpirationTime:     impersonationExpirationTime,
+			MagicLinkExpirationTime:         magicLinkExpirationTime,
+			SignupMode:                      getEnv("AUTH_SIGNUP_MODE", "open"),
+			SignupAllowedDomains:            getEnvList("AUTH_SIGNUP_ALLOWED_DOMAINS", ""),
+			CookieSecure:                    cookieSecure,
+			CookieSameSite:                  getEnv("AUTH_COOKIE_SAMESITE", "lax"),
+			CookieDomain:                    getEnv("AUTH_COOKIE_DOMAIN", ""),
+			PasskeyRPID:                     getEnv("AUTH_PASSKEY_RP_ID", ""),
+			PasskeyRPName:                   getEnv("AUTH_PASSKEY_RP_NAME", "Gourze"),
+			PasskeyOrigins:                  getEnvList("AUTH_PASSKEY_ORIGINS", ""),
+		},
+		Mail: MailConfig{
+			Driver:  getEnv("MAIL_DRIVER", "log"),
+			Host:    getEnv("MAIL_HOST", ""),
+			Port:    getEnv("MAIL_PORT", "587"),
+			User:    getEnv("MAIL_USER", ""),
+			Pass:    getEnv("MAIL_PASS", ""),
+			From:    getEnv("MAIL_FROM", "no-reply@gourze.com"),
+			LogPath: getEnv("MAIL_LOG_PATH", ""),
+		},
+		OIDC: OIDCConfig{
+			RedirectBaseURL: getEnv("OIDC_REDIRECT_BASE_URL", "http://localhost:8080"),
+			Providers:       getOIDCProviders(),
+		},
+		Password: PasswordConfig{
+			MinLength:           passwordMinLength,
+			MinCharacterClasses: passwordMinCharacterClasses,
+			BreachedHashesDir:   getEnv("PASSWORD_BREACHED_HASHES_DIR", ""),
+		},
+	}, nil
+}
+
+// getOIDCProviders reads the providers listed in OIDC_PROVIDERS, each configured through OIDC_<NAME>_* variables
+func getOIDCProviders() []OIDCProviderConfig {
+	var providers []OIDCProviderConfig
+	for _, name := range getEnvList("OIDC_PROVIDERS", "") {
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		providers = append(providers, OIDCProviderConfig{
+			Name:         strings.ToLower(name),
+			IssuerURL:    getEnv(prefix+"ISSUER_URL", ""),
+			ClientID:     getEnv(prefix+"CLIENT_ID", ""),
+			ClientSecret: getEnv(prefix+"CLIENT_SECRET", ""),
+			Scopes:       getEnvList(prefix+"SCOPES", "openid,email,profile"),
+		})
+	}
+	return providers
+}
+
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
+
+// getEnvList reads a comma separated list, ignoring empty items
+func getEnvList(key, fallback string) []string {
+	var list []string
+	for _, item := range strings.Split(getEnv(key, fallback), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
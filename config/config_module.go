@@ -1,10 +1,10 @@
-package config
-
-import (
-	"go.uber.org/fx"
-)
-
-// **Proper Fx Module**
-var Module = fx.Module("config",
-	fx.Provide(ProvideConfig),
-)
+package config
+
+import (
+	"go.uber.org/fx"
+)
+
+// **Proper Fx Module**
+var Module = fx.Module("config",
+	fx.Provide(ProvideConfig),
+)
@@ -1,60 +1,76 @@
-package core
-
-import (
-	"errors"
-	"fmt"
-	"log"
-
-	"github.com/irvanherz/gourze/config"
-	"github.com/irvanherz/gourze/modules/course"
-	"github.com/irvanherz/gourze/modules/media"
-	"github.com/irvanherz/gourze/modules/order"
-	"github.com/irvanherz/gourze/modules/user"
-	"golang.org/x/crypto/bcrypt"
-	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
-)
-
-func ProvideDatabase(config *config.Config) (*gorm.DB, error) {
-	dsn := fmt.Sprintf(
-		"host=%s user=%s password=%s dbname=%s port=%s sslmode=disable TimeZone=Asia/Jakarta",
-		config.Database.Host,
-		config.Database.User,
-		config.Database.Pass,
-		config.Database.Name,
-		config.Database.Port,
-	)
-
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info),
-	})
-	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
-	}
-
-	fmt.Println("✅ Database connected successfully!")
-
-	// **AutoMigrate all models**
-	err = db.AutoMigrate(&user.User{}, &course.Category{}, &course.Course{}, &course.Chapter{}, &course.CourseUser{}, &media.Media{}, &order.Order{}, &order.OrderItem{})
-	if err != nil {
-		return nil, fmt.Errorf("failed to migrate database: %w", err)
-	}
-	if db.Migrator().HasTable(&user.User{}) {
-		if err := db.Where("username = ?", "root").First(&user.User{}).Error; errors.Is(err, gorm.ErrRecordNotFound) {
-			hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("root"), bcrypt.DefaultCost)
-			rootUser := user.User{
-				ID:       1,
-				Username: "root",
-				Email:    "root@gourze.com",
-				FullName: "Root",
-				Password: string(hashedPassword),
-				Role:     user.Super,
-			}
-			db.Save(&rootUser)
-		}
-	}
-
-	fmt.Println("✅ Database migration completed!")
-	return db, nil
-}
+package core
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/irvanherz/gourze/config"
+	"github.com/irvanherz/gourze/modules/apikey"
+	"github.com/irvanherz/gourze/modules/auth"
+	"github.com/irvanherz/gourze/modules/course"
+	"github.com/irvanherz/gourze/modules/follow"
+	"github.com/irvanherz/gourze/modules/instructor"
+	"github.com/irvanherz/gourze/modules/invite"
+	"github.com/irvanherz/gourze/modules/media"
+	"github.com/irvanherz/gourze/modules/oidc"
+	"github.com/irvanherz/gourze/modules/order"
+	"github.com/irvanherz/gourze/modules/rbac"
+	"github.com/irvanherz/gourze/modules/user"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func ProvideDatabase(config *config.Config) (*gorm.DB, error) {
+	dsn := fmt.Sprintf(
+		"host=%s user=%s password=%s dbname=%s port=%s sslmode=disable TimeZone=Asia/Jakarta",
+		config.Database.Host,
+		config.Database.User,
+		config.Database.Pass,
+		config.Database.Name,
+		config.Database.Port,
+	)
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Info),
+	})
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+
+	fmt.Println("✅ Database connected successfully!")
+
+	// **AutoMigrate all models**
+	err = db.AutoMigrate(&user.User{}, &course.Category{}, &course.Course{}, &course.Chapter{}, &course.CourseUser{}, &course.CourseCoOwner{}, &media.Media{}, &order.Order{}, &order.OrderItem{}, &auth.RefreshToken{}, &auth.RevokedToken{}, &auth.UserTokenRevocation{}, &auth.OneTimeToken{}, &auth.TwoFactorCredential{}, &auth.RecoveryCode{}, &auth.SigninThrottle{}, &auth.SigningKey{}, &auth.AuditLog{}, &auth.Session{}, &auth.PasskeyCredential{}, &auth.PasskeyChallenge{}, &oidc.ExternalIdentity{}, &oidc.LoginState{}, &apikey.ApiKey{}, &invite.Invite{}, &instructor.Application{}, &follow.Follow{}, &rbac.Permission{}, &rbac.Role{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+	if db.Migrator().HasTable(&user.User{}) {
+		if err := db.Where("username = ?", "root").First(&user.User{}).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+			hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("root"), bcrypt.DefaultCost)
+			emailVerifiedAt := time.Now()
+			rootUser := user.User{
+				ID:              1,
+				Username:        "root",
+				Email:           "root@gourze.com",
+				FullName:        "Root",
+				Password:        string(hashedPassword),
+				Role:            user.Super,
+				EmailVerifiedAt: &emailVerifiedAt,
+				// The default password is public, it must be replaced on first signin
+				PasswordChangeRequired: true,
+			}
+			db.Save(&rootUser)
+		}
+	}
+
+	if err := rbac.SeedRoles(db); err != nil {
+		return nil, fmt.Errorf("failed to seed roles: %w", err)
+	}
+
+	fmt.Println("✅ Database migration completed!")
+	return db, nil
+}
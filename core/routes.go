@@ -1,68 +1,178 @@
-package core
-
-import (
-	"github.com/gin-gonic/gin"
-	"github.com/irvanherz/gourze/modules/auth"
-	"github.com/irvanherz/gourze/modules/course"
-	"github.com/irvanherz/gourze/modules/media"
-	"github.com/irvanherz/gourze/modules/order"
-	"github.com/irvanherz/gourze/modules/user"
-	"go.uber.org/fx"
-)
-
-type RouterParams struct {
-	fx.In
-	AuthController     auth.AuthController
-	AuthMiddleware     auth.AuthMiddleware
-	UserController     user.UserController
-	MediaController    media.MediaController
-	CourseController   course.CourseController
-	OrderController    order.OrderController
-	CategoryController course.CategoryController
-}
-
-func ProvideRouter(params RouterParams) *gin.Engine {
-	r := gin.Default()
-	r.Use(params.AuthMiddleware.Authenticate())
-
-	authRoutes := r.Group("/auth")
-	{
-		authRoutes.POST("/signin", params.AuthController.Signin)
-		authRoutes.POST("/signup", params.AuthController.Signup)
-	}
-
-	userRoutes := r.Group("/users")
-	{
-		userRoutes.GET("/", params.AuthMiddleware.Authorize(false, user.Admin), params.UserController.FindManyUsers)
-		userRoutes.POST("/", params.AuthMiddleware.Authorize(false, user.Admin), params.UserController.CreateUser)
-	}
-
-	mediaRoutes := r.Group("/media")
-	{
-		mediaRoutes.GET("/", params.AuthMiddleware.Authorize(false), params.MediaController.FindManyMedia)
-		mediaRoutes.POST("/upload-photo", params.AuthMiddleware.Authorize(true), params.MediaController.UploadPhoto)
-		mediaRoutes.POST("/upload-video-via-tus", params.AuthMiddleware.Authorize(true), params.MediaController.UploadVideoViaTus)
-	}
-
-	courseRoutes := r.Group("/courses")
-	{
-		categoryRoutes := courseRoutes.Group("/categories")
-		{
-			categoryRoutes.GET("/", params.CategoryController.FindManyCategories)
-			categoryRoutes.POST("/", params.AuthMiddleware.Authorize(true, user.Super, user.Admin), params.CategoryController.CreateCategory)
-		}
-		courseRoutes.GET("/", params.CourseController.FindManyCourses)
-		courseRoutes.POST("/", params.CourseController.CreateCourse)
-	}
-
-	orderRoutes := r.Group("/orders")
-	{
-		orderRoutes.GET("/", params.OrderController.FindManyOrders)
-		orderRoutes.POST("/", params.OrderController.CreateOrder)
-		orderRoutes.GET("/:id", params.OrderController.FindOrderByID)
-		orderRoutes.PUT("/:id", params.OrderController.UpdateOrderByID)
-		orderRoutes.DELETE("/:id", params.OrderController.DeleteOrderByID)
-	}
-
-	return r
-}
+package core
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/irvanherz/gourze/modules/apikey"
+	"github.com/irvanherz/gourze/modules/auth"
+	"github.com/irvanherz/gourze/modules/course"
+	"github.com/irvanherz/gourze/modules/follow"
+	"github.com/irvanherz/gourze/modules/instructor"
+	"github.com/irvanherz/gourze/modules/invite"
+	"github.com/irvanherz/gourze/modules/media"
+	"github.com/irvanherz/gourze/modules/oidc"
+	"github.com/irvanherz/gourze/modules/order"
+	"github.com/irvanherz/gourze/modules/profile"
+	"github.com/irvanherz/gourze/modules/rbac"
+	"github.com/irvanherz/gourze/modules/user"
+	"go.uber.org/fx"
+)
+
+type RouterParams struct {
+	fx.In
+	AuthController       auth.AuthController
+	AuthMiddleware       auth.AuthMiddleware
+	UserController       user.UserController
+	MediaController      media.MediaController
+	CourseController     course.CourseController
+	OrderController      order.OrderController
+	CategoryController   course.CategoryController
+	OidcController       oidc.OidcController
+	ApiKeyController     apikey.ApiKeyController
+	RbacController       rbac.RbacController
+	SessionController    auth.SessionController
+	InviteController     invite.InviteController
+	ProfileController    profile.ProfileController
+	InstructorController instructor.InstructorController
+	FollowController     follow.FollowController
+}
+
+func ProvideRouter(params RouterParams) *gin.Engine {
+	r := gin.Default()
+	r.Use(params.AuthMiddleware.VerifyCSRFToken())
+	r.Use(params.AuthMiddleware.Authenticate())
+
+	r.GET("/.well-known/jwks.json", params.AuthController.JWKS)
+
+	authRoutes := r.Group("/auth")
+	{
+		authRoutes.GET("/csrf-token", params.AuthController.CSRFToken)
+		authRoutes.POST("/signin", params.AuthController.Signin)
+		authRoutes.POST("/signup", params.AuthController.Signup)
+		authRoutes.POST("/refresh", params.AuthController.Refresh)
+		authRoutes.POST("/signout", params.AuthController.Signout)
+		authRoutes.POST("/forgot-password", params.AuthController.ForgotPassword)
+		authRoutes.POST("/reset-password", params.AuthController.ResetPassword)
+		authRoutes.POST("/verify-email", params.AuthController.VerifyEmail)
+		authRoutes.POST("/magic-link", params.AuthController.RequestMagicLink)
+		authRoutes.GET("/magic-link/consume", params.AuthController.ConsumeMagicLink)
+		authRoutes.POST("/resend-verification", params.AuthMiddleware.Authorize(true), params.AuthController.ResendEmailVerification)
+		authRoutes.POST("/signout-all", params.AuthMiddleware.Authorize(true), params.AuthMiddleware.DenyImpersonation(), params.AuthController.SignoutAll)
+		authRoutes.POST("/2fa/enroll", params.AuthMiddleware.Authorize(false), params.AuthMiddleware.DenyImpersonation(), params.AuthController.TwoFactorEnroll)
+		authRoutes.POST("/2fa/activate", params.AuthMiddleware.Authorize(false), params.AuthMiddleware.DenyImpersonation(), params.AuthController.TwoFactorActivate)
+		authRoutes.POST("/2fa/verify", params.AuthController.TwoFactorVerify)
+		authRoutes.POST("/passkeys/signin/begin", params.AuthController.PasskeySigninBegin)
+		authRoutes.POST("/passkeys/signin/finish", params.AuthController.PasskeySigninFinish)
+		authRoutes.POST("/change-password", params.AuthMiddleware.Authorize(false), params.AuthMiddleware.DenyImpersonation(), params.AuthController.ChangePassword)
+		authRoutes.POST("/2fa/disable", params.AuthMiddleware.Authorize(true), params.AuthMiddleware.DenyImpersonation(), params.AuthController.TwoFactorDisable)
+		authRoutes.POST("/users/:id/signout", params.AuthMiddleware.Authorize(true), params.AuthMiddleware.DenyImpersonation(), params.AuthMiddleware.RequirePermission(rbac.UserManage), params.AuthController.SignoutUser)
+		authRoutes.GET("/oidc/:provider/login", params.OidcController.Login)
+		authRoutes.GET("/oidc/:provider/callback", params.OidcController.Callback)
+		authRoutes.POST("/impersonate/:userId", params.AuthMiddleware.Authorize(true), params.AuthMiddleware.DenyImpersonation(), params.AuthController.Impersonate)
+		authRoutes.POST("/users/:id/unlock", params.AuthMiddleware.Authorize(true), params.AuthMiddleware.DenyImpersonation(), params.AuthMiddleware.RequirePermission(rbac.UserManage), params.AuthController.UnlockUser)
+	}
+
+	meRoutes := r.Group("/me")
+	{
+		meRoutes.GET("", params.AuthMiddleware.Authorize(true), params.ProfileController.FindProfile)
+		meRoutes.PATCH("", params.AuthMiddleware.Authorize(true), params.AuthMiddleware.DenyImpersonation(), params.ProfileController.UpdateProfile)
+		meRoutes.POST("/password", params.AuthMiddleware.Authorize(true), params.AuthMiddleware.DenyImpersonation(), params.ProfileController.ChangePassword)
+		meRoutes.POST("/email", params.AuthMiddleware.Authorize(true), params.AuthMiddleware.DenyImpersonation(), params.ProfileController.ChangeEmail)
+		meRoutes.DELETE("", params.AuthMiddleware.Authorize(true), params.AuthMiddleware.DenyImpersonation(), params.ProfileController.DeleteAccount)
+		meRoutes.GET("/export", params.AuthMiddleware.Authorize(true), params.AuthMiddleware.DenyImpersonation(), params.ProfileController.ExportData)
+		meRoutes.GET("/following", params.AuthMiddleware.Authorize(true), params.FollowController.FindManyFollowing)
+		meRoutes.GET("/sessions", params.AuthMiddleware.Authorize(true), params.SessionController.FindManySessions)
+		meRoutes.DELETE("/sessions/:id", params.AuthMiddleware.Authorize(true), params.AuthMiddleware.DenyImpersonation(), params.SessionController.RevokeSession)
+		meRoutes.GET("/passkeys", params.AuthMiddleware.Authorize(true), params.AuthController.FindManyPasskeys)
+		meRoutes.POST("/passkeys/register/begin", params.AuthMiddleware.Authorize(true), params.AuthMiddleware.DenyImpersonation(), params.AuthController.PasskeyRegisterBegin)
+		meRoutes.POST("/passkeys/register/finish", params.AuthMiddleware.Authorize(true), params.AuthMiddleware.DenyImpersonation(), params.AuthController.PasskeyRegisterFinish)
+		meRoutes.DELETE("/passkeys/:id", params.AuthMiddleware.Authorize(true), params.AuthMiddleware.DenyImpersonation(), params.AuthController.DeletePasskey)
+	}
+
+	profileRoutes := r.Group("/profiles")
+	{
+		profileRoutes.GET("/:id", params.ProfileController.FindPublicProfile)
+		profileRoutes.POST("/:id/follow", params.AuthMiddleware.Authorize(true), params.AuthMiddleware.DenyImpersonation(), params.FollowController.Follow)
+		profileRoutes.DELETE("/:id/follow", params.AuthMiddleware.Authorize(true), params.AuthMiddleware.DenyImpersonation(), params.FollowController.Unfollow)
+	}
+
+	apiKeyRoutes := r.Group("/api-keys")
+	{
+		apiKeyRoutes.GET("/", params.AuthMiddleware.Authorize(true), params.ApiKeyController.FindManyApiKeys)
+		apiKeyRoutes.POST("/", params.AuthMiddleware.Authorize(true), params.AuthMiddleware.DenyImpersonation(), params.ApiKeyController.CreateApiKey)
+		apiKeyRoutes.DELETE("/:id", params.AuthMiddleware.Authorize(true), params.AuthMiddleware.DenyImpersonation(), params.ApiKeyController.RevokeApiKey)
+	}
+
+	rbacRoutes := r.Group("/rbac")
+	{
+		rbacRoutes.GET("/roles", params.AuthMiddleware.Authorize(true), params.AuthMiddleware.RequirePermission(rbac.RbacManage), params.RbacController.FindManyRoles)
+		rbacRoutes.GET("/permissions", params.AuthMiddleware.Authorize(true), params.AuthMiddleware.RequirePermission(rbac.RbacManage), params.RbacController.FindManyPermissions)
+		rbacRoutes.POST("/roles", params.AuthMiddleware.Authorize(true), params.AuthMiddleware.DenyImpersonation(), params.AuthMiddleware.RequirePermission(rbac.RbacManage), params.RbacController.CreateRole)
+		rbacRoutes.DELETE("/roles/:name", params.AuthMiddleware.Authorize(true), params.AuthMiddleware.DenyImpersonation(), params.AuthMiddleware.RequirePermission(rbac.RbacManage), params.RbacController.DeleteRole)
+		rbacRoutes.PUT("/roles/:name/permissions", params.AuthMiddleware.Authorize(true), params.AuthMiddleware.DenyImpersonation(), params.AuthMiddleware.RequirePermission(rbac.RbacManage), params.RbacController.UpdateRolePermissions)
+	}
+
+	inviteRoutes := r.Group("/invites")
+	{
+		inviteRoutes.GET("/", params.AuthMiddleware.Authorize(true), params.AuthMiddleware.RequirePermission(rbac.UserManage), params.InviteController.FindManyInvites)
+		inviteRoutes.POST("/", params.AuthMiddleware.Authorize(true), params.AuthMiddleware.DenyImpersonation(), params.AuthMiddleware.RequirePermission(rbac.UserManage), params.InviteController.CreateInvite)
+		inviteRoutes.DELETE("/:id", params.AuthMiddleware.Authorize(true), params.AuthMiddleware.DenyImpersonation(), params.AuthMiddleware.RequirePermission(rbac.UserManage), params.InviteController.RevokeInvite)
+	}
+
+	userRoutes := r.Group("/users")
+	{
+		userRoutes.GET("/", params.AuthMiddleware.Authorize(true), params.AuthMiddleware.RequirePermission(rbac.UserRead), params.UserController.FindManyUsers)
+		userRoutes.POST("/", params.AuthMiddleware.Authorize(true), params.AuthMiddleware.DenyImpersonation(), params.AuthMiddleware.RequirePermission(rbac.UserManage), params.UserController.CreateUser)
+		userRoutes.GET("/:id", params.AuthMiddleware.Authorize(true), params.AuthMiddleware.RequirePermission(rbac.UserRead), params.UserController.FindUserByID)
+		userRoutes.PUT("/:id", params.AuthMiddleware.Authorize(true), params.AuthMiddleware.DenyImpersonation(), params.AuthMiddleware.RequirePermission(rbac.UserManage), params.UserController.UpdateUserByID)
+		userRoutes.DELETE("/:id", params.AuthMiddleware.Authorize(true), params.AuthMiddleware.DenyImpersonation(), params.AuthMiddleware.RequirePermission(rbac.UserManage), params.UserController.DeleteUserByID)
+		userRoutes.POST("/:id/suspend", params.AuthMiddleware.Authorize(true), params.AuthMiddleware.DenyImpersonation(), params.AuthMiddleware.RequirePermission(rbac.UserManage), params.UserController.SuspendUser)
+		userRoutes.DELETE("/:id/suspend", params.AuthMiddleware.Authorize(true), params.AuthMiddleware.DenyImpersonation(), params.AuthMiddleware.RequirePermission(rbac.UserManage), params.UserController.UnsuspendUser)
+	}
+
+	mediaRoutes := r.Group("/media")
+	{
+		mediaRoutes.GET("/", params.AuthMiddleware.Authorize(true), params.MediaController.FindManyMedia)
+		mediaRoutes.POST("/upload-photo", params.AuthMiddleware.Authorize(true), params.MediaController.UploadPhoto)
+		mediaRoutes.POST("/upload-video-via-tus", params.AuthMiddleware.Authorize(true), params.MediaController.UploadVideoViaTus)
+		mediaRoutes.GET("/:id", params.AuthMiddleware.Authorize(true), params.MediaController.FindMediaByID)
+		mediaRoutes.PUT("/:id", params.AuthMiddleware.Authorize(true), params.MediaController.UpdateMediaByID)
+		mediaRoutes.DELETE("/:id", params.AuthMiddleware.Authorize(true), params.MediaController.DeleteMediaByID)
+	}
+
+	instructorRoutes := r.Group("/instructor-applications")
+	{
+		instructorRoutes.GET("/", params.AuthMiddleware.Authorize(true), params.InstructorController.FindManyApplications)
+		instructorRoutes.POST("/", params.AuthMiddleware.Authorize(true), params.AuthMiddleware.DenyImpersonation(), params.AuthMiddleware.RequireVerifiedEmail(), params.InstructorController.SubmitApplication)
+		instructorRoutes.GET("/:id", params.AuthMiddleware.Authorize(true), params.InstructorController.FindApplicationByID)
+		instructorRoutes.POST("/:id/approve", params.AuthMiddleware.Authorize(true), params.AuthMiddleware.DenyImpersonation(), params.AuthMiddleware.RequirePermission(rbac.InstructorReview), params.InstructorController.ApproveApplication)
+		instructorRoutes.POST("/:id/reject", params.AuthMiddleware.Authorize(true), params.AuthMiddleware.DenyImpersonation(), params.AuthMiddleware.RequirePermission(rbac.InstructorReview), params.InstructorController.RejectApplication)
+	}
+
+	courseRoutes := r.Group("/courses")
+	{
+		categoryRoutes := courseRoutes.Group("/categories")
+		{
+			categoryRoutes.GET("/", params.CategoryController.FindManyCategories)
+			categoryRoutes.POST("/", params.AuthMiddleware.Authorize(true), params.AuthMiddleware.RequirePermission(rbac.CategoryManage), params.CategoryController.CreateCategory)
+		}
+		courseRoutes.GET("/", params.CourseController.FindManyCourses)
+		courseRoutes.POST("/", params.AuthMiddleware.Authorize(true), params.AuthMiddleware.RequireVerifiedEmail(), params.AuthMiddleware.RequirePermission(rbac.CourseCreate), params.CourseController.CreateCourse)
+		courseRoutes.GET("/:id", params.CourseController.FindCourseByID)
+		courseRoutes.PUT("/:id", params.AuthMiddleware.Authorize(true), params.CourseController.UpdateCourseByID)
+		courseRoutes.DELETE("/:id", params.AuthMiddleware.Authorize(true), params.CourseController.DeleteCourseByID)
+		courseRoutes.POST("/:id/publish", params.AuthMiddleware.Authorize(true), params.AuthMiddleware.DenyImpersonation(), params.CourseController.PublishCourse)
+		courseRoutes.POST("/:id/co-owners", params.AuthMiddleware.Authorize(true), params.CourseController.AddCoOwner)
+		courseRoutes.DELETE("/:id/co-owners/:userId", params.AuthMiddleware.Authorize(true), params.CourseController.RemoveCoOwner)
+	}
+
+	orderRoutes := r.Group("/orders")
+	{
+		orderRoutes.GET("/", params.AuthMiddleware.Authorize(true), params.OrderController.FindManyOrders)
+		orderRoutes.POST("/", params.AuthMiddleware.Authorize(true), params.AuthMiddleware.DenyImpersonation(), params.AuthMiddleware.RequireVerifiedEmail(), params.OrderController.CreateOrder)
+		orderRoutes.GET("/:id", params.AuthMiddleware.Authorize(true), params.OrderController.FindOrderByID)
+		orderRoutes.PUT("/:id", params.AuthMiddleware.Authorize(true), params.AuthMiddleware.DenyImpersonation(), params.OrderController.UpdateOrderByID)
+		orderRoutes.DELETE("/:id", params.AuthMiddleware.Authorize(true), params.AuthMiddleware.DenyImpersonation(), params.OrderController.DeleteOrderByID)
+	}
+
+	return r
+}
@@ -1,30 +1,48 @@
-package main
-
-import (
-	"github.com/gin-gonic/gin"
-	"github.com/irvanherz/gourze/config"
-	"github.com/irvanherz/gourze/core"
-	"github.com/irvanherz/gourze/modules/auth"
-	"github.com/irvanherz/gourze/modules/course"
-	"github.com/irvanherz/gourze/modules/media"
-	"github.com/irvanherz/gourze/modules/order"
-	"github.com/irvanherz/gourze/modules/user"
-	"go.uber.org/fx"
-)
-
-func main() {
-	app := fx.New(
-		config.Module, // Provide config and routing
-		core.Module,   // Provide core module dependencies
-		user.Module,   // Provide user module dependencies
-		auth.Module,   // Provide auth module dependencies
-		media.Module,  // Provide media module dependencies
-		course.Module, // Provide course module dependencies
-		order.Module,  // Provide order module dependencies
-		fx.Invoke(func(router *gin.Engine) {
-			router.Run(":8080") // Start Gin server
-		}),
-	)
-
-	app.Run()
-}
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/irvanherz/gourze/config"
+	"github.com/irvanherz/gourze/core"
+	"github.com/irvanherz/gourze/modules/apikey"
+	"github.com/irvanherz/gourze/modules/auth"
+	"github.com/irvanherz/gourze/modules/course"
+	"github.com/irvanherz/gourze/modules/follow"
+	"github.com/irvanherz/gourze/modules/instructor"
+	"github.com/irvanherz/gourze/modules/invite"
+	"github.com/irvanherz/gourze/modules/mail"
+	"github.com/irvanherz/gourze/modules/media"
+	"github.com/irvanherz/gourze/modules/oidc"
+	"github.com/irvanherz/gourze/modules/order"
+	"github.com/irvanherz/gourze/modules/password"
+	"github.com/irvanherz/gourze/modules/profile"
+	"github.com/irvanherz/gourze/modules/rbac"
+	"github.com/irvanherz/gourze/modules/user"
+	"go.uber.org/fx"
+)
+
+func main() {
+	app := fx.New(
+		config.Module,     // Provide config and routing
+		core.Module,       // Provide core module dependencies
+		mail.Module,       // Provide mail module dependencies
+		password.Module,   // Provide password module dependencies
+		user.Module,       // Provide user module dependencies
+		rbac.Module,       // Provide rbac module dependencies
+		auth.Module,       // Provide auth module dependencies
+		oidc.Module,       // Provide oidc module dependencies
+		apikey.Module,     // Provide apikey module dependencies
+		invite.Module,     // Provide invite module dependencies
+		media.Module,      // Provide media module dependencies
+		follow.Module,     // Provide follow module dependencies
+		course.Module,     // Provide course module dependencies
+		order.Module,      // Provide order module dependencies
+		profile.Module,    // Provide profile module dependencies
+		instructor.Module, // Provide instructor module dependencies
+		fx.Invoke(func(router *gin.Engine) {
+			router.Run(":8080") // Start Gin server
+		}),
+	)
+
+	app.Run()
+}
@@ -0,0 +1,87 @@
+package apikey
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/irvanherz/gourze/modules/apikey/dto"
+	"github.com/irvanherz/gourze/utils"
+	"gorm.io/gorm"
+)
+
+type ApiKeyController interface {
+	FindManyApiKeys(*gin.Context)
+	CreateApiKey(*gin.Context)
+	RevokeApiKey(*gin.Context)
+}
+
+type apiKeyController struct {
+	Service ApiKeyService
+}
+
+func NewApiKeyController(service ApiKeyService) ApiKeyController {
+	return &apiKeyController{service}
+}
+
+func (ac *apiKeyController) FindManyApiKeys(c *gin.Context) {
+	currentUser, err := utils.GetCurrentUser(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"code": "unauthorized", "message": "Unauthorized"})
+		return
+	}
+	apiKeys, err := ac.Service.FindManyApiKeys(currentUser.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Success", "data": apiKeys})
+}
+
+func (ac *apiKeyController) CreateApiKey(c *gin.Context) {
+	currentUser, err := utils.GetCurrentUser(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"code": "unauthorized", "message": "Unauthorized"})
+		return
+	}
+	var input dto.ApiKeyCreateInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
+		return
+	}
+	result, err := ac.Service.CreateApiKey(currentUser.ID, &input)
+	if err != nil {
+		if errors.Is(err, ErrInvalidScope) || errors.Is(err, ErrApiKeyExpired) {
+			c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"code": "ok", "message": "API key created, store it now as it won't be shown again", "data": result})
+}
+
+func (ac *apiKeyController) RevokeApiKey(c *gin.Context) {
+	currentUser, err := utils.GetCurrentUser(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"code": "unauthorized", "message": "Unauthorized"})
+		return
+	}
+	id := c.Param("id")
+	uid, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": "Invalid API key ID"})
+		return
+	}
+	apiKey, err := ac.Service.RevokeApiKey(currentUser.ID, uint(uid))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"code": "not-found", "message": "API key not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "API key revoked", "data": apiKey})
+}
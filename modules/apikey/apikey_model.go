@@ -0,0 +1,23 @@
+package apikey
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// ApiKey is a long-lived credential owned by a user. Only the hash of the secret is stored,
+// the prefix identifies the key and is safe to show.
+type ApiKey struct {
+	ID         uint                        `gorm:"primarykey" json:"id"`
+	UserID     uint                        `gorm:"index" json:"userId"`
+	Name       string                      `gorm:"type:varchar(255)" json:"name"`
+	Prefix     string                      `gorm:"unique;type:varchar(16)" json:"prefix"`
+	SecretHash string                      `gorm:"type:varchar(64)" json:"-"`
+	Scopes     datatypes.JSONSlice[string] `gorm:"type:jsonb;not null" json:"scopes"`
+	LastUsedAt *time.Time                  `gorm:"type:timestamp" json:"lastUsedAt"`
+	ExpiresAt  *time.Time                  `gorm:"type:timestamp" json:"expiresAt"`
+	RevokedAt  *time.Time                  `gorm:"type:timestamp" json:"revokedAt"`
+	CreatedAt  time.Time                   `gorm:"type:timestamp" json:"createdAt"`
+	UpdatedAt  time.Time                   `gorm:"type:timestamp" json:"updatedAt"`
+}
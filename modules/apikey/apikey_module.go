@@ -0,0 +1,9 @@
+package apikey
+
+import "go.uber.org/fx"
+
+// Module exports dependencies for the apikey module
+var Module = fx.Module("apikey",
+	fx.Provide(NewApiKeyService),
+	fx.Provide(NewApiKeyController),
+)
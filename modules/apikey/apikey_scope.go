@@ -0,0 +1,51 @@
+package apikey
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// scopeResources maps the first segment of a route to the resource name used in scopes.
+// Routes outside of this list, like /auth or /api-keys, can't be called with an API key.
+var scopeResources = map[string]string{
+	"courses": "course",
+	"orders":  "order",
+	"media":   "media",
+	"users":   "user",
+}
+
+// Scopes lists every scope a key can be granted
+func Scopes() []string {
+	var scopes []string
+	for _, resource := range scopeResources {
+		scopes = append(scopes, resource+":read", resource+":write")
+	}
+	slices.Sort(scopes)
+	return scopes
+}
+
+// RequiredScope returns the scope needed to call a route, e.g. "course:read" for GET /courses/.
+// It returns false when the route is off limits for API keys.
+func RequiredScope(method, route string) (string, bool) {
+	segment, _, _ := strings.Cut(strings.TrimPrefix(route, "/"), "/")
+	resource, ok := scopeResources[segment]
+	if !ok {
+		return "", false
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return resource + ":read", true
+	default:
+		return resource + ":write", true
+	}
+}
+
+// HasScope reports whether the granted scopes cover the required one. Write access implies read access.
+func HasScope(granted []string, required string) bool {
+	if slices.Contains(granted, required) {
+		return true
+	}
+	resource, action, _ := strings.Cut(required, ":")
+	return action == "read" && slices.Contains(granted, resource+":write")
+}
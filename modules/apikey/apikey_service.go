@@ -0,0 +1,170 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/irvanherz/gourze/modules/apikey/dto"
+	"github.com/irvanherz/gourze/modules/user"
+	"gorm.io/gorm"
+)
+
+const (
+	keyPrefix = "gz"
+	// lastUsedResolution limits how often LastUsedAt is written for busy keys
+	lastUsedResolution = time.Minute
+)
+
+var (
+	ErrInvalidApiKey = errors.New("invalid, expired or revoked API key")
+	ErrInvalidScope  = errors.New("invalid API key scope")
+	ErrApiKeyExpired = errors.New("API key expiry must be in the future")
+)
+
+type ApiKeyService interface {
+	CreateApiKey(userID uint, input *dto.ApiKeyCreateInput) (*dto.ApiKeyCreateResult, error)
+	FindManyApiKeys(userID uint) ([]ApiKey, error)
+	RevokeApiKey(userID uint, id uint) (*ApiKey, error)
+	// Authenticate resolves a raw key into the key and its owner
+	Authenticate(rawKey string) (*ApiKey, *user.User, error)
+}
+
+type apiKeyService struct {
+	Db *gorm.DB
+}
+
+func NewApiKeyService(db *gorm.DB) ApiKeyService {
+	return &apiKeyService{Db: db}
+}
+
+// CreateApiKey implements ApiKeyService. Keys look like gz_<prefix>_<secret>.
+func (s *apiKeyService) CreateApiKey(userID uint, input *dto.ApiKeyCreateInput) (*dto.ApiKeyCreateResult, error) {
+	validScopes := Scopes()
+	for _, scope := range input.Scopes {
+		if !slices.Contains(validScopes, scope) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidScope, scope)
+		}
+	}
+	if input.ExpiresAt != nil && input.ExpiresAt.Before(time.Now()) {
+		return nil, ErrApiKeyExpired
+	}
+
+	prefix, err := randomHex(6)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := randomSecret(32)
+	if err != nil {
+		return nil, err
+	}
+	apiKey := ApiKey{
+		UserID:     userID,
+		Name:       input.Name,
+		Prefix:     prefix,
+		SecretHash: hashSecret(secret),
+		Scopes:     input.Scopes,
+		ExpiresAt:  input.ExpiresAt,
+	}
+	if err := s.Db.Create(&apiKey).Error; err != nil {
+		return nil, err
+	}
+	return &dto.ApiKeyCreateResult{
+		ID:        apiKey.ID,
+		Name:      apiKey.Name,
+		Key:       fmt.Sprintf("%s_%s_%s", keyPrefix, prefix, secret),
+		Prefix:    prefix,
+		Scopes:    apiKey.Scopes,
+		ExpiresAt: apiKey.ExpiresAt,
+	}, nil
+}
+
+func (s *apiKeyService) FindManyApiKeys(userID uint) ([]ApiKey, error) {
+	var apiKeys []ApiKey
+	if err := s.Db.Where("user_id = ?", userID).Order("id desc").Find(&apiKeys).Error; err != nil {
+		return nil, err
+	}
+	return apiKeys, nil
+}
+
+func (s *apiKeyService) RevokeApiKey(userID uint, id uint) (*ApiKey, error) {
+	var apiKey ApiKey
+	if err := s.Db.Where("id = ? AND user_id = ?", id, userID).First(&apiKey).Error; err != nil {
+		return nil, err
+	}
+	if apiKey.RevokedAt == nil {
+		now := time.Now()
+		apiKey.RevokedAt = &now
+		if err := s.Db.Model(&apiKey).Update("revoked_at", now).Error; err != nil {
+			return nil, err
+		}
+	}
+	return &apiKey, nil
+}
+
+// Authenticate implements ApiKeyService.
+func (s *apiKeyService) Authenticate(rawKey string) (*ApiKey, *user.User, error) {
+	parts := strings.SplitN(rawKey, "_", 3)
+	if len(parts) != 3 || parts[0] != keyPrefix {
+		return nil, nil, ErrInvalidApiKey
+	}
+	var apiKey ApiKey
+	if err := s.Db.Where("prefix = ?", parts[1]).First(&apiKey).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidApiKey
+		}
+		return nil, nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(apiKey.SecretHash), []byte(hashSecret(parts[2]))) != 1 {
+		return nil, nil, ErrInvalidApiKey
+	}
+	now := time.Now()
+	if apiKey.RevokedAt != nil || (apiKey.ExpiresAt != nil && now.After(*apiKey.ExpiresAt)) {
+		return nil, nil, ErrInvalidApiKey
+	}
+
+	var owner user.User
+	if err := s.Db.First(&owner, apiKey.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidApiKey
+		}
+		return nil, nil, err
+	}
+
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) > lastUsedResolution {
+		apiKey.LastUsedAt = &now
+		if err := s.Db.Model(&apiKey).UpdateColumn("last_used_at", now).Error; err != nil {
+			return nil, nil, err
+		}
+	}
+	return &apiKey, &owner, nil
+}
+
+func randomHex(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// randomSecret returns a URL-safe secret without underscores, which separate the parts of a key
+func randomSecret(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return strings.ReplaceAll(base64.RawURLEncoding.EncodeToString(b), "_", "-"), nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
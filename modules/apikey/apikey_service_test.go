@@ -0,0 +1,102 @@
+package apikey
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/irvanherz/gourze/modules/apikey/dto"
+	"github.com/irvanherz/gourze/modules/user"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type ApiKeyServiceTestSuite struct {
+	suite.Suite
+	db      *gorm.DB
+	service ApiKeyService
+}
+
+func (suite *ApiKeyServiceTestSuite) SetupTest() {
+	suite.db, _ = gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	suite.db.AutoMigrate(&user.User{}, &ApiKey{})
+	suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com"})
+	suite.service = NewApiKeyService(suite.db)
+}
+
+func (suite *ApiKeyServiceTestSuite) TestCreateApiKey_StoresOnlyHash() {
+	result, err := suite.service.CreateApiKey(1, &dto.ApiKeyCreateInput{Name: "lms", Scopes: []string{"course:read"}})
+	suite.NoError(err)
+	suite.True(strings.HasPrefix(result.Key, "gz_"+result.Prefix+"_"))
+
+	var stored ApiKey
+	suite.NoError(suite.db.First(&stored, result.ID).Error)
+	suite.NotContains(result.Key, stored.SecretHash)
+	suite.Equal([]string{"course:read"}, []string(stored.Scopes))
+}
+
+func (suite *ApiKeyServiceTestSuite) TestCreateApiKey_Validation() {
+	_, err := suite.service.CreateApiKey(1, &dto.ApiKeyCreateInput{Name: "lms", Scopes: []string{"auth:write"}})
+	suite.ErrorIs(err, ErrInvalidScope)
+
+	past := time.Now().Add(-time.Hour)
+	_, err = suite.service.CreateApiKey(1, &dto.ApiKeyCreateInput{Name: "lms", Scopes: []string{"course:read"}, ExpiresAt: &past})
+	suite.ErrorIs(err, ErrApiKeyExpired)
+}
+
+func (suite *ApiKeyServiceTestSuite) TestAuthenticate() {
+	result, _ := suite.service.CreateApiKey(1, &dto.ApiKeyCreateInput{Name: "lms", Scopes: []string{"course:read"}})
+
+	apiKey, owner, err := suite.service.Authenticate(result.Key)
+	suite.NoError(err)
+	suite.Equal(uint(1), owner.ID)
+	suite.NotNil(apiKey.LastUsedAt)
+
+	_, _, err = suite.service.Authenticate(result.Key[:len(result.Key)-1])
+	suite.ErrorIs(err, ErrInvalidApiKey)
+	_, _, err = suite.service.Authenticate("not-a-key")
+	suite.ErrorIs(err, ErrInvalidApiKey)
+}
+
+func (suite *ApiKeyServiceTestSuite) TestAuthenticate_ExpiredOrRevoked() {
+	result, _ := suite.service.CreateApiKey(1, &dto.ApiKeyCreateInput{Name: "lms", Scopes: []string{"course:read"}})
+	suite.db.Model(&ApiKey{}).Where("id = ?", result.ID).Update("expires_at", time.Now().Add(-time.Minute))
+	_, _, err := suite.service.Authenticate(result.Key)
+	suite.ErrorIs(err, ErrInvalidApiKey)
+
+	result, _ = suite.service.CreateApiKey(1, &dto.ApiKeyCreateInput{Name: "cli", Scopes: []string{"course:read"}})
+	_, err = suite.service.RevokeApiKey(1, result.ID)
+	suite.NoError(err)
+	_, _, err = suite.service.Authenticate(result.Key)
+	suite.ErrorIs(err, ErrInvalidApiKey)
+}
+
+func (suite *ApiKeyServiceTestSuite) TestRevokeApiKey_OnlyOwnKeys() {
+	suite.db.Create(&user.User{Username: "jane_doe", Email: "jane@doe.com"})
+	result, _ := suite.service.CreateApiKey(1, &dto.ApiKeyCreateInput{Name: "lms", Scopes: []string{"course:read"}})
+
+	_, err := suite.service.RevokeApiKey(2, result.ID)
+	suite.ErrorIs(err, gorm.ErrRecordNotFound)
+	apiKeys, _ := suite.service.FindManyApiKeys(2)
+	suite.Empty(apiKeys)
+}
+
+func (suite *ApiKeyServiceTestSuite) TestRequiredScope() {
+	scope, ok := RequiredScope(http.MethodGet, "/courses/")
+	suite.True(ok)
+	suite.Equal("course:read", scope)
+	scope, ok = RequiredScope(http.MethodDelete, "/orders/:id")
+	suite.True(ok)
+	suite.Equal("order:write", scope)
+	_, ok = RequiredScope(http.MethodPost, "/api-keys/")
+	suite.False(ok)
+
+	suite.True(HasScope([]string{"order:write"}, "order:read"))
+	suite.False(HasScope([]string{"order:read"}, "order:write"))
+}
+
+func TestApiKeyServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(ApiKeyServiceTestSuite))
+}
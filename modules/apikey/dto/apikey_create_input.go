@@ -0,0 +1,9 @@
+package dto
+
+import "time"
+
+type ApiKeyCreateInput struct {
+	Name      string     `json:"name" binding:"required,max=255"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
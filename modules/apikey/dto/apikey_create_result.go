@@ -0,0 +1,13 @@
+package dto
+
+import "time"
+
+// ApiKeyCreateResult is the only place the plain key is ever returned
+type ApiKeyCreateResult struct {
+	ID        uint       `json:"id"`
+	Name      string     `json:"name"`
+	Key       string     `json:"key"`
+	Prefix    string     `json:"prefix"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
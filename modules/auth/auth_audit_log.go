@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Values of AuditLog.Action
+const (
+	AuditImpersonationStart   = "impersonation.start"
+	AuditImpersonationRequest = "impersonation.request"
+)
+
+// AuditLogger records what admins do on behalf of other users
+type AuditLogger interface {
+	Record(entry *AuditLog) error
+}
+
+// AuditLog is an entry of the audit trail. UserID is the user acted upon, ActorID the admin
+// who actually performed the action.
+type AuditLog struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	Action    string    `gorm:"type:varchar(64);index" json:"action"`
+	ActorID   uint      `gorm:"type:integer;index" json:"actorId"`
+	UserID    uint      `gorm:"type:integer;index" json:"userId"`
+	TokenID   string    `gorm:"type:varchar(64);index" json:"tokenId"`
+	Method    string    `gorm:"type:varchar(16)" json:"method"`
+	Path      string    `gorm:"type:varchar(255)" json:"path"`
+	Status    int       `gorm:"type:integer" json:"status"`
+	IPAddress string    `gorm:"type:varchar(64)" json:"ipAddress"`
+	CreatedAt time.Time `gorm:"type:timestamp" json:"createdAt"`
+}
+
+type databaseAuditLogger struct {
+	Db *gorm.DB
+}
+
+// NewDatabaseAuditLogger returns an AuditLogger persisted through GORM
+func NewDatabaseAuditLogger(db *gorm.DB) AuditLogger {
+	return &databaseAuditLogger{Db: db}
+}
+
+func (l *databaseAuditLogger) Record(entry *AuditLog) error {
+	return l.Db.Create(entry).Error
+}
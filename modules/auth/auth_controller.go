@@ -1,53 +1,614 @@
-package auth
-
-import (
-	"net/http"
-
-	"github.com/gin-gonic/gin"
-	"github.com/irvanherz/gourze/modules/auth/dto"
-)
-
-type AuthController interface {
-	Signin(*gin.Context)
-	Signup(*gin.Context)
-}
-
-type authController struct {
-	Service AuthService
-}
-
-func NewAuthController(service AuthService) AuthController {
-	return &authController{service}
-}
-
-func (ac *authController) Signin(c *gin.Context) {
-	var input dto.AuthSigninInput
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
-		return
-	}
-	result, err := ac.Service.Signin(input)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
-		return
-	}
-	c.SetCookie("accessToken", result.AccessToken, 3600, "/", "", false, true)
-	c.SetCookie("refreshToken", result.RefreshToken, 3600, "/", "", false, true)
-	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Signin successful", "data": result})
-}
-
-func (ac *authController) Signup(c *gin.Context) {
-	var input dto.AuthSignupInput
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
-		return
-	}
-	result, err := ac.Service.Signup(input)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
-		return
-	}
-	c.SetCookie("accessToken", result.AccessToken, 3600, "/", "", false, true)
-	c.SetCookie("refreshToken", result.RefreshToken, 3600, "/", "", false, true)
-	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Signup successful", "data": result})
-}
+package auth
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/irvanherz/gourze/config"
+	"github.com/irvanherz/gourze/modules/auth/dto"
+	"github.com/irvanherz/gourze/modules/invite"
+	"github.com/irvanherz/gourze/modules/password"
+	"github.com/irvanherz/gourze/utils"
+	"gorm.io/gorm"
+)
+
+type AuthController interface {
+	Signin(*gin.Context)
+	Signup(*gin.Context)
+	Refresh(*gin.Context)
+	Signout(*gin.Context)
+	SignoutAll(*gin.Context)
+	SignoutUser(*gin.Context)
+	ForgotPassword(*gin.Context)
+	ResetPassword(*gin.Context)
+	VerifyEmail(*gin.Context)
+	ResendEmailVerification(*gin.Context)
+	RequestMagicLink(*gin.Context)
+	ConsumeMagicLink(*gin.Context)
+	UnlockUser(*gin.Context)
+	TwoFactorEnroll(*gin.Context)
+	TwoFactorActivate(*gin.Context)
+	TwoFactorVerify(*gin.Context)
+	TwoFactorDisable(*gin.Context)
+	ChangePassword(*gin.Context)
+	JWKS(*gin.Context)
+	Impersonate(*gin.Context)
+	CSRFToken(*gin.Context)
+	PasskeyRegisterBegin(*gin.Context)
+	PasskeyRegisterFinish(*gin.Context)
+	FindManyPasskeys(*gin.Context)
+	DeletePasskey(*gin.Context)
+	PasskeySigninBegin(*gin.Context)
+	PasskeySigninFinish(*gin.Context)
+}
+
+type authController struct {
+	Service    AuthService
+	KeyManager KeyManager
+	Config     *config.Config
+}
+
+func NewAuthController(service AuthService, keyManager KeyManager, conf *config.Config) AuthController {
+	return &authController{service, keyManager, conf}
+}
+
+func (ac *authController) Signin(c *gin.Context) {
+	var input dto.AuthSigninInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
+		return
+	}
+	input.IPAddress = c.ClientIP()
+	result, err := ac.Service.Signin(input)
+	if err != nil {
+		RespondSigninError(c, err)
+		return
+	}
+	if RespondSigninChallenge(c, result) {
+		return
+	}
+	if !input.SkipCookies {
+		SetAuthCookies(c, ac.Config, result)
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Signin successful", "data": result})
+}
+
+func (ac *authController) Signup(c *gin.Context) {
+	var input dto.AuthSignupInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
+		return
+	}
+	result, err := ac.Service.Signup(input)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrSignupNotAllowed):
+			c.JSON(http.StatusForbidden, gin.H{"code": "signup-not-allowed", "message": err.Error()})
+		case errors.Is(err, invite.ErrInvalidInvite):
+			c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-invite", "message": err.Error()})
+		case errors.Is(err, password.ErrWeakPassword), errors.Is(err, password.ErrBreachedPassword):
+			c.JSON(http.StatusBadRequest, gin.H{"code": "weak-password", "message": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+		}
+		return
+	}
+	if RespondSigninChallenge(c, result) {
+		return
+	}
+	SetAuthCookies(c, ac.Config, result)
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Signup successful", "data": result})
+}
+
+// Refresh rotates the refresh token sent in the body, falling back to the refreshToken cookie
+func (ac *authController) Refresh(c *gin.Context) {
+	var input dto.AuthRefreshTokenInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		refreshToken, cookieErr := c.Cookie(refreshTokenCookie)
+		if cookieErr != nil || refreshToken == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
+			return
+		}
+		input.RefreshToken = refreshToken
+	}
+	result, err := ac.Service.Refresh(input)
+	if err != nil {
+		if errors.Is(err, ErrInvalidRefreshToken) || errors.Is(err, ErrRefreshTokenReused) {
+			ClearAuthCookies(c, ac.Config)
+			c.JSON(http.StatusUnauthorized, gin.H{"code": "unauthorized", "message": err.Error()})
+			return
+		}
+		if errors.Is(err, ErrAccountSuspended) {
+			ClearAuthCookies(c, ac.Config)
+			respondAccountSuspended(c, err)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+		return
+	}
+	if !input.SkipCookies {
+		SetAuthCookies(c, ac.Config, result)
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Token refreshed successfully", "data": result})
+}
+
+// Signout revokes the current access token and refresh token, then clears the auth cookies
+func (ac *authController) Signout(c *gin.Context) {
+	var input dto.AuthSignoutInput
+	c.ShouldBindJSON(&input)
+	if input.RefreshToken == "" {
+		input.RefreshToken, _ = c.Cookie(refreshTokenCookie)
+	}
+
+	var tokenID string
+	var expiresAt time.Time
+	if currentUser, err := utils.GetCurrentUser(c); err == nil {
+		tokenID = currentUser.TokenID
+		expiresAt = currentUser.ExpiresAt
+	}
+	if err := ac.Service.Signout(tokenID, expiresAt, input.RefreshToken); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+		return
+	}
+	ClearAuthCookies(c, ac.Config)
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Signout successful"})
+}
+
+// SignoutAll revokes every token of the current user, signing them out on all devices
+func (ac *authController) SignoutAll(c *gin.Context) {
+	currentUser, err := utils.GetCurrentUser(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"code": "unauthorized", "message": "Unauthorized"})
+		return
+	}
+	if err := ac.Service.SignoutAll(currentUser.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+		return
+	}
+	ClearAuthCookies(c, ac.Config)
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Signed out from all devices"})
+}
+
+// SignoutUser lets an admin force a signout of every session of the given user
+func (ac *authController) SignoutUser(c *gin.Context) {
+	id := c.Param("id")
+	uid, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": "Invalid user ID"})
+		return
+	}
+	if err := ac.Service.SignoutAll(uint(uid)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "User signed out from all devices"})
+}
+
+// UnlockUser lets an admin lift a signin lockout of the given user
+func (ac *authController) UnlockUser(c *gin.Context) {
+	id := c.Param("id")
+	uid, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": "Invalid user ID"})
+		return
+	}
+	if err := ac.Service.UnlockUser(uint(uid)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "User unlocked"})
+}
+
+// Impersonate lets a super user act as another user. The token is only returned in the
+// body, so the cookies of the admin's own session stay untouched.
+func (ac *authController) Impersonate(c *gin.Context) {
+	currentUser, err := utils.GetCurrentUser(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"code": "unauthorized", "message": "Unauthorized"})
+		return
+	}
+	uid, err := strconv.ParseUint(c.Param("userId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": "Invalid user ID"})
+		return
+	}
+	result, err := ac.Service.Impersonate(currentUser.Actor(), uint(uid), c.ClientIP())
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrImpersonationForbidden):
+			c.JSON(http.StatusForbidden, gin.H{"code": "forbidden", "message": err.Error()})
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"code": "not-found", "message": "User not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Impersonation started", "data": result})
+}
+
+func (ac *authController) ForgotPassword(c *gin.Context) {
+	var input dto.AuthForgotPasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
+		return
+	}
+	if err := ac.Service.ForgotPassword(input); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "If the email is registered, a password reset link has been sent"})
+}
+
+func (ac *authController) ResetPassword(c *gin.Context) {
+	var input dto.AuthResetPasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
+		return
+	}
+	if err := ac.Service.ResetPassword(input); err != nil {
+		if errors.Is(err, ErrInvalidToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-token", "message": err.Error()})
+			return
+		}
+		if errors.Is(err, password.ErrWeakPassword) || errors.Is(err, password.ErrBreachedPassword) {
+			c.JSON(http.StatusBadRequest, gin.H{"code": "weak-password", "message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+		return
+	}
+	ClearAuthCookies(c, ac.Config)
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Password reset successful"})
+}
+
+func (ac *authController) VerifyEmail(c *gin.Context) {
+	var input dto.AuthVerifyEmailInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
+		return
+	}
+	if err := ac.Service.VerifyEmail(input); err != nil {
+		if errors.Is(err, ErrInvalidToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-token", "message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Email verified successfully"})
+}
+
+func (ac *authController) ResendEmailVerification(c *gin.Context) {
+	currentUser, err := utils.GetCurrentUser(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"code": "unauthorized", "message": "Unauthorized"})
+		return
+	}
+	if err := ac.Service.ResendEmailVerification(currentUser.ID); err != nil {
+		if errors.Is(err, ErrEmailAlreadyVerified) {
+			c.JSON(http.StatusConflict, gin.H{"code": "email-already-verified", "message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Verification email sent"})
+}
+
+func (ac *authController) RequestMagicLink(c *gin.Context) {
+	var input dto.AuthMagicLinkInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
+		return
+	}
+	if err := ac.Service.RequestMagicLink(input); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "If the email is registered, a signin link has been sent"})
+}
+
+// ConsumeMagicLink exchanges the token of a magic link for the same result as Signin
+func (ac *authController) ConsumeMagicLink(c *gin.Context) {
+	var input dto.AuthMagicLinkConsumeInput
+	if err := c.ShouldBindQuery(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
+		return
+	}
+	result, err := ac.Service.ConsumeMagicLink(input)
+	if err != nil {
+		if errors.Is(err, ErrInvalidToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-token", "message": err.Error()})
+			return
+		}
+		if errors.Is(err, ErrAccountSuspended) {
+			respondAccountSuspended(c, err)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+		return
+	}
+	if RespondSigninChallenge(c, result) {
+		return
+	}
+	if !input.SkipCookies {
+		SetAuthCookies(c, ac.Config, result)
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Signin successful", "data": result})
+}
+
+// TwoFactorEnroll starts a TOTP enrollment for the current user, or for a user holding a
+// signin challenge token when their role requires 2FA
+func (ac *authController) TwoFactorEnroll(c *gin.Context) {
+	var input dto.AuthTwoFactorEnrollInput
+	c.ShouldBindJSON(&input)
+	result, err := ac.Service.EnrollTwoFactor(input, currentUserID(c))
+	if err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Two-factor enrollment started", "data": result})
+}
+
+func (ac *authController) TwoFactorActivate(c *gin.Context) {
+	var input dto.AuthTwoFactorActivateInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
+		return
+	}
+	result, err := ac.Service.ActivateTwoFactor(input, currentUserID(c))
+	if err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+	if result.Auth != nil && result.Auth.AccessToken != "" && !input.SkipCookies {
+		SetAuthCookies(c, ac.Config, result.Auth)
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Two-factor authentication enabled", "data": result})
+}
+
+// TwoFactorVerify completes a signin that returned a challenge token
+func (ac *authController) TwoFactorVerify(c *gin.Context) {
+	var input dto.AuthTwoFactorVerifyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
+		return
+	}
+	result, err := ac.Service.VerifyTwoFactor(input)
+	if err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+	if RespondSigninChallenge(c, result) {
+		return
+	}
+	if !input.SkipCookies {
+		SetAuthCookies(c, ac.Config, result)
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Signin successful", "data": result})
+}
+
+func (ac *authController) TwoFactorDisable(c *gin.Context) {
+	var input dto.AuthTwoFactorDisableInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
+		return
+	}
+	if err := ac.Service.DisableTwoFactor(currentUserID(c), input); err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Two-factor authentication disabled"})
+}
+
+// ChangePassword changes the password of the current user, or completes a signin that returned
+// a password change challenge
+func (ac *authController) ChangePassword(c *gin.Context) {
+	var input dto.AuthChangePasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
+		return
+	}
+	result, err := ac.Service.ChangePassword(input, currentUserID(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, password.ErrWeakPassword), errors.Is(err, password.ErrBreachedPassword):
+			c.JSON(http.StatusBadRequest, gin.H{"code": "weak-password", "message": err.Error()})
+		case errors.Is(err, ErrInvalidToken):
+			c.JSON(http.StatusUnauthorized, gin.H{"code": "unauthorized", "message": err.Error()})
+		default:
+			RespondSigninError(c, err)
+		}
+		return
+	}
+	if !input.SkipCookies {
+		SetAuthCookies(c, ac.Config, result)
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Password changed successfully", "data": result})
+}
+
+// PasskeyRegisterBegin returns the options of navigator.credentials.create() for a new passkey of the current user
+func (ac *authController) PasskeyRegisterBegin(c *gin.Context) {
+	result, err := ac.Service.BeginPasskeyRegistration(currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Passkey registration started", "data": result})
+}
+
+func (ac *authController) PasskeyRegisterFinish(c *gin.Context) {
+	var input dto.AuthPasskeyRegisterInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
+		return
+	}
+	passkey, err := ac.Service.FinishPasskeyRegistration(currentUserID(c), input)
+	if err != nil {
+		respondPasskeyError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"code": "ok", "message": "Passkey registered", "data": passkey})
+}
+
+func (ac *authController) FindManyPasskeys(c *gin.Context) {
+	passkeys, err := ac.Service.FindManyPasskeys(currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Success", "data": passkeys})
+}
+
+func (ac *authController) DeletePasskey(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": "Invalid passkey ID"})
+		return
+	}
+	if err := ac.Service.DeletePasskey(currentUserID(c), uint(id)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"code": "not-found", "message": "Passkey not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Passkey deleted"})
+}
+
+// PasskeySigninBegin returns the options of navigator.credentials.get() for a passwordless signin
+func (ac *authController) PasskeySigninBegin(c *gin.Context) {
+	result, err := ac.Service.BeginPasskeySignin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Passkey signin started", "data": result})
+}
+
+// PasskeySigninFinish exchanges the assertion of a passkey for the same result as Signin
+func (ac *authController) PasskeySigninFinish(c *gin.Context) {
+	var input dto.AuthPasskeySigninInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
+		return
+	}
+	result, err := ac.Service.FinishPasskeySignin(input)
+	if err != nil {
+		respondPasskeyError(c, err)
+		return
+	}
+	if RespondSigninChallenge(c, result) {
+		return
+	}
+	if !input.SkipCookies {
+		SetAuthCookies(c, ac.Config, result)
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Signin successful", "data": result})
+}
+
+// currentUserID returns the ID of the signed in user, or 0 for guests
+func currentUserID(c *gin.Context) uint {
+	currentUser, err := utils.GetCurrentUser(c)
+	if err != nil {
+		return 0
+	}
+	return currentUser.ID
+}
+
+// RespondSigninError never tells apart unknown accounts from wrong passwords
+func RespondSigninError(c *gin.Context, err error) {
+	var lockedErr *SigninLockedError
+	switch {
+	case errors.As(err, &lockedErr):
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(lockedErr.RetryAfter.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"code": "too-many-attempts", "message": err.Error()})
+	case errors.Is(err, ErrInvalidCredentials):
+		c.JSON(http.StatusUnauthorized, gin.H{"code": "invalid-credentials", "message": err.Error()})
+	case errors.Is(err, ErrAccountSuspended):
+		respondAccountSuspended(c, err)
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+	}
+}
+
+func respondAccountSuspended(c *gin.Context, err error) {
+	c.JSON(http.StatusForbidden, gin.H{"code": "account-suspended", "message": err.Error()})
+}
+
+func respondTwoFactorError(c *gin.Context, err error) {
+	if errors.Is(err, ErrTooManySigninAttempts) || errors.Is(err, ErrAccountSuspended) {
+		RespondSigninError(c, err)
+		return
+	}
+	switch {
+	case errors.Is(err, ErrInvalidToken), errors.Is(err, ErrInvalidTwoFactorCode):
+		c.JSON(http.StatusUnauthorized, gin.H{"code": "unauthorized", "message": err.Error()})
+	case errors.Is(err, ErrTwoFactorAlreadyEnabled):
+		c.JSON(http.StatusConflict, gin.H{"code": "two-factor-already-enabled", "message": err.Error()})
+	case errors.Is(err, ErrTwoFactorNotEnrolled):
+		c.JSON(http.StatusBadRequest, gin.H{"code": "two-factor-not-enrolled", "message": err.Error()})
+	case errors.Is(err, ErrTwoFactorRequired):
+		c.JSON(http.StatusForbidden, gin.H{"code": "two-factor-required", "message": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+	}
+}
+
+func respondPasskeyError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidToken):
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-token", "message": err.Error()})
+	case errors.Is(err, ErrInvalidPasskey), errors.Is(err, ErrPasskeyCloned):
+		c.JSON(http.StatusUnauthorized, gin.H{"code": "invalid-passkey", "message": err.Error()})
+	case errors.Is(err, ErrAccountSuspended):
+		respondAccountSuspended(c, err)
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+	}
+}
+
+// RespondSigninChallenge answers signins that must still be completed with a second factor or a
+// password change, and reports whether it did
+func RespondSigninChallenge(c *gin.Context, result *dto.AuthResultDto) bool {
+	switch {
+	case result.TwoFactorRequired:
+		c.JSON(http.StatusOK, gin.H{"code": "two-factor-required", "message": "Two-factor authentication required", "data": result})
+	case result.PasswordChangeRequired:
+		c.JSON(http.StatusOK, gin.H{"code": "password-change-required", "message": "Password must be changed", "data": result})
+	default:
+		return false
+	}
+	return true
+}
+
+// JWKS serves the public signing keys as a plain JSON Web Key Set, which is what JWT libraries expect
+func (ac *authController) JWKS(c *gin.Context) {
+	set, err := ac.KeyManager.JWKS()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, set)
+}
+
+// CSRFToken returns the token browsers send in the X-CSRF-Token header of state-changing requests
+// authenticated by cookies. The token stays the same until the next signin.
+func (ac *authController) CSRFToken(c *gin.Context) {
+	token, err := c.Cookie(csrfTokenCookie)
+	if err != nil || token == "" {
+		if token, err = setCSRFCookie(c, ac.Config); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+			return
+		}
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Success", "data": dto.AuthCSRFTokenDto{CSRFToken: token}})
+}
@@ -6,9 +6,12 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/irvanherz/gourze/config"
 	"github.com/irvanherz/gourze/modules/auth/dto"
+	"github.com/irvanherz/gourze/modules/rbac"
 	"github.com/irvanherz/gourze/modules/user"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -28,6 +31,126 @@ func (m *MockAuthService) Signup(input dto.AuthSignupInput) (*dto.AuthResultDto,
 	return args.Get(0).(*dto.AuthResultDto), args.Error(1)
 }
 
+func (m *MockAuthService) Refresh(input dto.AuthRefreshTokenInput) (*dto.AuthResultDto, error) {
+	args := m.Called(input)
+	return args.Get(0).(*dto.AuthResultDto), args.Error(1)
+}
+
+func (m *MockAuthService) Signout(tokenID string, expiresAt time.Time, refreshToken string) error {
+	args := m.Called(tokenID, expiresAt, refreshToken)
+	return args.Error(0)
+}
+
+func (m *MockAuthService) SignoutAll(userID uint) error {
+	args := m.Called(userID)
+	return args.Error(0)
+}
+
+func (m *MockAuthService) ForgotPassword(input dto.AuthForgotPasswordInput) error {
+	args := m.Called(input)
+	return args.Error(0)
+}
+
+func (m *MockAuthService) ResetPassword(input dto.AuthResetPasswordInput) error {
+	args := m.Called(input)
+	return args.Error(0)
+}
+
+func (m *MockAuthService) VerifyEmail(input dto.AuthVerifyEmailInput) error {
+	args := m.Called(input)
+	return args.Error(0)
+}
+
+func (m *MockAuthService) ResendEmailVerification(userID uint) error {
+	args := m.Called(userID)
+	return args.Error(0)
+}
+
+func (m *MockAuthService) RequestMagicLink(input dto.AuthMagicLinkInput) error {
+	args := m.Called(input)
+	return args.Error(0)
+}
+
+func (m *MockAuthService) ConsumeMagicLink(input dto.AuthMagicLinkConsumeInput) (*dto.AuthResultDto, error) {
+	args := m.Called(input)
+	return args.Get(0).(*dto.AuthResultDto), args.Error(1)
+}
+
+func (m *MockAuthService) EnrollTwoFactor(input dto.AuthTwoFactorEnrollInput, userID uint) (*dto.AuthTwoFactorEnrollmentDto, error) {
+	args := m.Called(input, userID)
+	return args.Get(0).(*dto.AuthTwoFactorEnrollmentDto), args.Error(1)
+}
+
+func (m *MockAuthService) ActivateTwoFactor(input dto.AuthTwoFactorActivateInput, userID uint) (*dto.AuthTwoFactorActivationDto, error) {
+	args := m.Called(input, userID)
+	return args.Get(0).(*dto.AuthTwoFactorActivationDto), args.Error(1)
+}
+
+func (m *MockAuthService) VerifyTwoFactor(input dto.AuthTwoFactorVerifyInput) (*dto.AuthResultDto, error) {
+	args := m.Called(input)
+	return args.Get(0).(*dto.AuthResultDto), args.Error(1)
+}
+
+func (m *MockAuthService) DisableTwoFactor(userID uint, input dto.AuthTwoFactorDisableInput) error {
+	args := m.Called(userID, input)
+	return args.Error(0)
+}
+
+func (m *MockAuthService) UnlockUser(userID uint) error {
+	args := m.Called(userID)
+	return args.Error(0)
+}
+
+func (m *MockAuthService) Impersonate(actor rbac.Actor, userID uint, ipAddress string) (*dto.AuthImpersonationResultDto, error) {
+	args := m.Called(actor, userID, ipAddress)
+	return args.Get(0).(*dto.AuthImpersonationResultDto), args.Error(1)
+}
+
+func (m *MockAuthService) ChangePassword(input dto.AuthChangePasswordInput, userID uint) (*dto.AuthResultDto, error) {
+	args := m.Called(input, userID)
+	return args.Get(0).(*dto.AuthResultDto), args.Error(1)
+}
+
+func (m *MockAuthService) ConfirmPassword(userID uint, password string) error {
+	args := m.Called(userID, password)
+	return args.Error(0)
+}
+
+func (m *MockAuthService) BeginPasskeyRegistration(userID uint) (*dto.AuthPasskeyOptionsDto, error) {
+	args := m.Called(userID)
+	return args.Get(0).(*dto.AuthPasskeyOptionsDto), args.Error(1)
+}
+
+func (m *MockAuthService) FinishPasskeyRegistration(userID uint, input dto.AuthPasskeyRegisterInput) (*PasskeyCredential, error) {
+	args := m.Called(userID, input)
+	return args.Get(0).(*PasskeyCredential), args.Error(1)
+}
+
+func (m *MockAuthService) FindManyPasskeys(userID uint) ([]PasskeyCredential, error) {
+	args := m.Called(userID)
+	return args.Get(0).([]PasskeyCredential), args.Error(1)
+}
+
+func (m *MockAuthService) DeletePasskey(userID, id uint) error {
+	args := m.Called(userID, id)
+	return args.Error(0)
+}
+
+func (m *MockAuthService) BeginPasskeySignin() (*dto.AuthPasskeyOptionsDto, error) {
+	args := m.Called()
+	return args.Get(0).(*dto.AuthPasskeyOptionsDto), args.Error(1)
+}
+
+func (m *MockAuthService) FinishPasskeySignin(input dto.AuthPasskeySigninInput) (*dto.AuthResultDto, error) {
+	args := m.Called(input)
+	return args.Get(0).(*dto.AuthResultDto), args.Error(1)
+}
+
+func (m *MockAuthService) IssueTokens(user user.User) (*dto.AuthResultDto, error) {
+	args := m.Called(user)
+	return args.Get(0).(*dto.AuthResultDto), args.Error(1)
+}
+
 func (m *MockAuthService) HashPassword(password string) (string, error) {
 	args := m.Called(password)
 	return args.String(0), args.Error(1)
@@ -47,11 +170,94 @@ func (m *MockAuthService) GenerateRefreshToken(user user.User) (string, error) {
 	return args.String(0), args.Error(1)
 }
 
+func TestSignin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockService := new(MockAuthService)
+	conf := &config.Config{Auth: config.AuthConfig{CookieSecure: true, CookieSameSite: "strict", CookieDomain: "gourze.com"}}
+	controller := NewAuthController(mockService, nil, conf)
+
+	router := gin.Default()
+	router.POST("/signin", controller.Signin)
+
+	output := &dto.AuthResultDto{
+		AccessToken:  "access-token",
+		RefreshToken: "refresh-token",
+	}
+
+	t.Run("sets cookies by default", func(t *testing.T) {
+		input := dto.AuthSigninInput{UsernameOrEmail: "testuser", Password: "password"}
+		mockService.On("Signin", input).Return(output, nil).Once()
+
+		body, _ := json.Marshal(input)
+		req, _ := http.NewRequest(http.MethodPost, "/signin", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		cookies := w.Result().Cookies()
+		assert.Len(t, cookies, 3)
+		for _, cookie := range cookies {
+			assert.True(t, cookie.Secure)
+			assert.Equal(t, http.SameSiteStrictMode, cookie.SameSite)
+			assert.Equal(t, "gourze.com", cookie.Domain)
+			// Scripts read the CSRF token, never the tokens
+			assert.Equal(t, cookie.Name != "csrfToken", cookie.HttpOnly)
+		}
+	})
+
+	t.Run("skips cookies when asked", func(t *testing.T) {
+		input := dto.AuthSigninInput{UsernameOrEmail: "testuser", Password: "password", SkipCookies: true}
+		mockService.On("Signin", input).Return(output, nil).Once()
+
+		body, _ := json.Marshal(input)
+		req, _ := http.NewRequest(http.MethodPost, "/signin", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Result().Cookies())
+		assert.Contains(t, w.Body.String(), "access-token")
+	})
+
+	t.Run("invalid credentials", func(t *testing.T) {
+		input := dto.AuthSigninInput{UsernameOrEmail: "nobody", Password: "password"}
+		mockService.On("Signin", input).Return((*dto.AuthResultDto)(nil), ErrInvalidCredentials).Once()
+
+		body, _ := json.Marshal(input)
+		req, _ := http.NewRequest(http.MethodPost, "/signin", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "invalid-credentials")
+	})
+
+	t.Run("locked out", func(t *testing.T) {
+		input := dto.AuthSigninInput{UsernameOrEmail: "testuser", Password: "guess"}
+		mockService.On("Signin", input).Return((*dto.AuthResultDto)(nil), &SigninLockedError{RetryAfter: 90 * time.Second}).Once()
+
+		body, _ := json.Marshal(input)
+		req, _ := http.NewRequest(http.MethodPost, "/signin", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "90", w.Header().Get("Retry-After"))
+	})
+
+	mockService.AssertExpectations(t)
+}
+
 func TestSignup(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
 	mockService := new(MockAuthService)
-	controller := NewAuthController(mockService)
+	controller := NewAuthController(mockService, nil, &config.Config{})
 
 	router := gin.Default()
 	router.POST("/signup", controller.Signup)
@@ -108,3 +314,75 @@ func TestSignup(t *testing.T) {
 		mockService.AssertExpectations(t)
 	})
 }
+
+func TestTwoFactorActivate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockService := new(MockAuthService)
+	controller := NewAuthController(mockService, nil, &config.Config{})
+
+	router := gin.Default()
+	router.POST("/2fa/activate", controller.TwoFactorActivate)
+
+	// Activating with a challenge token completes the signin
+	output := &dto.AuthTwoFactorActivationDto{
+		RecoveryCodes: []string{"recovery-code"},
+		Auth:          &dto.AuthResultDto{AccessToken: "access-token", RefreshToken: "refresh-token"},
+	}
+
+	t.Run("sets cookies by default", func(t *testing.T) {
+		input := dto.AuthTwoFactorActivateInput{ChallengeToken: "challenge", Code: "123456"}
+		mockService.On("ActivateTwoFactor", input, uint(0)).Return(output, nil).Once()
+
+		body, _ := json.Marshal(input)
+		req, _ := http.NewRequest(http.MethodPost, "/2fa/activate", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Len(t, w.Result().Cookies(), 3)
+	})
+
+	t.Run("skips cookies when asked", func(t *testing.T) {
+		input := dto.AuthTwoFactorActivateInput{ChallengeToken: "challenge", Code: "123456", SkipCookies: true}
+		mockService.On("ActivateTwoFactor", input, uint(0)).Return(output, nil).Once()
+
+		body, _ := json.Marshal(input)
+		req, _ := http.NewRequest(http.MethodPost, "/2fa/activate", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Result().Cookies())
+		assert.Contains(t, w.Body.String(), "access-token")
+	})
+
+	mockService.AssertExpectations(t)
+}
+
+func TestCSRFToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	controller := NewAuthController(new(MockAuthService), nil, &config.Config{})
+	router := gin.Default()
+	router.GET("/csrf-token", controller.CSRFToken)
+
+	req, _ := http.NewRequest(http.MethodGet, "/csrf-token", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	cookies := w.Result().Cookies()
+	assert.Len(t, cookies, 1)
+	assert.Equal(t, "csrfToken", cookies[0].Name)
+	assert.False(t, cookies[0].HttpOnly)
+	assert.Contains(t, w.Body.String(), cookies[0].Value)
+
+	// An existing token is returned as is
+	req, _ = http.NewRequest(http.MethodGet, "/csrf-token", nil)
+	req.AddCookie(&http.Cookie{Name: "csrfToken", Value: "existing"})
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Empty(t, w.Result().Cookies())
+	assert.Contains(t, w.Body.String(), `"csrfToken":"existing"`)
+}
@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/irvanherz/gourze/config"
+	"github.com/irvanherz/gourze/modules/auth/dto"
+)
+
+const (
+	accessTokenCookie  = "accessToken"
+	refreshTokenCookie = "refreshToken"
+	// csrfTokenCookie is readable by scripts, which send it back in the csrfTokenHeader
+	csrfTokenCookie = "csrfToken"
+	csrfTokenHeader = "X-CSRF-Token"
+)
+
+// SetAuthCookies stores the tokens of a signin result in http-only cookies, along with a new CSRF token
+func SetAuthCookies(c *gin.Context, conf *config.Config, result *dto.AuthResultDto) {
+	now := time.Now().Unix()
+	setCookie(c, conf, accessTokenCookie, result.AccessToken, int(result.AccessTokenExpiredAt-now), true)
+	setCookie(c, conf, refreshTokenCookie, result.RefreshToken, int(result.RefreshTokenExpiredAt-now), true)
+	if _, err := setCSRFCookie(c, conf); err != nil {
+		// Cookie-authenticated requests are refused until the token is fetched again
+		fmt.Println("Failed to issue CSRF token:", err)
+	}
+}
+
+func ClearAuthCookies(c *gin.Context, conf *config.Config) {
+	setCookie(c, conf, accessTokenCookie, "", -1, true)
+	setCookie(c, conf, refreshTokenCookie, "", -1, true)
+}
+
+// setCSRFCookie stores a new CSRF token in the csrfToken cookie and returns it
+func setCSRFCookie(c *gin.Context, conf *config.Config) (string, error) {
+	token, err := generateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	// The token lives as long as the refresh token, so it outlasts the session it protects
+	maxAge := int(conf.Auth.RefreshTokenExpirationTime)
+	if maxAge == 0 {
+		maxAge = int((30 * 24 * time.Hour).Seconds())
+	}
+	setCookie(c, conf, csrfTokenCookie, token, maxAge, false)
+	return token, nil
+}
+
+func setCookie(c *gin.Context, conf *config.Config, name, value string, maxAge int, httpOnly bool) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		MaxAge:   maxAge,
+		Path:     "/",
+		Domain:   conf.Auth.CookieDomain,
+		Secure:   conf.Auth.CookieSecure,
+		HttpOnly: httpOnly,
+		SameSite: cookieSameSite(conf),
+	})
+}
+
+// cookieSameSite parses Config.Auth.CookieSameSite, which defaults to lax
+func cookieSameSite(conf *config.Config) http.SameSite {
+	switch strings.ToLower(conf.Auth.CookieSameSite) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
+	}
+}
@@ -0,0 +1,379 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/irvanherz/gourze/config"
+	"github.com/irvanherz/gourze/modules/auth/dto"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Values of Config.Auth.JWTAlgorithm
+const (
+	algorithmHS256 = "HS256"
+	algorithmRS256 = "RS256"
+	algorithmEdDSA = "EdDSA"
+)
+
+// keyReloadInterval limits how often unknown key IDs make us reload the keys from the database,
+// and how long a cached signing key is used before checking it wasn't retired elsewhere
+const keyReloadInterval = 10 * time.Second
+
+// signingKeyRotationLock is the postgres advisory lock key rotations are serialized with
+const signingKeyRotationLock = 718293
+
+var ErrUnknownSigningKey = errors.New("unknown signing key")
+
+// KeyManager owns the keys tokens are signed and verified with. With HS256 it signs with
+// Config.Auth.JWTSecret, with RS256 and EdDSA it generates key pairs and rotates them.
+type KeyManager interface {
+	// Sign signs the claims with the current key, rotating it first when it is due
+	Sign(claims jwt.Claims) (string, error)
+	// Keyfunc resolves the key verifying a token from its kid header, see jwt.Keyfunc
+	Keyfunc(token *jwt.Token) (interface{}, error)
+	// ValidMethods lists the signing methods accepted when verifying tokens
+	ValidMethods() []string
+	// JWKS returns the public keys that currently verify tokens
+	JWKS() (*dto.JSONWebKeySet, error)
+}
+
+type keyManager struct {
+	Db     *gorm.DB
+	Config *config.Config
+
+	mu       sync.Mutex
+	keys     map[string]*loadedKey
+	current  *loadedKey
+	loadedAt time.Time
+}
+
+// loadedKey is a stored key with its decrypted private key
+type loadedKey struct {
+	SigningKey
+	signer crypto.Signer
+}
+
+func NewKeyManager(db *gorm.DB, conf *config.Config) KeyManager {
+	return &keyManager{Db: db, Config: conf, keys: map[string]*loadedKey{}}
+}
+
+// Sign implements KeyManager.
+func (m *keyManager) Sign(claims jwt.Claims) (string, error) {
+	if m.algorithm() == algorithmHS256 {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(m.Config.Auth.JWTSecret))
+	}
+	key, err := m.signingKey()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.KeyID
+	return token.SignedString(key.signer)
+}
+
+// Keyfunc implements KeyManager.
+func (m *keyManager) Keyfunc(token *jwt.Token) (interface{}, error) {
+	if m.algorithm() == algorithmHS256 {
+		return []byte(m.Config.Auth.JWTSecret), nil
+	}
+	kid, _ := token.Header["kid"].(string)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key, ok := m.keys[kid]
+	// The key may have been created by another instance since we last loaded
+	if !ok && time.Since(m.loadedAt) > keyReloadInterval {
+		if err := m.load(); err != nil {
+			return nil, err
+		}
+		key, ok = m.keys[kid]
+	}
+	if !ok || !m.isVerifying(key) || token.Method.Alg() != key.Algorithm {
+		return nil, ErrUnknownSigningKey
+	}
+	return key.signer.Public(), nil
+}
+
+// ValidMethods implements KeyManager. Both asymmetric methods are accepted so tokens stay
+// valid while switching algorithms, Keyfunc checks the method of each key.
+func (m *keyManager) ValidMethods() []string {
+	if m.algorithm() == algorithmHS256 {
+		return []string{algorithmHS256}
+	}
+	return []string{algorithmRS256, algorithmEdDSA}
+}
+
+// JWKS implements KeyManager.
+func (m *keyManager) JWKS() (*dto.JSONWebKeySet, error) {
+	set := &dto.JSONWebKeySet{Keys: []dto.JSONWebKey{}}
+	if m.algorithm() == algorithmHS256 {
+		return set, nil
+	}
+	// Make sure there is a key to publish before the first token gets signed
+	if _, err := m.signingKey(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if time.Since(m.loadedAt) > keyReloadInterval {
+		if err := m.load(); err != nil {
+			return nil, err
+		}
+	}
+	var keys []*loadedKey
+	for _, key := range m.keys {
+		if m.isVerifying(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.After(keys[j].CreatedAt) })
+	for _, key := range keys {
+		jwk, err := publicJWK(key)
+		if err != nil {
+			return nil, err
+		}
+		set.Keys = append(set.Keys, *jwk)
+	}
+	return set, nil
+}
+
+// signingKey returns the newest key, generating a new one when there is none or it is due for rotation
+func (m *keyManager) signingKey() (*loadedKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// The cached key is trusted for keyReloadInterval only, another instance may have retired it
+	if m.isCurrent(m.current) && time.Since(m.loadedAt) < keyReloadInterval {
+		return m.current, nil
+	}
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+	if m.isCurrent(m.current) {
+		return m.current, nil
+	}
+	return m.rotate()
+}
+
+// rotate retires the active keys and stores a new one. Rotations are serialized across
+// instances, an instance that waited for another one signs with the key it created.
+func (m *keyManager) rotate() (*loadedKey, error) {
+	keyID, err := generateRandomToken(12)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, err := m.generateKey()
+	if err != nil {
+		return nil, err
+	}
+	encryptedKey, err := m.encrypt(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	err = m.Db.Transaction(func(tx *gorm.DB) error {
+		if tx.Dialector.Name() == "postgres" {
+			// Held until the transaction ends, also when there is no active key to lock yet
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", signingKeyRotationLock).Error; err != nil {
+				return err
+			}
+		}
+		var active []SigningKey
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("retired_at IS NULL").
+			Find(&active).Error
+		if err != nil {
+			return err
+		}
+		for _, signingKey := range active {
+			if _, err := m.decrypt(signingKey.PrivateKey); err != nil {
+				continue
+			}
+			if m.isCurrent(&loadedKey{SigningKey: signingKey}) {
+				// Rotated by another instance since we loaded the keys
+				return nil
+			}
+		}
+		if err := tx.Model(&SigningKey{}).Where("retired_at IS NULL").Update("retired_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Create(&SigningKey{KeyID: keyID, Algorithm: m.algorithm(), PrivateKey: encryptedKey}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+	if m.current == nil {
+		return nil, errors.New("failed to load the new signing key")
+	}
+	return m.current, nil
+}
+
+// load replaces the cached keys with the keys in the database that still verify tokens
+func (m *keyManager) load() error {
+	var stored []SigningKey
+	err := m.Db.Where("retired_at IS NULL OR retired_at > ?", time.Now().Add(-m.gracePeriod())).
+		Order("created_at desc").
+		Find(&stored).Error
+	if err != nil {
+		return err
+	}
+	keys := make(map[string]*loadedKey, len(stored))
+	var current *loadedKey
+	for _, signingKey := range stored {
+		signer, err := m.decrypt(signingKey.PrivateKey)
+		if err != nil {
+			// Keys encrypted with a previous JWT secret are unusable, a new key replaces them
+			fmt.Println("Failed to decrypt signing key", signingKey.KeyID+":", err)
+			continue
+		}
+		key := &loadedKey{SigningKey: signingKey, signer: signer}
+		keys[key.KeyID] = key
+		if current == nil && key.RetiredAt == nil {
+			current = key
+		}
+	}
+	m.keys = keys
+	m.current = current
+	m.loadedAt = time.Now()
+	return nil
+}
+
+// isCurrent reports whether key may sign new tokens
+func (m *keyManager) isCurrent(key *loadedKey) bool {
+	return key != nil &&
+		key.RetiredAt == nil &&
+		key.Algorithm == m.algorithm() &&
+		time.Since(key.CreatedAt) < m.rotationInterval()
+}
+
+// isVerifying reports whether tokens signed with key are still accepted
+func (m *keyManager) isVerifying(key *loadedKey) bool {
+	return key.RetiredAt == nil || time.Since(*key.RetiredAt) < m.gracePeriod()
+}
+
+func (m *keyManager) generateKey() (crypto.Signer, error) {
+	switch m.algorithm() {
+	case algorithmRS256:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case algorithmEdDSA:
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		return privateKey, err
+	default:
+		return nil, fmt.Errorf("unsupported JWT algorithm %q", m.algorithm())
+	}
+}
+
+func (m *keyManager) encrypt(privateKey crypto.Signer) (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return "", err
+	}
+	aead, err := m.cipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, der, nil)), nil
+}
+
+func (m *keyManager) decrypt(encrypted string) (crypto.Signer, error) {
+	data, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := m.cipher()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("encrypted key too short")
+	}
+	der, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("stored key can't sign")
+	}
+	return signer, nil
+}
+
+// cipher derives the key encrypting the stored private keys from the JWT secret
+func (m *keyManager) cipher() (cipher.AEAD, error) {
+	sum := sha256.Sum256([]byte("gourze signing keys:" + m.Config.Auth.JWTSecret))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (m *keyManager) algorithm() string {
+	if m.Config.Auth.JWTAlgorithm == "" {
+		return algorithmHS256
+	}
+	return m.Config.Auth.JWTAlgorithm
+}
+
+func (m *keyManager) rotationInterval() time.Duration {
+	if m.Config.Auth.JWTKeyRotationInterval == 0 {
+		return 30 * 24 * time.Hour
+	}
+	return time.Duration(m.Config.Auth.JWTKeyRotationInterval) * time.Second
+}
+
+// gracePeriod is never shorter than the access token lifetime, so rotating doesn't sign anybody out
+func (m *keyManager) gracePeriod() time.Duration {
+	gracePeriod := 24 * time.Hour
+	if m.Config.Auth.JWTKeyGracePeriod != 0 {
+		gracePeriod = time.Duration(m.Config.Auth.JWTKeyGracePeriod) * time.Second
+	}
+	accessTokenTTL := time.Hour
+	if m.Config.Auth.AccessTokenExpirationTime != 0 {
+		accessTokenTTL = time.Duration(m.Config.Auth.AccessTokenExpirationTime) * time.Second
+	}
+	return max(gracePeriod, accessTokenTTL)
+}
+
+func publicJWK(key *loadedKey) (*dto.JSONWebKey, error) {
+	jwk := dto.JSONWebKey{Kid: key.KeyID, Use: "sig", Alg: key.Algorithm}
+	switch publicKey := key.signer.Public().(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(publicKey)
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", publicKey)
+	}
+	return &jwk, nil
+}
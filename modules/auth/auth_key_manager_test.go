@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/irvanherz/gourze/config"
+	"github.com/irvanherz/gourze/modules/auth/dto"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+)
+
+type KeyManagerTestSuite struct {
+	suite.Suite
+	db     *gorm.DB
+	config *config.Config
+	keys   KeyManager
+}
+
+func (suite *KeyManagerTestSuite) SetupTest() {
+	suite.db = setupTestDB()
+	suite.config = &config.Config{
+		Auth: config.AuthConfig{
+			JWTSecret:              "testsecret",
+			JWTAlgorithm:           "RS256",
+			JWTKeyRotationInterval: 3600,
+			JWTKeyGracePeriod:      7200,
+		},
+	}
+	suite.keys = NewKeyManager(suite.db, suite.config)
+}
+
+func (suite *KeyManagerTestSuite) sign() string {
+	token, err := suite.keys.Sign(jwt.RegisteredClaims{Subject: "1"})
+	suite.Require().NoError(err)
+	return token
+}
+
+func (suite *KeyManagerTestSuite) verify(tokenString string) error {
+	_, err := jwt.Parse(tokenString, suite.keys.Keyfunc, jwt.WithValidMethods(suite.keys.ValidMethods()))
+	return err
+}
+
+// verifyWithJWKS checks a token the way another service would, with the published keys only
+func (suite *KeyManagerTestSuite) verifyWithJWKS(tokenString string, set *dto.JSONWebKeySet) error {
+	_, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		for _, jwk := range set.Keys {
+			if jwk.Kid != token.Header["kid"] {
+				continue
+			}
+			switch jwk.Kty {
+			case "RSA":
+				n, _ := base64.RawURLEncoding.DecodeString(jwk.N)
+				e, _ := base64.RawURLEncoding.DecodeString(jwk.E)
+				return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+			case "OKP":
+				x, _ := base64.RawURLEncoding.DecodeString(jwk.X)
+				return ed25519.PublicKey(x), nil
+			}
+		}
+		return nil, ErrUnknownSigningKey
+	})
+	return err
+}
+
+func (suite *KeyManagerTestSuite) TestSign_PublishedInJWKS() {
+	token := suite.sign()
+	suite.NoError(suite.verify(token))
+
+	set, err := suite.keys.JWKS()
+	suite.NoError(err)
+	suite.Len(set.Keys, 1)
+	suite.Equal("RS256", set.Keys[0].Alg)
+	suite.NoError(suite.verifyWithJWKS(token, set))
+
+	// The private key is stored encrypted
+	var stored SigningKey
+	suite.db.First(&stored)
+	suite.NotContains(stored.PrivateKey, "PRIVATE KEY")
+}
+
+func (suite *KeyManagerTestSuite) TestRotation_GracePeriod() {
+	oldToken := suite.sign()
+	suite.db.Model(&SigningKey{}).Where("1 = 1").Update("created_at", time.Now().Add(-2*time.Hour))
+	suite.keys = NewKeyManager(suite.db, suite.config)
+
+	newToken := suite.sign()
+	suite.NoError(suite.verify(newToken))
+	// Tokens signed with the retired key keep working during the grace period
+	suite.NoError(suite.verify(oldToken))
+	set, _ := suite.keys.JWKS()
+	suite.Len(set.Keys, 2)
+	suite.NoError(suite.verifyWithJWKS(oldToken, set))
+
+	suite.db.Model(&SigningKey{}).Where("retired_at IS NOT NULL").Update("retired_at", time.Now().Add(-3*time.Hour))
+	suite.keys = NewKeyManager(suite.db, suite.config)
+	suite.ErrorIs(suite.verify(oldToken), ErrUnknownSigningKey)
+	suite.NoError(suite.verify(newToken))
+	set, _ = suite.keys.JWKS()
+	suite.Len(set.Keys, 1)
+}
+
+func (suite *KeyManagerTestSuite) TestRotation_AnotherInstanceRotatedFirst() {
+	suite.sign()
+	suite.db.Model(&SigningKey{}).Where("1 = 1").Update("created_at", time.Now().Add(-2*time.Hour))
+	waiting := NewKeyManager(suite.db, suite.config).(*keyManager)
+	suite.Require().NoError(waiting.load())
+
+	// Another instance rotates while this one waits for the rotation lock
+	rotated := NewKeyManager(suite.db, suite.config)
+	_, err := rotated.Sign(jwt.RegisteredClaims{Subject: "1"})
+	suite.Require().NoError(err)
+	var newest SigningKey
+	suite.db.Where("retired_at IS NULL").First(&newest)
+
+	key, err := waiting.rotate()
+	suite.Require().NoError(err)
+	suite.Equal(newest.KeyID, key.KeyID)
+	var count int64
+	suite.db.Model(&SigningKey{}).Count(&count)
+	suite.Equal(int64(2), count)
+}
+
+func (suite *KeyManagerTestSuite) TestSign_CachedKeyRetiredElsewhere() {
+	suite.sign()
+	manager := suite.keys.(*keyManager)
+	retired := manager.current.KeyID
+
+	// Retired by another instance, the cached key is only trusted until the next reload
+	suite.db.Model(&SigningKey{}).Where("key_id = ?", retired).Update("retired_at", time.Now())
+	manager.loadedAt = time.Now().Add(-keyReloadInterval)
+
+	token := suite.sign()
+	parsed, _, _ := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+	suite.NotEqual(retired, parsed.Header["kid"])
+	suite.NoError(suite.verify(token))
+}
+
+func (suite *KeyManagerTestSuite) TestEdDSA() {
+	suite.config.Auth.JWTAlgorithm = "EdDSA"
+	token := suite.sign()
+	suite.NoError(suite.verify(token))
+
+	set, _ := suite.keys.JWKS()
+	suite.Equal("OKP", set.Keys[0].Kty)
+	suite.NoError(suite.verifyWithJWKS(token, set))
+}
+
+func (suite *KeyManagerTestSuite) TestKeyfunc_RejectsOtherAlgorithms() {
+	token := suite.sign()
+	parsed, _, _ := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+	// A token claiming HS256 under a known kid must not be checked against the public key
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "1"})
+	forged.Header["kid"] = parsed.Header["kid"]
+	forgedString, _ := forged.SignedString([]byte("testsecret"))
+	suite.Error(suite.verify(forgedString))
+
+	_, err := suite.keys.Keyfunc(&jwt.Token{Method: jwt.SigningMethodHS256, Header: parsed.Header})
+	suite.ErrorIs(err, ErrUnknownSigningKey)
+}
+
+func (suite *KeyManagerTestSuite) TestHS256_PublishesNoKeys() {
+	suite.config.Auth.JWTAlgorithm = "HS256"
+	suite.NoError(suite.verify(suite.sign()))
+	set, err := suite.keys.JWKS()
+	suite.NoError(err)
+	suite.Empty(set.Keys)
+}
+
+func TestKeyManagerTestSuite(t *testing.T) {
+	suite.Run(t, new(KeyManagerTestSuite))
+}
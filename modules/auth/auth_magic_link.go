@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/irvanherz/gourze/modules/auth/dto"
+	"github.com/irvanherz/gourze/modules/mail"
+	"github.com/irvanherz/gourze/modules/user"
+	"gorm.io/gorm"
+)
+
+// RequestMagicLink implements AuthService. Like ForgotPassword, unknown emails are silently ignored.
+// The link points to the frontend rather than to the consume endpoint, so mail scanners
+// prefetching links can't use it up.
+func (s *authService) RequestMagicLink(input dto.AuthMagicLinkInput) error {
+	var user user.User
+	if err := s.Db.Where("email = ?", input.Email).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	// Only the most recent link stays valid
+	if err := s.invalidateOneTimeTokens(user.ID, MagicLink); err != nil {
+		return err
+	}
+	token, err := s.issueOneTimeToken(user.ID, MagicLink, s.magicLinkTTL())
+	if err != nil {
+		return err
+	}
+
+	signinURL := fmt.Sprintf("%s/magic-link?token=%s", s.Config.App.FrontendURL, url.QueryEscape(token))
+	return s.Mailer.Send(mail.Message{
+		To:      []string{user.Email},
+		Subject: "Sign in to Gourze",
+		Body: fmt.Sprintf("Hi %s,\n\nOpen the link below to sign in to Gourze:\n\n%s\n\nThe link expires in %d minutes and can only be used once. If you didn't ask for this, you can ignore this email.\n",
+			user.FullName, signinURL, int(s.magicLinkTTL().Minutes())),
+	})
+}
+
+// ConsumeMagicLink implements AuthService. Opening the link proves the user owns the email
+// address, so it also verifies it. Accounts with a second factor get a challenge token, as with Signin.
+func (s *authService) ConsumeMagicLink(input dto.AuthMagicLinkConsumeInput) (*dto.AuthResultDto, error) {
+	var signedIn user.User
+	err := s.Db.Transaction(func(tx *gorm.DB) error {
+		magicLink, err := s.consumeOneTimeToken(tx, input.Token, MagicLink)
+		if err != nil {
+			return err
+		}
+		if err := tx.First(&signedIn, magicLink.UserID).Error; err != nil {
+			return err
+		}
+		if signedIn.EmailVerifiedAt == nil {
+			now := time.Now()
+			signedIn.EmailVerifiedAt = &now
+			return tx.Model(&signedIn).Update("email_verified_at", now).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.IssueTokens(signedIn)
+}
+
+func (s *authService) magicLinkTTL() time.Duration {
+	if s.Config.Auth.MagicLinkExpirationTime == 0 {
+		return 15 * time.Minute
+	}
+	return time.Duration(s.Config.Auth.MagicLinkExpirationTime) * time.Second
+}
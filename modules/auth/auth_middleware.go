@@ -1,95 +1,312 @@
-package auth
-
-import (
-	"fmt"
-	"net/http"
-
-	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
-	"github.com/irvanherz/gourze/config"
-	"github.com/irvanherz/gourze/modules/user"
-)
-
-type AuthMiddleware interface {
-	Authenticate() gin.HandlerFunc
-	Authorize(mandatory bool, allowedRoles ...user.UserRole) gin.HandlerFunc
-}
-
-type authMiddleware struct {
-	Config *config.Config
-}
-
-func (m *authMiddleware) Authorize(mandatory bool, allowedRoles ...user.UserRole) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		user, exists := c.Get("user")
-
-		if !exists {
-			if mandatory {
-				fmt.Println("Unauthorized access")
-				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-				return
-			}
-			c.Next() // Guest access allowed
-			return
-		}
-
-		// Retrieve user role from claims
-		claims := user.(jwt.MapClaims)
-		userRole, ok := claims["aud"].(string)
-		if !ok {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-			return
-		}
-
-		// Check if user role is allowed
-		if len(allowedRoles) == 0 {
-			c.Next()
-			return
-		}
-		for _, role := range allowedRoles {
-			if userRole == string(role) {
-				c.Next()
-				return
-			}
-		}
-
-		// Role not allowed
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-	}
-}
-
-// Optional authentication - proceeds even if auth fails
-func (m *authMiddleware) Authenticate() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		claims, err := m.parseAccessTokenFromCookie(c)
-		if err == nil {
-			c.Set("user", claims)
-		}
-		c.Next()
-	}
-}
-
-func (m *authMiddleware) parseAccessTokenFromCookie(c *gin.Context) (jwt.MapClaims, error) {
-	tokenString, err := c.Cookie("accessToken")
-	if err != nil {
-		return nil, fmt.Errorf("no token found")
-	}
-
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return []byte(m.Config.Auth.JWTSecret), nil
-	})
-	if err != nil || !token.Valid {
-		return nil, fmt.Errorf("invalid token")
-	}
-
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return nil, fmt.Errorf("invalid claims format")
-	}
-
-	return claims, nil
-}
-
-func NewAuthMiddleware(config *config.Config) AuthMiddleware {
-	return &authMiddleware{config}
-}
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/irvanherz/gourze/config"
+	"github.com/irvanherz/gourze/modules/apikey"
+	"github.com/irvanherz/gourze/modules/rbac"
+	"github.com/irvanherz/gourze/modules/user"
+	"github.com/irvanherz/gourze/utils"
+	"gorm.io/gorm"
+)
+
+type AuthMiddleware interface {
+	Authenticate() gin.HandlerFunc
+	Authorize(mandatory bool) gin.HandlerFunc
+	RequirePermission(permissions ...string) gin.HandlerFunc
+	RequireVerifiedEmail() gin.HandlerFunc
+	DenyImpersonation() gin.HandlerFunc
+	VerifyCSRFToken() gin.HandlerFunc
+}
+
+type authMiddleware struct {
+	Config            *config.Config
+	RevocationStore   RevocationStore
+	UserService       user.UserService
+	ApiKeyService     apikey.ApiKeyService
+	PermissionChecker rbac.PermissionChecker
+	KeyManager        KeyManager
+	AuditLogger       AuditLogger
+	SessionService    SessionService
+}
+
+func (m *authMiddleware) Authorize(mandatory bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, err := utils.GetCurrentUser(c); err != nil {
+			if mandatory {
+				fmt.Println("Unauthorized access")
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+				return
+			}
+			c.Next() // Guest access allowed
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequirePermission only lets through authenticated users whose role holds all of the given permissions
+func (m *authMiddleware) RequirePermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		currentUser, err := utils.GetCurrentUser(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		allowed, err := m.PermissionChecker.HasPermission(currentUser.Role, permissions...)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+			return
+		}
+		if !allowed {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"code": "forbidden", "message": "You don't have permission to perform this action"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireVerifiedEmail only lets through authenticated users who confirmed their email address.
+// Chain it after Authorize.
+func (m *authMiddleware) RequireVerifiedEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		currentUser, err := utils.GetCurrentUser(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		user, err := currentUser.User()
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		if user.EmailVerifiedAt == nil {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"code": "email-not-verified", "message": "Email address must be verified"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// DenyImpersonation refuses sensitive actions, such as payments or security settings,
+// to admins impersonating a user
+func (m *authMiddleware) DenyImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if currentUser, err := utils.GetCurrentUser(c); err == nil && currentUser.IsImpersonated() {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"code": "impersonation-forbidden", "message": "This action is not allowed while impersonating a user"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// VerifyCSRFToken refuses state-changing requests that carry auth cookies unless the X-CSRF-Token
+// header matches the csrfToken cookie, which other sites can't read. Requests authenticated by the
+// Authorization header or an API key are let through, browsers never attach those on their own.
+func (m *authMiddleware) VerifyCSRFToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+		if accessTokenFromHeader(c) != "" || c.GetHeader("X-API-Key") != "" || !hasAuthCookie(c) {
+			c.Next()
+			return
+		}
+		cookieToken, _ := c.Cookie(csrfTokenCookie)
+		headerToken := c.GetHeader(csrfTokenHeader)
+		if cookieToken == "" || subtle.ConstantTimeCompare([]byte(cookieToken), []byte(headerToken)) != 1 {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"code": "invalid-csrf-token", "message": "Missing or invalid CSRF token"})
+			return
+		}
+		c.Next()
+	}
+}
+
+func hasAuthCookie(c *gin.Context) bool {
+	for _, name := range []string{accessTokenCookie, refreshTokenCookie} {
+		if value, err := c.Cookie(name); err == nil && value != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Optional authentication - proceeds even if auth fails
+func (m *authMiddleware) Authenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if rawKey := c.GetHeader("X-API-Key"); rawKey != "" {
+			m.authenticateApiKey(c, rawKey)
+			return
+		}
+		claims, err := m.parseAccessToken(c)
+		if err != nil || m.isRevoked(claims) || !m.isSessionActive(c, claims) {
+			c.Next() // Continue as guest
+			return
+		}
+		currentUser := m.currentUser(claims)
+		if m.abortIfSuspended(c, currentUser) {
+			return
+		}
+		c.Set("user", currentUser)
+		c.Next()
+		if currentUser.IsImpersonated() {
+			m.auditImpersonatedRequest(c, currentUser)
+		}
+	}
+}
+
+// abortIfSuspended refuses requests of suspended users, whose tokens stay valid until they expire.
+// Impersonating admins are let through so they can look into the account. Deleted users are
+// treated as signed out.
+func (m *authMiddleware) abortIfSuspended(c *gin.Context, currentUser *utils.CurrentUser) bool {
+	if currentUser.IsImpersonated() {
+		return false
+	}
+	user, err := currentUser.User()
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return true
+	}
+	if err != nil {
+		return false // Other lookup failures are left to the routes, which load the user themselves
+	}
+	if err := checkNotSuspended(*user); err != nil {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"code": "account-suspended", "message": err.Error()})
+		return true
+	}
+	return false
+}
+
+// auditImpersonatedRequest records a request made with an impersonation token once it has been handled
+func (m *authMiddleware) auditImpersonatedRequest(c *gin.Context, currentUser *utils.CurrentUser) {
+	err := m.AuditLogger.Record(&AuditLog{
+		Action:    AuditImpersonationRequest,
+		ActorID:   currentUser.ImpersonatorID,
+		UserID:    currentUser.ID,
+		TokenID:   currentUser.TokenID,
+		Method:    c.Request.Method,
+		Path:      c.Request.URL.Path,
+		Status:    c.Writer.Status(),
+		IPAddress: c.ClientIP(),
+	})
+	if err != nil {
+		fmt.Println("Failed to record impersonated request:", err)
+	}
+}
+
+// authenticateApiKey signs the request in as the owner of the key. A key only opens the routes its scopes cover.
+func (m *authMiddleware) authenticateApiKey(c *gin.Context, rawKey string) {
+	apiKey, owner, err := m.ApiKeyService.Authenticate(rawKey)
+	if err != nil {
+		if !errors.Is(err, apikey.ErrInvalidApiKey) {
+			fmt.Println("Failed to authenticate API key:", err)
+		}
+		c.Next() // Continue as guest, like with an invalid token
+		return
+	}
+	scope, ok := apikey.RequiredScope(c.Request.Method, c.FullPath())
+	if !ok || !apikey.HasScope(apiKey.Scopes, scope) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"code": "insufficient-scope", "message": "API key is not allowed to access this route"})
+		return
+	}
+	currentUser := &utils.CurrentUser{ID: owner.ID, Role: owner.Role, Scopes: apiKey.Scopes}
+	currentUser.SetUserLoader(func() (*user.User, error) { return owner, nil })
+	if m.abortIfSuspended(c, currentUser) {
+		return
+	}
+	c.Set("user", currentUser)
+	c.Next()
+}
+
+// currentUser turns validated access token claims into the CurrentUser of the request
+func (m *authMiddleware) currentUser(claims *Claims) *utils.CurrentUser {
+	userID, _ := claims.UserID()
+	impersonatorID, _ := claims.ImpersonatorID()
+	currentUser := &utils.CurrentUser{
+		ID:             userID,
+		Role:           claims.Role,
+		TokenID:        claims.ID,
+		SessionID:      claims.SessionID,
+		Scopes:         strings.Fields(claims.Scope),
+		ImpersonatorID: impersonatorID,
+	}
+	if claims.ExpiresAt != nil {
+		currentUser.ExpiresAt = claims.ExpiresAt.Time
+	}
+	currentUser.SetUserLoader(func() (*user.User, error) { return m.UserService.FindUserByID(userID) })
+	return currentUser
+}
+
+// parseAccessToken reads the access token from the Authorization header or the accessToken cookie.
+// When both are present, Config.Auth.TokenPrecedence ("header" or "cookie") decides which one wins.
+func (m *authMiddleware) parseAccessToken(c *gin.Context) (*Claims, error) {
+	sources := []func(*gin.Context) string{accessTokenFromHeader, accessTokenFromCookie}
+	if m.Config.Auth.TokenPrecedence == "cookie" {
+		sources = []func(*gin.Context) string{accessTokenFromCookie, accessTokenFromHeader}
+	}
+	for _, source := range sources {
+		if tokenString := source(c); tokenString != "" {
+			return m.parseToken(tokenString)
+		}
+	}
+	return nil, fmt.Errorf("no token found")
+}
+
+func accessTokenFromHeader(c *gin.Context) string {
+	scheme, tokenString, found := strings.Cut(c.GetHeader("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(tokenString)
+}
+
+func accessTokenFromCookie(c *gin.Context) string {
+	tokenString, _ := c.Cookie(accessTokenCookie)
+	return tokenString
+}
+
+func (m *authMiddleware) parseToken(tokenString string) (*Claims, error) {
+	return parseClaims(m.Config, m.KeyManager, tokenString, accessTokenType)
+}
+
+// isRevoked reports whether the token was revoked by signout, "signout everywhere" or an admin.
+// Tokens are treated as revoked when the store cannot be reached.
+func (m *authMiddleware) isRevoked(claims *Claims) bool {
+	userID, err := claims.UserID()
+	if err != nil || claims.IssuedAt == nil {
+		return true
+	}
+	revoked, err := m.RevocationStore.IsRevoked(claims.ID, userID, claims.IssuedAt.Time)
+	if err != nil {
+		fmt.Println("Failed to check token revocation:", err)
+		return true
+	}
+	return revoked
+}
+
+// isSessionActive records the activity of the session the token belongs to, and reports whether
+// the session is still active. Like revocations, errors reject the token.
+func (m *authMiddleware) isSessionActive(c *gin.Context, claims *Claims) bool {
+	if claims.SessionID == "" {
+		return true
+	}
+	if err := m.SessionService.Touch(claims.SessionID, c.ClientIP(), c.Request.UserAgent()); err != nil {
+		if !errors.Is(err, ErrSessionRevoked) {
+			fmt.Println("Failed to check session:", err)
+		}
+		return false
+	}
+	return true
+}
+
+func NewAuthMiddleware(config *config.Config, revocationStore RevocationStore, userService user.UserService, apiKeyService apikey.ApiKeyService, permissionChecker rbac.PermissionChecker, keyManager KeyManager, auditLogger AuditLogger, sessionService SessionService) AuthMiddleware {
+	return &authMiddleware{Config: config, RevocationStore: revocationStore, UserService: userService, ApiKeyService: apiKeyService, PermissionChecker: permissionChecker, KeyManager: keyManager, AuditLogger: auditLogger, SessionService: sessionService}
+}
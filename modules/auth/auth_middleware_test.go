@@ -0,0 +1,411 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/irvanherz/gourze/config"
+	"github.com/irvanherz/gourze/modules/apikey"
+	apiKeyDto "github.com/irvanherz/gourze/modules/apikey/dto"
+	"github.com/irvanherz/gourze/modules/invite"
+	"github.com/irvanherz/gourze/modules/password"
+	"github.com/irvanherz/gourze/modules/rbac"
+	"github.com/irvanherz/gourze/modules/user"
+	"github.com/irvanherz/gourze/utils"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+)
+
+type AuthMiddlewareTestSuite struct {
+	suite.Suite
+	db            *gorm.DB
+	service       AuthService
+	apiKeyService apikey.ApiKeyService
+	keyManager    KeyManager
+	middleware    AuthMiddleware
+	router        *gin.Engine
+}
+
+func (suite *AuthMiddlewareTestSuite) SetupTest() {
+	gin.SetMode(gin.TestMode)
+	suite.db = setupTestDB()
+	suite.db.AutoMigrate(&rbac.Permission{}, &rbac.Role{})
+	rbac.SeedRoles(suite.db)
+	conf := &config.Config{
+		Auth: config.AuthConfig{
+			JWTSecret:    "testsecret",
+			JWTIssuer:    "gourze",
+			JWTAudience:  "gourze-api",
+			JWTAlgorithm: "RS256",
+		},
+	}
+	revocationStore := NewDatabaseRevocationStore(suite.db)
+	passwordPolicy := password.NewPasswordPolicy(conf, password.NewBreachedPasswordChecker(conf))
+	suite.keyManager = NewKeyManager(suite.db, conf)
+	suite.service = NewAuthService(suite.db, conf, revocationStore, &fakeMailer{}, suite.keyManager, NewDatabaseAuditLogger(suite.db), passwordPolicy, invite.NewInviteService(suite.db))
+	suite.apiKeyService = apikey.NewApiKeyService(suite.db)
+	suite.middleware = NewAuthMiddleware(conf, revocationStore, user.NewUserService(suite.db, passwordPolicy, suite.service), suite.apiKeyService, rbac.NewRbacService(suite.db), suite.keyManager, NewDatabaseAuditLogger(suite.db), NewSessionService(suite.db))
+
+	suite.router = gin.New()
+	suite.router.Use(suite.middleware.VerifyCSRFToken())
+	suite.router.Use(suite.middleware.Authenticate())
+	suite.router.GET("/private", suite.middleware.Authorize(true), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"code": "ok"})
+	})
+	suite.router.GET("/courses/", suite.middleware.Authorize(true), func(c *gin.Context) {
+		currentUser, _ := utils.GetCurrentUser(c)
+		c.JSON(http.StatusOK, gin.H{"code": "ok", "data": currentUser})
+	})
+	suite.router.POST("/courses/", suite.middleware.Authorize(true), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"code": "ok"})
+	})
+	suite.router.GET("/users", suite.middleware.Authorize(true), suite.middleware.RequirePermission(rbac.UserRead), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"code": "ok"})
+	})
+	suite.router.GET("/verified", suite.middleware.Authorize(true), suite.middleware.RequireVerifiedEmail(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"code": "ok"})
+	})
+}
+
+func (suite *AuthMiddlewareTestSuite) request(accessToken string) int {
+	req, _ := http.NewRequest(http.MethodGet, "/private", nil)
+	req.AddCookie(&http.Cookie{Name: "accessToken", Value: accessToken})
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w.Code
+}
+
+func (suite *AuthMiddlewareTestSuite) requestWithHeader(accessToken string) int {
+	req, _ := http.NewRequest(http.MethodGet, "/private", nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w.Code
+}
+
+func (suite *AuthMiddlewareTestSuite) TestAuthenticate_BearerToken() {
+	suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com"})
+	accessToken, _ := suite.service.GenerateAccessToken(user.User{ID: 1, Role: user.Generic})
+	suite.Equal(http.StatusOK, suite.requestWithHeader(accessToken))
+	suite.Equal(http.StatusUnauthorized, suite.requestWithHeader("invalid"))
+}
+
+func (suite *AuthMiddlewareTestSuite) TestAuthenticate_TokenPrecedence() {
+	suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com"})
+	accessToken, _ := suite.service.GenerateAccessToken(user.User{ID: 1, Role: user.Generic})
+	req, _ := http.NewRequest(http.MethodGet, "/private", nil)
+	req.Header.Set("Authorization", "Bearer invalid")
+	req.AddCookie(&http.Cookie{Name: "accessToken", Value: accessToken})
+
+	// Header wins by default
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	suite.Equal(http.StatusUnauthorized, w.Code)
+
+	suite.middleware.(*authMiddleware).Config.Auth.TokenPrecedence = "cookie"
+	w = httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	suite.Equal(http.StatusOK, w.Code)
+}
+
+func (suite *AuthMiddlewareTestSuite) TestAuthenticate_ValidToken() {
+	suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com"})
+	accessToken, _ := suite.service.GenerateAccessToken(user.User{ID: 1, Role: user.Generic})
+	suite.Equal(http.StatusOK, suite.request(accessToken))
+}
+
+func (suite *AuthMiddlewareTestSuite) TestAuthenticate_IssuerAndAudience() {
+	conf := suite.middleware.(*authMiddleware).Config
+	for _, claims := range []*Claims{
+		{Type: accessTokenType},
+		{RegisteredClaims: jwt.RegisteredClaims{Issuer: "someone-else", Audience: jwt.ClaimStrings{"gourze-api"}}, Type: accessTokenType},
+		{RegisteredClaims: jwt.RegisteredClaims{Issuer: "gourze", Audience: jwt.ClaimStrings{"another-api"}}, Type: accessTokenType},
+	} {
+		claims.Subject = "1"
+		claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(time.Hour))
+		claims.IssuedAt = jwt.NewNumericDate(time.Now())
+		token, _ := suite.keyManager.Sign(claims)
+		suite.Equal(http.StatusUnauthorized, suite.request(token))
+	}
+
+	// Tokens signed with the shared secret aren't accepted once keys are asymmetric
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: "1", Issuer: conf.Auth.JWTIssuer, Audience: jwt.ClaimStrings{conf.Auth.JWTAudience}, ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)), IssuedAt: jwt.NewNumericDate(time.Now())},
+		Type:             accessTokenType,
+	}).SignedString([]byte(conf.Auth.JWTSecret))
+	suite.Equal(http.StatusUnauthorized, suite.request(token))
+}
+
+func (suite *AuthMiddlewareTestSuite) TestAuthenticate_CurrentUser() {
+	suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com", Role: user.Admin})
+	result, err := suite.service.IssueTokens(user.User{ID: 1, Role: user.Admin})
+	suite.Require().NoError(err)
+
+	var currentUser *utils.CurrentUser
+	suite.router.GET("/me", func(c *gin.Context) {
+		currentUser, _ = utils.GetCurrentUser(c)
+	})
+	req, _ := http.NewRequest(http.MethodGet, "/me", nil)
+	req.Header.Set("Authorization", "Bearer "+result.AccessToken)
+	suite.router.ServeHTTP(httptest.NewRecorder(), req)
+
+	suite.Require().NotNil(currentUser)
+	suite.Equal(uint(1), currentUser.ID)
+	suite.Equal(user.Admin, currentUser.Role)
+	suite.NotEmpty(currentUser.SessionID)
+	loaded, err := currentUser.User()
+	suite.NoError(err)
+	suite.Equal("john_doe", loaded.Username)
+}
+
+func (suite *AuthMiddlewareTestSuite) TestAuthenticate_RevokedToken() {
+	accessToken, _ := suite.service.GenerateAccessToken(user.User{ID: 1, Role: user.Generic})
+
+	// Resolve the token claims the same way the signout handler does
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	claims, _ := suite.middleware.(*authMiddleware).parseToken(accessToken)
+	c.Set("user", suite.middleware.(*authMiddleware).currentUser(claims))
+	currentUser, err := utils.GetCurrentUser(c)
+	suite.NoError(err)
+
+	suite.NoError(suite.service.Signout(currentUser.TokenID, currentUser.ExpiresAt, ""))
+	suite.Equal(http.StatusUnauthorized, suite.request(accessToken))
+}
+
+func (suite *AuthMiddlewareTestSuite) TestAuthenticate_RevokedSession() {
+	suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com"})
+	phone, _ := suite.service.IssueTokens(user.User{ID: 1})
+	laptop, _ := suite.service.IssueTokens(user.User{ID: 1})
+	suite.Equal(http.StatusOK, suite.request(phone.AccessToken))
+
+	var session Session
+	suite.db.Order("id").First(&session)
+	suite.NoError(NewSessionService(suite.db).RevokeSession(1, session.ID))
+	suite.Equal(http.StatusUnauthorized, suite.request(phone.AccessToken))
+	suite.Equal(http.StatusOK, suite.request(laptop.AccessToken))
+}
+
+// accessTokenIssuedAt signs an access token without a session as if it was issued at issuedAt
+func (suite *AuthMiddlewareTestSuite) accessTokenIssuedAt(userID uint, issuedAt time.Time) string {
+	token, _ := signClaims(suite.middleware.(*authMiddleware).Config, suite.keyManager, &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        fmt.Sprintf("token-%d-%d", userID, issuedAt.Unix()),
+			Subject:   strconv.FormatUint(uint64(userID), 10),
+			ExpiresAt: jwt.NewNumericDate(issuedAt.Add(time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(issuedAt),
+		},
+		Role: user.Generic,
+		Type: accessTokenType,
+	})
+	return token
+}
+
+func (suite *AuthMiddlewareTestSuite) TestAuthenticate_UserSignedOutEverywhere() {
+	suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com"})
+	suite.db.Create(&user.User{Username: "jane_doe", Email: "jane@doe.com"})
+	accessToken := suite.accessTokenIssuedAt(1, time.Now().Add(-time.Second))
+	otherAccessToken := suite.accessTokenIssuedAt(2, time.Now().Add(-time.Second))
+
+	suite.NoError(suite.service.SignoutAll(1))
+	suite.Equal(http.StatusUnauthorized, suite.request(accessToken))
+	suite.Equal(http.StatusOK, suite.request(otherAccessToken))
+}
+
+func (suite *AuthMiddlewareTestSuite) TestAuthenticate_SigninRightAfterSignoutAll() {
+	suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com"})
+	suite.NoError(suite.service.SignoutAll(1))
+
+	// Signing in within the same second as the signout must work
+	result, err := suite.service.IssueTokens(user.User{ID: 1})
+	suite.Require().NoError(err)
+	suite.Equal(http.StatusOK, suite.request(result.AccessToken))
+}
+
+func (suite *AuthMiddlewareTestSuite) TestAuthenticate_RejectsTwoFactorChallenge() {
+	suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com"})
+	suite.db.Create(&TwoFactorCredential{UserID: 1, Secret: "JBSWY3DPEHPK3PXP", EnabledAt: &time.Time{}})
+
+	challenge, err := suite.service.(*authService).twoFactorChallenge(user.User{ID: 1})
+	suite.NoError(err)
+	suite.Equal(http.StatusUnauthorized, suite.request(challenge.ChallengeToken))
+}
+
+func (suite *AuthMiddlewareTestSuite) TestVerifyCSRFToken() {
+	suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com"})
+	accessToken, _ := suite.service.GenerateAccessToken(user.User{ID: 1, Role: user.Generic})
+	post := func(csrfCookie, csrfHeader string) int {
+		req, _ := http.NewRequest(http.MethodPost, "/courses/", nil)
+		req.AddCookie(&http.Cookie{Name: "accessToken", Value: accessToken})
+		if csrfCookie != "" {
+			req.AddCookie(&http.Cookie{Name: "csrfToken", Value: csrfCookie})
+		}
+		if csrfHeader != "" {
+			req.Header.Set("X-CSRF-Token", csrfHeader)
+		}
+		w := httptest.NewRecorder()
+		suite.router.ServeHTTP(w, req)
+		return w.Code
+	}
+	suite.Equal(http.StatusForbidden, post("", ""))
+	suite.Equal(http.StatusForbidden, post("token", ""))
+	suite.Equal(http.StatusForbidden, post("token", "other"))
+	suite.Equal(http.StatusOK, post("token", "token"))
+
+	// Safe methods and requests that don't rely on cookies need no token
+	suite.Equal(http.StatusOK, suite.request(accessToken))
+	req, _ := http.NewRequest(http.MethodPost, "/courses/", nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	suite.Equal(http.StatusOK, w.Code)
+}
+
+func (suite *AuthMiddlewareTestSuite) requestWithApiKey(method, path, key string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, nil)
+	req.Header.Set("X-API-Key", key)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *AuthMiddlewareTestSuite) TestAuthenticate_SuspendedUser() {
+	suspendedAt := time.Now()
+	suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com", Role: user.Admin, SuspendedAt: &suspendedAt, SuspensionReason: "Spam"})
+	accessToken, _ := suite.service.GenerateAccessToken(user.User{ID: 1, Role: user.Admin})
+	suite.Equal(http.StatusForbidden, suite.request(accessToken))
+
+	result, _ := suite.apiKeyService.CreateApiKey(1, &apiKeyDto.ApiKeyCreateInput{Name: "lms", Scopes: []string{"course:read"}})
+	w := suite.requestWithApiKey(http.MethodGet, "/courses/", result.Key)
+	suite.Equal(http.StatusForbidden, w.Code)
+	suite.Contains(w.Body.String(), "account-suspended")
+}
+
+func (suite *AuthMiddlewareTestSuite) TestAuthenticate_DeletedUser() {
+	suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com"})
+	accessToken, _ := suite.service.GenerateAccessToken(user.User{ID: 1, Role: user.Generic})
+	suite.Equal(http.StatusOK, suite.request(accessToken))
+
+	// Tokens of deleted users stop working before they expire
+	suite.db.Delete(&user.User{}, 1)
+	suite.Equal(http.StatusUnauthorized, suite.request(accessToken))
+}
+
+func (suite *AuthMiddlewareTestSuite) TestAuthenticate_ApiKeyScopes() {
+	suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com", Role: user.Admin})
+	result, err := suite.apiKeyService.CreateApiKey(1, &apiKeyDto.ApiKeyCreateInput{Name: "lms", Scopes: []string{"course:read"}})
+	suite.Require().NoError(err)
+
+	w := suite.requestWithApiKey(http.MethodGet, "/courses/", result.Key)
+	suite.Equal(http.StatusOK, w.Code)
+	suite.Contains(w.Body.String(), `"ID":1`)
+	suite.Contains(w.Body.String(), `"Role":"admin"`)
+	suite.Contains(w.Body.String(), `"Scopes":["course:read"]`)
+
+	suite.Equal(http.StatusForbidden, suite.requestWithApiKey(http.MethodPost, "/courses/", result.Key).Code)
+	// Routes outside of the scoped resources are off limits
+	suite.Equal(http.StatusForbidden, suite.requestWithApiKey(http.MethodGet, "/private", result.Key).Code)
+}
+
+func (suite *AuthMiddlewareTestSuite) TestAuthenticate_InvalidApiKey() {
+	suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com"})
+	result, _ := suite.apiKeyService.CreateApiKey(1, &apiKeyDto.ApiKeyCreateInput{Name: "lms", Scopes: []string{"course:write"}})
+
+	suite.Equal(http.StatusUnauthorized, suite.requestWithApiKey(http.MethodGet, "/courses/", result.Key+"x").Code)
+	suite.apiKeyService.RevokeApiKey(1, result.ID)
+	suite.Equal(http.StatusUnauthorized, suite.requestWithApiKey(http.MethodPost, "/courses/", result.Key).Code)
+}
+
+func (suite *AuthMiddlewareTestSuite) TestRequireVerifiedEmail() {
+	verifiedAt := time.Now()
+	suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com"})
+	suite.db.Create(&user.User{Username: "jane_doe", Email: "jane@doe.com", EmailVerifiedAt: &verifiedAt})
+	unverifiedToken, _ := suite.service.GenerateAccessToken(user.User{ID: 1, Role: user.Generic})
+	verifiedToken, _ := suite.service.GenerateAccessToken(user.User{ID: 2, Role: user.Generic})
+
+	for token, expected := range map[string]int{unverifiedToken: http.StatusForbidden, verifiedToken: http.StatusOK} {
+		req, _ := http.NewRequest(http.MethodGet, "/verified", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		suite.router.ServeHTTP(w, req)
+		suite.Equal(expected, w.Code)
+	}
+}
+
+func (suite *AuthMiddlewareTestSuite) TestRequirePermission() {
+	suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com"})
+	for role, expected := range map[user.UserRole]int{user.Generic: http.StatusForbidden, user.Admin: http.StatusOK, user.Super: http.StatusOK} {
+		accessToken, _ := suite.service.GenerateAccessToken(user.User{ID: 1, Role: role})
+		req, _ := http.NewRequest(http.MethodGet, "/users", nil)
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		w := httptest.NewRecorder()
+		suite.router.ServeHTTP(w, req)
+		suite.Equal(expected, w.Code, role)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "/users", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	suite.Equal(http.StatusUnauthorized, w.Code)
+}
+
+func (suite *AuthMiddlewareTestSuite) TestImpersonation() {
+	suite.db.Create(&user.User{Username: "root", Email: "root@gourze.com", Role: user.Super})
+	suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com"})
+	result, err := suite.service.Impersonate(rbac.Actor{ID: 1, Role: user.Super}, 2, "127.0.0.1")
+	suite.Require().NoError(err)
+
+	var currentUser *utils.CurrentUser
+	suite.router.GET("/me", func(c *gin.Context) {
+		currentUser, _ = utils.GetCurrentUser(c)
+	})
+	suite.router.POST("/orders/", suite.middleware.Authorize(true), suite.middleware.DenyImpersonation(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"code": "ok"})
+	})
+	request := func(method, path string) int {
+		req, _ := http.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+result.AccessToken)
+		w := httptest.NewRecorder()
+		suite.router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	request(http.MethodGet, "/me")
+	suite.Require().NotNil(currentUser)
+	suite.Equal(uint(2), currentUser.ID)
+	suite.Equal(uint(1), currentUser.ImpersonatorID)
+	suite.True(currentUser.IsImpersonated())
+	suite.Equal(http.StatusForbidden, request(http.MethodPost, "/orders/"))
+
+	var logs []AuditLog
+	suite.db.Order("id").Find(&logs)
+	suite.Require().Len(logs, 3)
+	suite.Equal(AuditImpersonationStart, logs[0].Action)
+	for _, log := range logs[1:] {
+		suite.Equal(AuditImpersonationRequest, log.Action)
+		suite.Equal(uint(1), log.ActorID)
+		suite.Equal(uint(2), log.UserID)
+	}
+	suite.Equal("/orders/", logs[2].Path)
+	suite.Equal(http.StatusForbidden, logs[2].Status)
+
+	// Regular tokens are neither denied nor audited
+	accessToken, _ := suite.service.GenerateAccessToken(user.User{ID: 2, Role: user.Generic})
+	req, _ := http.NewRequest(http.MethodPost, "/orders/", nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	suite.Equal(http.StatusOK, w.Code)
+	var count int64
+	suite.db.Model(&AuditLog{}).Count(&count)
+	suite.Equal(int64(3), count)
+}
+
+func TestAuthMiddlewareTestSuite(t *testing.T) {
+	suite.Run(t, new(AuthMiddlewareTestSuite))
+}
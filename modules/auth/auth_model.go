@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// RefreshToken stores a hashed refresh token. Tokens issued from the same
+// signin share a FamilyID so the whole chain can be revoked on reuse.
+type RefreshToken struct {
+	ID           uint       `gorm:"primarykey" json:"id"`
+	UserID       uint       `gorm:"type:integer;index" json:"userId"`
+	FamilyID     string     `gorm:"type:varchar(64);index" json:"familyId"`
+	TokenHash    string     `gorm:"unique;type:varchar(64)" json:"-"`
+	ExpiresAt    time.Time  `gorm:"type:timestamp" json:"expiresAt"`
+	RevokedAt    *time.Time `gorm:"type:timestamp" json:"revokedAt"`
+	ReplacedByID *uint      `gorm:"type:integer" json:"replacedById"`
+	CreatedAt    time.Time  `gorm:"type:timestamp" json:"createdAt"`
+	UpdatedAt    time.Time  `gorm:"type:timestamp" json:"updatedAt"`
+}
+
+type TokenPurpose string
+
+const (
+	PasswordReset     TokenPurpose = "password_reset"
+	EmailVerification TokenPurpose = "email_verification"
+	MagicLink         TokenPurpose = "magic_link"
+)
+
+// OneTimeToken is a hashed, expiring, single use token sent to the user out of band (e.g. by email)
+type OneTimeToken struct {
+	ID        uint         `gorm:"primarykey" json:"id"`
+	UserID    uint         `gorm:"type:integer;index" json:"userId"`
+	Purpose   TokenPurpose `gorm:"type:token_purpose;not null" json:"purpose"`
+	TokenHash string       `gorm:"unique;type:varchar(64)" json:"-"`
+	ExpiresAt time.Time    `gorm:"type:timestamp" json:"expiresAt"`
+	UsedAt    *time.Time   `gorm:"type:timestamp" json:"usedAt"`
+	CreatedAt time.Time    `gorm:"type:timestamp" json:"createdAt"`
+	UpdatedAt time.Time    `gorm:"type:timestamp" json:"updatedAt"`
+}
+
+// TwoFactorCredential holds the TOTP secret of a user. Two-factor authentication
+// is only enforced once the enrollment has been activated (EnabledAt is set).
+type TwoFactorCredential struct {
+	ID           uint       `gorm:"primarykey" json:"id"`
+	UserID       uint       `gorm:"unique;type:integer" json:"userId"`
+	Secret       string     `gorm:"type:varchar(64);not null" json:"-"`
+	EnabledAt    *time.Time `gorm:"type:timestamp" json:"enabledAt"`
+	LastUsedStep int64      `gorm:"type:bigint;not null;default:0" json:"-"`
+	CreatedAt    time.Time  `gorm:"type:timestamp" json:"createdAt"`
+	UpdatedAt    time.Time  `gorm:"type:timestamp" json:"updatedAt"`
+}
+
+// RecoveryCode is a hashed single use code that replaces a TOTP code when the authenticator is lost
+type RecoveryCode struct {
+	ID        uint       `gorm:"primarykey" json:"id"`
+	UserID    uint       `gorm:"type:integer;index" json:"userId"`
+	CodeHash  string     `gorm:"type:varchar(64);index" json:"-"`
+	UsedAt    *time.Time `gorm:"type:timestamp" json:"usedAt"`
+	CreatedAt time.Time  `gorm:"type:timestamp" json:"createdAt"`
+	UpdatedAt time.Time  `gorm:"type:timestamp" json:"updatedAt"`
+}
+
+// SigningKey is a key pair tokens are signed with. The private key is stored as PKCS #8,
+// encrypted with Config.Auth.JWTSecret. Retired keys no longer sign but keep verifying
+// tokens during the grace period.
+type SigningKey struct {
+	ID         uint       `gorm:"primarykey" json:"id"`
+	KeyID      string     `gorm:"unique;type:varchar(64)" json:"keyId"`
+	Algorithm  string     `gorm:"type:varchar(16)" json:"algorithm"`
+	PrivateKey string     `gorm:"type:text" json:"-"`
+	RetiredAt  *time.Time `gorm:"type:timestamp" json:"retiredAt"`
+	CreatedAt  time.Time  `gorm:"type:timestamp" json:"createdAt"`
+	UpdatedAt  time.Time  `gorm:"type:timestamp" json:"updatedAt"`
+}
+
+// Session is a signed in device. It is identified by the refresh token family, which the
+// access tokens refer to in their "sid" claim, and ends when the family is revoked or expires.
+type Session struct {
+	ID         uint       `gorm:"primarykey" json:"id"`
+	UserID     uint       `gorm:"type:integer;index" json:"userId"`
+	FamilyID   string     `gorm:"unique;type:varchar(64)" json:"-"`
+	Device     string     `gorm:"type:varchar(255)" json:"device"`
+	UserAgent  string     `gorm:"type:varchar(512)" json:"userAgent"`
+	IPAddress  string     `gorm:"type:varchar(64)" json:"ipAddress"`
+	LastSeenAt time.Time  `gorm:"type:timestamp" json:"lastSeenAt"`
+	ExpiresAt  time.Time  `gorm:"type:timestamp" json:"expiresAt"`
+	RevokedAt  *time.Time `gorm:"type:timestamp" json:"revokedAt"`
+	CreatedAt  time.Time  `gorm:"type:timestamp" json:"createdAt"`
+	UpdatedAt  time.Time  `gorm:"type:timestamp" json:"updatedAt"`
+}
+
+// PasskeyCredential is a WebAuthn credential registered by a user. UserHandle is the random user
+// handle the authenticator stores along with the credential, it's the same for all credentials of a user.
+type PasskeyCredential struct {
+	ID              uint                        `gorm:"primarykey" json:"id"`
+	UserID          uint                        `gorm:"type:integer;index" json:"userId"`
+	Name            string                      `gorm:"type:varchar(255)" json:"name"`
+	CredentialID    string                      `gorm:"unique;type:varchar(1400)" json:"-"`
+	UserHandle      string                      `gorm:"type:varchar(128);index" json:"-"`
+	PublicKey       []byte                      `gorm:"type:bytea" json:"-"`
+	AttestationType string                      `gorm:"type:varchar(32)" json:"-"`
+	Transports      datatypes.JSONSlice[string] `gorm:"type:jsonb;not null" json:"transports"`
+	AAGUID          []byte                      `gorm:"type:bytea" json:"-"`
+	SignCount       uint32                      `gorm:"type:bigint;not null;default:0" json:"-"`
+	BackupEligible  bool                        `gorm:"not null;default:false" json:"backupEligible"`
+	BackupState     bool                        `gorm:"not null;default:false" json:"backupState"`
+	LastUsedAt      *time.Time                  `gorm:"type:timestamp" json:"lastUsedAt"`
+	CreatedAt       time.Time                   `gorm:"type:timestamp" json:"createdAt"`
+	UpdatedAt       time.Time                   `gorm:"type:timestamp" json:"updatedAt"`
+}
+
+type PasskeyPurpose string
+
+const (
+	PasskeyRegistration PasskeyPurpose = "registration"
+	PasskeySignin       PasskeyPurpose = "signin"
+)
+
+// PasskeyChallenge holds the session data of a started passkey ceremony until it's finished, once.
+// UserID is 0 for signins, the user is only known from the credential.
+type PasskeyChallenge struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	UserID    uint           `gorm:"type:integer;index" json:"userId"`
+	Purpose   PasskeyPurpose `gorm:"type:varchar(16);not null" json:"purpose"`
+	TokenHash string         `gorm:"unique;type:varchar(64)" json:"-"`
+	Session   datatypes.JSON `gorm:"type:jsonb;not null" json:"-"`
+	ExpiresAt time.Time      `gorm:"type:timestamp" json:"expiresAt"`
+	CreatedAt time.Time      `gorm:"type:timestamp" json:"createdAt"`
+}
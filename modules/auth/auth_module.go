@@ -1,10 +1,16 @@
-package auth
-
-import "go.uber.org/fx"
-
-// Module exports dependencies for the user module
-var Module = fx.Module("auth",
-	fx.Provide(NewAuthService),
-	fx.Provide(NewAuthController),
-	fx.Provide(NewAuthMiddleware),
-)
+package auth
+
+import "go.uber.org/fx"
+
+// Module exports dependencies for the user module
+var Module = fx.Module("auth",
+	fx.Provide(NewAuthService),
+	fx.Provide(NewSessionRevoker),
+	fx.Provide(NewAuthController),
+	fx.Provide(NewAuthMiddleware),
+	fx.Provide(NewDatabaseRevocationStore),
+	fx.Provide(NewKeyManager),
+	fx.Provide(NewDatabaseAuditLogger),
+	fx.Provide(NewSessionService),
+	fx.Provide(NewSessionController),
+)
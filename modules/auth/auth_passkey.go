@@ -0,0 +1,359 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/irvanherz/gourze/modules/auth/dto"
+	"github.com/irvanherz/gourze/modules/user"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+const passkeyChallengeTTL = 5 * time.Minute
+
+var (
+	ErrInvalidPasskey = errors.New("invalid passkey")
+	ErrPasskeyCloned  = errors.New("passkey signature counter went backwards, the authenticator may have been cloned")
+)
+
+// passkeyUser adapts a user and their passkeys to webauthn.User
+type passkeyUser struct {
+	user        user.User
+	handle      []byte
+	credentials []PasskeyCredential
+}
+
+func (u *passkeyUser) WebAuthnID() []byte {
+	return u.handle
+}
+
+func (u *passkeyUser) WebAuthnName() string {
+	return u.user.Email
+}
+
+func (u *passkeyUser) WebAuthnDisplayName() string {
+	if u.user.FullName == "" {
+		return u.user.Email
+	}
+	return u.user.FullName
+}
+
+func (u *passkeyUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, 0, len(u.credentials))
+	for _, stored := range u.credentials {
+		credentialID, err := base64.RawURLEncoding.DecodeString(stored.CredentialID)
+		if err != nil {
+			continue
+		}
+		transports := make([]protocol.AuthenticatorTransport, 0, len(stored.Transports))
+		for _, transport := range stored.Transports {
+			transports = append(transports, protocol.AuthenticatorTransport(transport))
+		}
+		credentials = append(credentials, webauthn.Credential{
+			ID:              credentialID,
+			PublicKey:       stored.PublicKey,
+			AttestationType: stored.AttestationType,
+			Transport:       transports,
+			// Passkeys are only registered with user verification
+			Flags: webauthn.CredentialFlags{
+				UserPresent:    true,
+				UserVerified:   true,
+				BackupEligible: stored.BackupEligible,
+				BackupState:    stored.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{AAGUID: stored.AAGUID, SignCount: stored.SignCount},
+		})
+	}
+	return credentials
+}
+
+// BeginPasskeyRegistration implements AuthService. The options ask for a discoverable credential
+// verifying the user, and exclude the authenticators the user already registered.
+func (s *authService) BeginPasskeyRegistration(userID uint) (*dto.AuthPasskeyOptionsDto, error) {
+	passkeyUser, err := s.loadPasskeyUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(passkeyUser.handle) == 0 {
+		passkeyUser.handle = make([]byte, 32)
+		if _, err := rand.Read(passkeyUser.handle); err != nil {
+			return nil, err
+		}
+	}
+
+	w, err := s.webAuthn()
+	if err != nil {
+		return nil, err
+	}
+	exclusions := webauthn.Credentials(passkeyUser.WebAuthnCredentials()).CredentialDescriptors()
+	creation, session, err := w.BeginRegistration(passkeyUser,
+		webauthn.WithAuthenticatorSelection(protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementRequired,
+			UserVerification: protocol.VerificationRequired,
+		}),
+		webauthn.WithExclusions(exclusions),
+	)
+	if err != nil {
+		return nil, err
+	}
+	challengeID, err := s.storePasskeyChallenge(userID, PasskeyRegistration, session)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.AuthPasskeyOptionsDto{ChallengeID: challengeID, Options: creation}, nil
+}
+
+// FinishPasskeyRegistration implements AuthService. Attestation statements aren't verified against
+// authenticator metadata, any authenticator the browser accepts can be registered.
+func (s *authService) FinishPasskeyRegistration(userID uint, input dto.AuthPasskeyRegisterInput) (*PasskeyCredential, error) {
+	session, err := s.consumePasskeyChallenge(input.ChallengeID, PasskeyRegistration, userID)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(input.Credential)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPasskey, err)
+	}
+	passkeyUser, err := s.loadPasskeyUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	// A user's first passkey gets the handle picked when the registration began
+	passkeyUser.handle = session.UserID
+
+	w, err := s.webAuthn()
+	if err != nil {
+		return nil, err
+	}
+	credential, err := w.CreateCredential(passkeyUser, *session, parsed)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPasskey, err)
+	}
+
+	credentialID := base64.RawURLEncoding.EncodeToString(credential.ID)
+	var count int64
+	if err := s.Db.Model(&PasskeyCredential{}).Where("credential_id = ?", credentialID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, fmt.Errorf("%w: the passkey is already registered", ErrInvalidPasskey)
+	}
+
+	transports := make(datatypes.JSONSlice[string], 0, len(credential.Transport))
+	for _, transport := range credential.Transport {
+		transports = append(transports, string(transport))
+	}
+	name := input.Name
+	if name == "" {
+		name = "Passkey"
+	}
+	passkey := PasskeyCredential{
+		UserID:          userID,
+		Name:            name,
+		CredentialID:    credentialID,
+		UserHandle:      base64.RawURLEncoding.EncodeToString(passkeyUser.handle),
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transports:      transports,
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+	}
+	if err := s.Db.Create(&passkey).Error; err != nil {
+		return nil, err
+	}
+	return &passkey, nil
+}
+
+func (s *authService) FindManyPasskeys(userID uint) ([]PasskeyCredential, error) {
+	var passkeys []PasskeyCredential
+	if err := s.Db.Where("user_id = ?", userID).Order("id asc").Find(&passkeys).Error; err != nil {
+		return nil, err
+	}
+	return passkeys, nil
+}
+
+// DeletePasskey implements AuthService. Passkeys of other users are reported as not found.
+func (s *authService) DeletePasskey(userID, id uint) error {
+	result := s.Db.Where("id = ? AND user_id = ?", id, userID).Delete(&PasskeyCredential{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// BeginPasskeySignin implements AuthService. The options don't list credentials, the browser
+// offers the passkeys it holds for the relying party.
+func (s *authService) BeginPasskeySignin() (*dto.AuthPasskeyOptionsDto, error) {
+	w, err := s.webAuthn()
+	if err != nil {
+		return nil, err
+	}
+	assertion, session, err := w.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		return nil, err
+	}
+	challengeID, err := s.storePasskeyChallenge(0, PasskeySignin, session)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.AuthPasskeyOptionsDto{ChallengeID: challengeID, Options: assertion}, nil
+}
+
+// FinishPasskeySignin implements AuthService. A passkey proves possession and user verification
+// at once, so accounts with a second factor aren't challenged for it.
+func (s *authService) FinishPasskeySignin(input dto.AuthPasskeySigninInput) (*dto.AuthResultDto, error) {
+	session, err := s.consumePasskeyChallenge(input.ChallengeID, PasskeySignin, 0)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(input.Credential)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPasskey, err)
+	}
+
+	var stored PasskeyCredential
+	var signedIn *passkeyUser
+	handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+		err := s.Db.Where("credential_id = ?", base64.RawURLEncoding.EncodeToString(rawID)).First(&stored).Error
+		if err != nil {
+			return nil, err
+		}
+		if stored.UserHandle != base64.RawURLEncoding.EncodeToString(userHandle) {
+			return nil, errors.New("user handle doesn't match the credential")
+		}
+		signedIn, err = s.loadPasskeyUser(stored.UserID)
+		return signedIn, err
+	}
+
+	w, err := s.webAuthn()
+	if err != nil {
+		return nil, err
+	}
+	_, credential, err := w.ValidatePasskeyLogin(handler, *session, parsed)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPasskey, err)
+	}
+	if credential.Authenticator.CloneWarning {
+		return nil, ErrPasskeyCloned
+	}
+
+	// The counter only moves forward, a concurrent signin with the same counter loses
+	result := s.Db.Model(&PasskeyCredential{}).
+		Where("id = ? AND sign_count = ?", stored.ID, stored.SignCount).
+		Updates(map[string]interface{}{
+			"sign_count":   credential.Authenticator.SignCount,
+			"backup_state": credential.Flags.BackupState,
+			"last_used_at": time.Now(),
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrPasskeyCloned
+	}
+	return s.startSession(signedIn.user)
+}
+
+// loadPasskeyUser loads a user with their passkeys, handle is empty until the first passkey is registered
+func (s *authService) loadPasskeyUser(userID uint) (*passkeyUser, error) {
+	var passkeyUser passkeyUser
+	if err := s.Db.First(&passkeyUser.user, userID).Error; err != nil {
+		return nil, err
+	}
+	credentials, err := s.FindManyPasskeys(userID)
+	if err != nil {
+		return nil, err
+	}
+	passkeyUser.credentials = credentials
+	if len(credentials) > 0 {
+		if passkeyUser.handle, err = base64.RawURLEncoding.DecodeString(credentials[0].UserHandle); err != nil {
+			return nil, err
+		}
+	}
+	return &passkeyUser, nil
+}
+
+// storePasskeyChallenge persists the session data of a ceremony and returns the ID to finish it with
+func (s *authService) storePasskeyChallenge(userID uint, purpose PasskeyPurpose, session *webauthn.SessionData) (string, error) {
+	challengeID, err := generateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	sessionJson, err := json.Marshal(session)
+	if err != nil {
+		return "", err
+	}
+	challenge := PasskeyChallenge{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: hashToken(challengeID),
+		Session:   datatypes.JSON(sessionJson),
+		ExpiresAt: time.Now().Add(passkeyChallengeTTL),
+	}
+	if err := s.Db.Create(&challenge).Error; err != nil {
+		return "", err
+	}
+	return challengeID, nil
+}
+
+// consumePasskeyChallenge deletes the challenge so a ceremony can only be finished once, whatever its outcome
+func (s *authService) consumePasskeyChallenge(challengeID string, purpose PasskeyPurpose, userID uint) (*webauthn.SessionData, error) {
+	var challenge PasskeyChallenge
+	err := s.Db.Where("token_hash = ? AND purpose = ? AND user_id = ?", hashToken(challengeID), purpose, userID).First(&challenge).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+	result := s.Db.Delete(&PasskeyChallenge{}, challenge.ID)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 || time.Now().After(challenge.ExpiresAt) {
+		return nil, ErrInvalidToken
+	}
+	var session webauthn.SessionData
+	if err := json.Unmarshal(challenge.Session, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// webAuthn configures the relying party, which defaults to the frontend
+func (s *authService) webAuthn() (*webauthn.WebAuthn, error) {
+	rpID := s.Config.Auth.PasskeyRPID
+	if rpID == "" {
+		frontendURL, err := url.Parse(s.Config.App.FrontendURL)
+		if err != nil {
+			return nil, err
+		}
+		rpID = frontendURL.Hostname()
+	}
+	origins := s.Config.Auth.PasskeyOrigins
+	if len(origins) == 0 {
+		origins = []string{s.Config.App.FrontendURL}
+	}
+	rpName := s.Config.Auth.PasskeyRPName
+	if rpName == "" {
+		rpName = "Gourze"
+	}
+	return webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: rpName,
+		RPOrigins:     origins,
+	})
+}
@@ -0,0 +1,249 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/irvanherz/gourze/modules/auth/dto"
+	"github.com/irvanherz/gourze/modules/user"
+	"gorm.io/gorm"
+)
+
+const passkeyTestOrigin = "https://gourze.test"
+
+// softAuthenticator is a software passkey authenticator holding a single P-256 credential
+type softAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	counter      uint32
+	origin       string
+}
+
+func newSoftAuthenticator(origin string) *softAuthenticator {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	credentialID := make([]byte, 16)
+	rand.Read(credentialID)
+	return &softAuthenticator{key: key, credentialID: credentialID, origin: origin}
+}
+
+// passkeyTestOptions is the part of the ceremony options the authenticator needs
+type passkeyTestOptions struct {
+	PublicKey struct {
+		Challenge string `json:"challenge"`
+		RPID      string `json:"rpId"`
+		RP        struct {
+			ID string `json:"id"`
+		} `json:"rp"`
+		User struct {
+			ID string `json:"id"`
+		} `json:"user"`
+	} `json:"publicKey"`
+}
+
+func parsePasskeyTestOptions(options interface{}) passkeyTestOptions {
+	var parsed passkeyTestOptions
+	raw, _ := json.Marshal(options)
+	json.Unmarshal(raw, &parsed)
+	return parsed
+}
+
+// create answers navigator.credentials.create() with a "none" attestation
+func (a *softAuthenticator) create(options interface{}) json.RawMessage {
+	parsed := parsePasskeyTestOptions(options)
+	a.userHandle, _ = base64.RawURLEncoding.DecodeString(parsed.PublicKey.User.ID)
+	clientDataJSON, _ := json.Marshal(map[string]string{"type": "webauthn.create", "challenge": parsed.PublicKey.Challenge, "origin": a.origin})
+
+	publicKey, _ := a.key.PublicKey.ECDH()
+	point := publicKey.Bytes()
+	coseKey, _ := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{KeyType: int64(webauthncose.EllipticKey), Algorithm: int64(webauthncose.AlgES256)},
+		Curve:         int64(webauthncose.P256),
+		XCoord:        point[1:33],
+		YCoord:        point[33:],
+	})
+	// Flags: user present, user verified, attested credential data included
+	authData := a.authenticatorData(parsed.PublicKey.RP.ID, 0x45)
+	authData = append(authData, make([]byte, 16)...) // AAGUID
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.credentialID)))
+	authData = append(authData, a.credentialID...)
+	authData = append(authData, coseKey...)
+	attestationObject, _ := webauthncbor.Marshal(map[string]interface{}{"fmt": "none", "attStmt": map[string]interface{}{}, "authData": authData})
+
+	credential, _ := json.Marshal(map[string]interface{}{
+		"id":    base64.RawURLEncoding.EncodeToString(a.credentialID),
+		"rawId": base64.RawURLEncoding.EncodeToString(a.credentialID),
+		"type":  "public-key",
+		"response": map[string]interface{}{
+			"clientDataJSON":    base64.RawURLEncoding.EncodeToString(clientDataJSON),
+			"attestationObject": base64.RawURLEncoding.EncodeToString(attestationObject),
+			"transports":        []string{"internal"},
+		},
+	})
+	return credential
+}
+
+// get answers navigator.credentials.get(), incrementing the signature counter
+func (a *softAuthenticator) get(options interface{}) json.RawMessage {
+	parsed := parsePasskeyTestOptions(options)
+	clientDataJSON, _ := json.Marshal(map[string]string{"type": "webauthn.get", "challenge": parsed.PublicKey.Challenge, "origin": a.origin})
+	a.counter++
+	// Flags: user present, user verified
+	authData := a.authenticatorData(parsed.PublicKey.RPID, 0x05)
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, _ := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+
+	credential, _ := json.Marshal(map[string]interface{}{
+		"id":    base64.RawURLEncoding.EncodeToString(a.credentialID),
+		"rawId": base64.RawURLEncoding.EncodeToString(a.credentialID),
+		"type":  "public-key",
+		"response": map[string]interface{}{
+			"clientDataJSON":    base64.RawURLEncoding.EncodeToString(clientDataJSON),
+			"authenticatorData": base64.RawURLEncoding.EncodeToString(authData),
+			"signature":         base64.RawURLEncoding.EncodeToString(signature),
+			"userHandle":        base64.RawURLEncoding.EncodeToString(a.userHandle),
+		},
+	})
+	return credential
+}
+
+func (a *softAuthenticator) authenticatorData(rpID string, flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	authData := append(rpIDHash[:], flags)
+	return binary.BigEndian.AppendUint32(authData, a.counter)
+}
+
+// registerPasskey creates a user with a passkey held by the returned authenticator
+func (suite *AuthServiceTestSuite) registerPasskey(username string) (user.User, *softAuthenticator) {
+	suite.config.App.FrontendURL = passkeyTestOrigin
+	account := user.User{Username: username, Email: username + "@doe.com", FullName: "John Doe"}
+	suite.db.Create(&account)
+
+	authenticator := newSoftAuthenticator(passkeyTestOrigin)
+	options, err := suite.service.BeginPasskeyRegistration(account.ID)
+	suite.Require().NoError(err)
+	passkey, err := suite.service.FinishPasskeyRegistration(account.ID, dto.AuthPasskeyRegisterInput{
+		ChallengeID: options.ChallengeID,
+		Name:        "Laptop",
+		Credential:  authenticator.create(options.Options),
+	})
+	suite.Require().NoError(err)
+	suite.Equal("Laptop", passkey.Name)
+	return account, authenticator
+}
+
+func (suite *AuthServiceTestSuite) signinWithPasskey(authenticator *softAuthenticator) (*dto.AuthResultDto, error) {
+	options, err := suite.service.BeginPasskeySignin()
+	suite.Require().NoError(err)
+	return suite.service.FinishPasskeySignin(dto.AuthPasskeySigninInput{ChallengeID: options.ChallengeID, Credential: authenticator.get(options.Options)})
+}
+
+func (suite *AuthServiceTestSuite) TestPasskey_RegisterAndSignin() {
+	account, authenticator := suite.registerPasskey("john_doe")
+	// A passkey is a second factor in itself
+	suite.db.Create(&TwoFactorCredential{UserID: account.ID, Secret: "JBSWY3DPEHPK3PXP", EnabledAt: &time.Time{}})
+
+	passkeys, err := suite.service.FindManyPasskeys(account.ID)
+	suite.NoError(err)
+	suite.Len(passkeys, 1)
+	suite.Equal([]string{"internal"}, []string(passkeys[0].Transports))
+
+	result, err := suite.signinWithPasskey(authenticator)
+	suite.NoError(err)
+	suite.NotEmpty(result.AccessToken)
+	suite.False(result.TwoFactorRequired)
+	suite.Equal(account.ID, result.User.ID)
+
+	var stored PasskeyCredential
+	suite.db.First(&stored, passkeys[0].ID)
+	suite.Equal(uint32(1), stored.SignCount)
+	suite.NotNil(stored.LastUsedAt)
+
+	// The second passkey of a user shares the user handle of the first one
+	second := newSoftAuthenticator(passkeyTestOrigin)
+	options, _ := suite.service.BeginPasskeyRegistration(account.ID)
+	_, err = suite.service.FinishPasskeyRegistration(account.ID, dto.AuthPasskeyRegisterInput{ChallengeID: options.ChallengeID, Credential: second.create(options.Options)})
+	suite.NoError(err)
+	suite.Equal(authenticator.userHandle, second.userHandle)
+	_, err = suite.signinWithPasskey(second)
+	suite.NoError(err)
+}
+
+func (suite *AuthServiceTestSuite) TestPasskey_ChallengeIsSingleUse() {
+	account, authenticator := suite.registerPasskey("john_doe")
+
+	options, _ := suite.service.BeginPasskeySignin()
+	input := dto.AuthPasskeySigninInput{ChallengeID: options.ChallengeID, Credential: authenticator.get(options.Options)}
+	_, err := suite.service.FinishPasskeySignin(input)
+	suite.NoError(err)
+	_, err = suite.service.FinishPasskeySignin(input)
+	suite.ErrorIs(err, ErrInvalidToken)
+
+	// Registration challenges are bound to the user who started them
+	other := user.User{Username: "jane_doe", Email: "jane@doe.com"}
+	suite.db.Create(&other)
+	registration, _ := suite.service.BeginPasskeyRegistration(account.ID)
+	_, err = suite.service.FinishPasskeyRegistration(other.ID, dto.AuthPasskeyRegisterInput{
+		ChallengeID: registration.ChallengeID,
+		Credential:  newSoftAuthenticator(passkeyTestOrigin).create(registration.Options),
+	})
+	suite.ErrorIs(err, ErrInvalidToken)
+
+	expired, _ := suite.service.BeginPasskeySignin()
+	suite.db.Model(&PasskeyChallenge{}).Where("purpose = ?", PasskeySignin).Update("expires_at", time.Now().Add(-time.Minute))
+	_, err = suite.service.FinishPasskeySignin(dto.AuthPasskeySigninInput{ChallengeID: expired.ChallengeID, Credential: authenticator.get(expired.Options)})
+	suite.ErrorIs(err, ErrInvalidToken)
+}
+
+func (suite *AuthServiceTestSuite) TestPasskey_SignCountGoingBackwards() {
+	_, authenticator := suite.registerPasskey("john_doe")
+
+	_, err := suite.signinWithPasskey(authenticator)
+	suite.NoError(err)
+	_, err = suite.signinWithPasskey(authenticator)
+	suite.NoError(err)
+
+	// A clone of the authenticator still at the first signin
+	authenticator.counter = 0
+	_, err = suite.signinWithPasskey(authenticator)
+	suite.ErrorIs(err, ErrPasskeyCloned)
+}
+
+func (suite *AuthServiceTestSuite) TestPasskey_InvalidAssertion() {
+	_, authenticator := suite.registerPasskey("john_doe")
+
+	phishing := *authenticator
+	phishing.origin = "https://gourze.evil"
+	_, err := suite.signinWithPasskey(&phishing)
+	suite.ErrorIs(err, ErrInvalidPasskey)
+
+	// An assertion signed for another challenge
+	first, _ := suite.service.BeginPasskeySignin()
+	second, _ := suite.service.BeginPasskeySignin()
+	_, err = suite.service.FinishPasskeySignin(dto.AuthPasskeySigninInput{ChallengeID: second.ChallengeID, Credential: authenticator.get(first.Options)})
+	suite.ErrorIs(err, ErrInvalidPasskey)
+
+	_, err = suite.signinWithPasskey(newSoftAuthenticator(passkeyTestOrigin))
+	suite.ErrorIs(err, ErrInvalidPasskey)
+}
+
+func (suite *AuthServiceTestSuite) TestPasskey_Delete() {
+	account, authenticator := suite.registerPasskey("john_doe")
+	other, _ := suite.registerPasskey("jane_doe")
+	passkeys, _ := suite.service.FindManyPasskeys(account.ID)
+
+	suite.ErrorIs(suite.service.DeletePasskey(other.ID, passkeys[0].ID), gorm.ErrRecordNotFound)
+	suite.NoError(suite.service.DeletePasskey(account.ID, passkeys[0].ID))
+
+	_, err := suite.signinWithPasskey(authenticator)
+	suite.ErrorIs(err, ErrInvalidPasskey)
+}
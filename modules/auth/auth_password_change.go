@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/irvanherz/gourze/modules/auth/dto"
+	"github.com/irvanherz/gourze/modules/password"
+	"github.com/irvanherz/gourze/modules/user"
+	"github.com/jinzhu/copier"
+)
+
+const passwordChangeChallengeTTL = 10 * time.Minute
+
+// ChangePassword implements AuthService. It is used by signed in users, or with the challenge token
+// of a signin that requires a password change. Every session is signed out and a new one is started.
+func (s *authService) ChangePassword(input dto.AuthChangePasswordInput, userID uint) (*dto.AuthResultDto, error) {
+	if userID == 0 {
+		claims, err := parseClaims(s.Config, s.KeyManager, input.ChallengeToken, passwordChangeType)
+		if err != nil {
+			return nil, err
+		}
+		if userID, err = claims.UserID(); err != nil {
+			return nil, err
+		}
+	}
+	var user user.User
+	if err := s.Db.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	if err := s.confirmPassword(user, input.CurrentPassword); err != nil {
+		return nil, err
+	}
+
+	if input.NewPassword == input.CurrentPassword {
+		return nil, fmt.Errorf("%w: it must differ from the current password", password.ErrWeakPassword)
+	}
+	if err := s.PasswordPolicy.Validate(input.NewPassword, user.Username, user.Email); err != nil {
+		return nil, err
+	}
+	hashedPassword, err := s.HashPassword(input.NewPassword)
+	if err != nil {
+		return nil, err
+	}
+	err = s.Db.Model(&user).Updates(map[string]interface{}{"password": hashedPassword, "password_change_required": false}).Error
+	if err != nil {
+		return nil, err
+	}
+	if err := s.revokeSessions(user.ID); err != nil {
+		return nil, err
+	}
+	user.PasswordChangeRequired = false
+	return s.startSession(user)
+}
+
+// passwordChangeChallenge returns the partial signin result of users who must change their password
+func (s *authService) passwordChangeChallenge(user user.User) (*dto.AuthResultDto, error) {
+	now := time.Now()
+	challengeToken, err := signClaims(s.Config, s.KeyManager, &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.FormatUint(uint64(user.ID), 10),
+			ExpiresAt: jwt.NewNumericDate(now.Add(passwordChangeChallengeTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+		Type: passwordChangeType,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var authUser dto.AuthUser
+	copier.Copy(&authUser, &user)
+	return &dto.AuthResultDto{
+		User:                   authUser,
+		PasswordChangeRequired: true,
+		ChallengeToken:         challengeToken,
+	}, nil
+}
+
+// ConfirmPassword implements AuthService. Sensitive changes of signed in users are confirmed with it.
+func (s *authService) ConfirmPassword(userID uint, currentPassword string) error {
+	var user user.User
+	if err := s.Db.First(&user, userID).Error; err != nil {
+		return err
+	}
+	return s.confirmPassword(user, currentPassword)
+}
+
+// confirmPassword checks the current password of user, guesses count towards the signin lockout
+func (s *authService) confirmPassword(user user.User, currentPassword string) error {
+	accountKey := signinThrottleKey("user", user.ID)
+	if err := s.checkSigninThrottle(accountKey); err != nil {
+		return err
+	}
+	if err := s.CompareHashAndPassword(user.Password, currentPassword); err != nil {
+		if err := s.recordSigninFailure(accountKey, s.signinMaxAttempts()); err != nil {
+			return err
+		}
+		return ErrInvalidCredentials
+	}
+	return s.resetSigninThrottle(accountKey)
+}
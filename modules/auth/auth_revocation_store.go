@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RevocationStore keeps track of access tokens that must no longer be accepted
+// even though their signature and expiry are still valid.
+type RevocationStore interface {
+	// RevokeToken revokes a single access token by its jti claim until it expires
+	RevokeToken(tokenID string, expiresAt time.Time) error
+	// RevokeUserTokens revokes every access token of a user issued before issuedBefore. Tokens carry
+	// their issue time in whole seconds, so the comparison is made to the second and tokens issued in
+	// the same second stay valid, letting the user sign in again right away.
+	RevokeUserTokens(userID uint, issuedBefore time.Time) error
+	IsRevoked(tokenID string, userID uint, issuedAt time.Time) (bool, error)
+}
+
+// RevokedToken is a revoked access token, kept until the token would have expired anyway
+type RevokedToken struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	TokenID   string    `gorm:"unique;type:varchar(64)" json:"tokenId"`
+	ExpiresAt time.Time `gorm:"type:timestamp;index" json:"expiresAt"`
+	CreatedAt time.Time `gorm:"type:timestamp" json:"createdAt"`
+}
+
+// UserTokenRevocation invalidates all access tokens of a user issued up to RevokedBefore
+type UserTokenRevocation struct {
+	UserID        uint      `gorm:"primarykey;autoIncrement:false" json:"userId"`
+	RevokedBefore time.Time `gorm:"type:timestamp" json:"revokedBefore"`
+	UpdatedAt     time.Time `gorm:"type:timestamp" json:"updatedAt"`
+}
+
+type databaseRevocationStore struct {
+	Db *gorm.DB
+}
+
+// NewDatabaseRevocationStore returns a RevocationStore persisted through GORM (Postgres in production)
+func NewDatabaseRevocationStore(db *gorm.DB) RevocationStore {
+	return &databaseRevocationStore{Db: db}
+}
+
+func (s *databaseRevocationStore) RevokeToken(tokenID string, expiresAt time.Time) error {
+	if tokenID == "" {
+		return nil
+	}
+	// Drop entries for tokens that have expired on their own
+	if err := s.Db.Where("expires_at < ?", time.Now()).Delete(&RevokedToken{}).Error; err != nil {
+		return err
+	}
+	revokedToken := RevokedToken{TokenID: tokenID, ExpiresAt: expiresAt}
+	return s.Db.Clauses(clause.OnConflict{DoNothing: true}).Create(&revokedToken).Error
+}
+
+func (s *databaseRevocationStore) RevokeUserTokens(userID uint, issuedBefore time.Time) error {
+	revocation := UserTokenRevocation{UserID: userID, RevokedBefore: issuedBefore.Truncate(time.Second)}
+	return s.Db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"revoked_before", "updated_at"}),
+	}).Create(&revocation).Error
+}
+
+func (s *databaseRevocationStore) IsRevoked(tokenID string, userID uint, issuedAt time.Time) (bool, error) {
+	var count int64
+	if tokenID != "" {
+		if err := s.Db.Model(&RevokedToken{}).Where("token_id = ?", tokenID).Count(&count).Error; err != nil {
+			return false, err
+		}
+		if count > 0 {
+			return true, nil
+		}
+	}
+	if err := s.Db.Model(&UserTokenRevocation{}).
+		Where("user_id = ? AND revoked_before > ?", userID, issuedAt.Truncate(time.Second)).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+type memoryRevocationStore struct {
+	mu     sync.RWMutex
+	tokens map[string]time.Time
+	users  map[uint]time.Time
+}
+
+// NewMemoryRevocationStore returns an in-process RevocationStore, useful for tests and single instance setups
+func NewMemoryRevocationStore() RevocationStore {
+	return &memoryRevocationStore{
+		tokens: map[string]time.Time{},
+		users:  map[uint]time.Time{},
+	}
+}
+
+func (s *memoryRevocationStore) RevokeToken(tokenID string, expiresAt time.Time) error {
+	if tokenID == "" {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for id, exp := range s.tokens {
+		if exp.Before(now) {
+			delete(s.tokens, id)
+		}
+	}
+	s.tokens[tokenID] = expiresAt
+	return nil
+}
+
+func (s *memoryRevocationStore) RevokeUserTokens(userID uint, issuedBefore time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[userID] = issuedBefore.Truncate(time.Second)
+	return nil
+}
+
+func (s *memoryRevocationStore) IsRevoked(tokenID string, userID uint, issuedAt time.Time) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if _, ok := s.tokens[tokenID]; ok && tokenID != "" {
+		return true, nil
+	}
+	if revokedBefore, ok := s.users[userID]; ok && revokedBefore.After(issuedAt.Truncate(time.Second)) {
+		return true, nil
+	}
+	return false, nil
+}
@@ -1,114 +1,591 @@
-package auth
-
-import (
-	"time"
-
-	"github.com/golang-jwt/jwt/v5"
-	"github.com/irvanherz/gourze/config"
-	"github.com/irvanherz/gourze/modules/auth/dto"
-	"github.com/irvanherz/gourze/modules/user"
-	"github.com/jinzhu/copier"
-	"golang.org/x/crypto/bcrypt"
-	"gorm.io/gorm"
-)
-
-type AuthService interface {
-	Signin(input dto.AuthSigninInput) (*dto.AuthResultDto, error)
-	Signup(input dto.AuthSignupInput) (*dto.AuthResultDto, error)
-	HashPassword(password string) (string, error)
-	CompareHashAndPassword(hashedPassword, password string) error
-	GenerateAccessToken(user user.User) (string, error)
-	GenerateRefreshToken(user user.User) (string, error)
-}
-
-type authService struct {
-	Db     *gorm.DB
-	Config *config.Config
-}
-
-// GenerateAccessToken implements AuthService.
-func (s *authService) GenerateAccessToken(user user.User) (string, error) {
-	jwtSecret := s.Config.Auth.JWTSecret
-	claims := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"sub": user.ID,                          // Subject (user identifier)
-		"iss": "gourze",                         // Issuer
-		"aud": user.Role,                        // Audience (user role)
-		"exp": time.Now().Add(time.Hour).Unix(), // Expiration time
-		"iat": time.Now().Unix(),                // Issued at
-	})
-	tokenString, err := claims.SignedString([]byte(jwtSecret))
-	return tokenString, err
-}
-
-// GenerateRefreshToken implements AuthService.
-func (s *authService) GenerateRefreshToken(user user.User) (string, error) {
-	panic("unimplemented")
-}
-
-// Signin implements AuthService.
-func (s *authService) Signin(input dto.AuthSigninInput) (*dto.AuthResultDto, error) {
-	// get user
-	var user user.User
-	if err := s.Db.Where("email = ? OR username = ?", input.UsernameOrEmail, input.UsernameOrEmail).First(&user).Error; err != nil {
-		return nil, err
-	}
-	if err := s.CompareHashAndPassword(user.Password, input.Password); err != nil {
-		return nil, err
-	}
-	accessToken, err := s.GenerateAccessToken(user)
-	if err != nil {
-		return nil, err
-	}
-
-	var authUser dto.AuthUser
-	copier.Copy(&authUser, &user)
-	return &dto.AuthResultDto{
-		AccessToken:          accessToken,
-		RefreshToken:         "",
-		AccessTokenExpiredAt: time.Now().Add(time.Hour).Unix(),
-		User:                 authUser,
-	}, nil
-}
-
-func (s *authService) Signup(input dto.AuthSignupInput) (*dto.AuthResultDto, error) {
-	var user user.User
-	copier.Copy(&user, &input)
-	// userMeta, _ := json.Marshal(map[string]interface{}{})
-	// user.Meta = datatypes.JSON(userMeta)
-	hashedPassword, err := s.HashPassword(input.Password)
-	if err != nil {
-		return nil, err
-	}
-	user.Password = hashedPassword
-
-	if err := s.Db.Create(&user).Error; err != nil {
-		return nil, err
-	}
-
-	accessToken, err := s.GenerateAccessToken(user)
-	if err != nil {
-		return nil, err
-	}
-
-	var authUser dto.AuthUser
-	copier.Copy(&authUser, &user)
-	return &dto.AuthResultDto{
-		AccessToken:          accessToken,
-		RefreshToken:         "",
-		AccessTokenExpiredAt: 0,
-		User:                 authUser,
-	}, nil
-}
-
-func (s *authService) HashPassword(password string) (string, error) {
-	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	return string(hashedBytes), err
-}
-
-func (s *authService) CompareHashAndPassword(hashedPassword, password string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
-}
-
-func NewAuthService(db *gorm.DB, conf *config.Config) AuthService {
-	return &authService{Db: db, Config: conf}
-}
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/irvanherz/gourze/config"
+	"github.com/irvanherz/gourze/modules/auth/dto"
+	"github.com/irvanherz/gourze/modules/invite"
+	"github.com/irvanherz/gourze/modules/mail"
+	"github.com/irvanherz/gourze/modules/password"
+	"github.com/irvanherz/gourze/modules/rbac"
+	"github.com/irvanherz/gourze/modules/user"
+	"github.com/jinzhu/copier"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidRefreshToken  = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused   = errors.New("refresh token has already been used")
+	ErrInvalidToken         = errors.New("invalid or expired token")
+	ErrEmailAlreadyVerified = errors.New("email is already verified")
+	ErrAccountSuspended     = errors.New("account is suspended")
+)
+
+type AuthService interface {
+	Signin(input dto.AuthSigninInput) (*dto.AuthResultDto, error)
+	Signup(input dto.AuthSignupInput) (*dto.AuthResultDto, error)
+	Refresh(input dto.AuthRefreshTokenInput) (*dto.AuthResultDto, error)
+	Signout(tokenID string, expiresAt time.Time, refreshToken string) error
+	SignoutAll(userID uint) error
+	ForgotPassword(input dto.AuthForgotPasswordInput) error
+	ResetPassword(input dto.AuthResetPasswordInput) error
+	VerifyEmail(input dto.AuthVerifyEmailInput) error
+	ResendEmailVerification(userID uint) error
+	RequestMagicLink(input dto.AuthMagicLinkInput) error
+	ConsumeMagicLink(input dto.AuthMagicLinkConsumeInput) (*dto.AuthResultDto, error)
+	EnrollTwoFactor(input dto.AuthTwoFactorEnrollInput, userID uint) (*dto.AuthTwoFactorEnrollmentDto, error)
+	ActivateTwoFactor(input dto.AuthTwoFactorActivateInput, userID uint) (*dto.AuthTwoFactorActivationDto, error)
+	VerifyTwoFactor(input dto.AuthTwoFactorVerifyInput) (*dto.AuthResultDto, error)
+	DisableTwoFactor(userID uint, input dto.AuthTwoFactorDisableInput) error
+	ChangePassword(input dto.AuthChangePasswordInput, userID uint) (*dto.AuthResultDto, error)
+	ConfirmPassword(userID uint, currentPassword string) error
+	BeginPasskeyRegistration(userID uint) (*dto.AuthPasskeyOptionsDto, error)
+	FinishPasskeyRegistration(userID uint, input dto.AuthPasskeyRegisterInput) (*PasskeyCredential, error)
+	FindManyPasskeys(userID uint) ([]PasskeyCredential, error)
+	DeletePasskey(userID, id uint) error
+	BeginPasskeySignin() (*dto.AuthPasskeyOptionsDto, error)
+	FinishPasskeySignin(input dto.AuthPasskeySigninInput) (*dto.AuthResultDto, error)
+	UnlockUser(userID uint) error
+	Impersonate(actor rbac.Actor, userID uint, ipAddress string) (*dto.AuthImpersonationResultDto, error)
+	IssueTokens(user user.User) (*dto.AuthResultDto, error)
+	HashPassword(password string) (string, error)
+	CompareHashAndPassword(hashedPassword, password string) error
+	GenerateAccessToken(user user.User) (string, error)
+	GenerateRefreshToken(user user.User) (string, error)
+}
+
+type authService struct {
+	Db              *gorm.DB
+	Config          *config.Config
+	RevocationStore RevocationStore
+	Mailer          mail.Mailer
+	KeyManager      KeyManager
+	AuditLogger     AuditLogger
+	PasswordPolicy  password.PasswordPolicy
+	InviteService   invite.InviteService
+}
+
+// GenerateAccessToken implements AuthService. The token isn't bound to a session, signins use startSession.
+func (s *authService) GenerateAccessToken(user user.User) (string, error) {
+	return s.generateAccessToken(user, "")
+}
+
+func (s *authService) generateAccessToken(user user.User, sessionID string) (string, error) {
+	tokenID, err := generateRandomToken(16)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	return signClaims(s.Config, s.KeyManager, &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID, // Token ID, used for revocation
+			Subject:   strconv.FormatUint(uint64(user.ID), 10),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.accessTokenTTL())),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+		Role:      user.Role,
+		SessionID: sessionID,
+		Type:      accessTokenType,
+	})
+}
+
+// GenerateRefreshToken implements AuthService. Every call starts a new token family.
+func (s *authService) GenerateRefreshToken(user user.User) (string, error) {
+	token, _, err := s.newRefreshTokenFamily(user)
+	return token, err
+}
+
+func (s *authService) newRefreshTokenFamily(user user.User) (string, string, error) {
+	familyID, err := generateRandomToken(16)
+	if err != nil {
+		return "", "", err
+	}
+	var token string
+	err = s.Db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		session := Session{UserID: user.ID, FamilyID: familyID, LastSeenAt: now, ExpiresAt: now.Add(s.refreshTokenTTL())}
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+		token, _, err = s.issueRefreshToken(tx, user.ID, familyID)
+		return err
+	})
+	return token, familyID, err
+}
+
+// startSession signs the user in with a new refresh token family, the family is the session
+// the access tokens refer to in their "sid" claim. Users who must change their password only
+// get a challenge token, see ChangePassword.
+func (s *authService) startSession(user user.User) (*dto.AuthResultDto, error) {
+	if err := checkNotSuspended(user); err != nil {
+		return nil, err
+	}
+	if user.PasswordChangeRequired {
+		return s.passwordChangeChallenge(user)
+	}
+	refreshToken, familyID, err := s.newRefreshTokenFamily(user)
+	if err != nil {
+		return nil, err
+	}
+	return s.buildAuthResult(user, refreshToken, familyID)
+}
+
+// Refresh implements AuthService. The presented token is revoked and replaced by a
+// new one from the same family; presenting an already revoked token revokes the family.
+func (s *authService) Refresh(input dto.AuthRefreshTokenInput) (*dto.AuthResultDto, error) {
+	var stored RefreshToken
+	if err := s.Db.Where("token_hash = ?", hashToken(input.RefreshToken)).First(&stored).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+	if stored.RevokedAt != nil {
+		if err := s.revokeRefreshTokenFamily(stored.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+	if time.Now().After(stored.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	var user user.User
+	if err := s.Db.First(&user, stored.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+	if err := checkNotSuspended(user); err != nil {
+		return nil, err
+	}
+
+	var refreshToken string
+	err := s.Db.Transaction(func(tx *gorm.DB) error {
+		// Guard against two concurrent refreshes rotating the same token
+		now := time.Now()
+		result := tx.Model(&RefreshToken{}).
+			Where("id = ? AND revoked_at IS NULL", stored.ID).
+			Update("revoked_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRefreshTokenReused
+		}
+		token, replacement, err := s.issueRefreshToken(tx, user.ID, stored.FamilyID)
+		if err != nil {
+			return err
+		}
+		refreshToken = token
+		if err := tx.Model(&RefreshToken{}).Where("id = ?", stored.ID).Update("replaced_by_id", replacement.ID).Error; err != nil {
+			return err
+		}
+		// The session lives as long as its newest refresh token
+		return tx.Model(&Session{}).Where("family_id = ?", stored.FamilyID).Updates(map[string]interface{}{
+			"last_seen_at": now,
+			"expires_at":   replacement.ExpiresAt,
+		}).Error
+	})
+	if err != nil {
+		if errors.Is(err, ErrRefreshTokenReused) {
+			if err := s.revokeRefreshTokenFamily(stored.FamilyID); err != nil {
+				return nil, err
+			}
+		}
+		return nil, err
+	}
+
+	return s.buildAuthResult(user, refreshToken, stored.FamilyID)
+}
+
+// Signout implements AuthService. It revokes the current access token and, when given,
+// the refresh token family it belongs to.
+func (s *authService) Signout(tokenID string, expiresAt time.Time, refreshToken string) error {
+	if tokenID != "" {
+		if err := s.RevocationStore.RevokeToken(tokenID, expiresAt); err != nil {
+			return err
+		}
+	}
+	if refreshToken == "" {
+		return nil
+	}
+	var stored RefreshToken
+	if err := s.Db.Where("token_hash = ?", hashToken(refreshToken)).First(&stored).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	return s.revokeRefreshTokenFamily(stored.FamilyID)
+}
+
+// SignoutAll implements AuthService. It revokes every access and refresh token issued to the user so far.
+// Access tokens issued earlier in the current second are left to the session check, see RevokeUserTokens.
+func (s *authService) SignoutAll(userID uint) error {
+	if err := s.RevocationStore.RevokeUserTokens(userID, time.Now()); err != nil {
+		return err
+	}
+	return s.revokeSessions(userID)
+}
+
+// revokeSessions revokes every session and refresh token of the user. Access tokens of the
+// sessions are rejected by the middleware, unlike SignoutAll new tokens may be issued right away.
+func (s *authService) revokeSessions(userID uint) error {
+	if err := s.Db.Model(&Session{}).Where("user_id = ? AND revoked_at IS NULL", userID).Update("revoked_at", time.Now()).Error; err != nil {
+		return err
+	}
+	return s.Db.Model(&RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// Signin implements AuthService.
+func (s *authService) Signin(input dto.AuthSigninInput) (*dto.AuthResultDto, error) {
+	// get user
+	var user user.User
+	err := s.Db.Where("email = ? OR username = ?", input.UsernameOrEmail, input.UsernameOrEmail).First(&user).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	accountKey := signinThrottleKey("name", input.UsernameOrEmail)
+	if user.ID != 0 {
+		accountKey = signinThrottleKey("user", user.ID)
+	}
+	ipKey := signinThrottleKey("ip", input.IPAddress)
+	if err := s.checkSigninThrottle(accountKey, ipKey); err != nil {
+		return nil, err
+	}
+
+	// Unknown accounts and wrong passwords must be indistinguishable, in the response and in timing
+	passwordHash := user.Password
+	if user.ID == 0 {
+		passwordHash = string(dummyPasswordHash())
+	}
+	if err := s.CompareHashAndPassword(passwordHash, input.Password); err != nil || user.ID == 0 {
+		if err := s.recordSigninFailure(accountKey, s.signinMaxAttempts()); err != nil {
+			return nil, err
+		}
+		if input.IPAddress != "" {
+			if err := s.recordSigninFailure(ipKey, s.signinIPMaxAttempts()); err != nil {
+				return nil, err
+			}
+		}
+		return nil, ErrInvalidCredentials
+	}
+	if err := s.resetSigninThrottle(accountKey); err != nil {
+		return nil, err
+	}
+	return s.IssueTokens(user)
+}
+
+// IssueTokens implements AuthService. It completes a signin of an already authenticated user,
+// accounts with a second factor only get a challenge token here, see VerifyTwoFactor.
+func (s *authService) IssueTokens(user user.User) (*dto.AuthResultDto, error) {
+	if err := checkNotSuspended(user); err != nil {
+		return nil, err
+	}
+	challenge, err := s.twoFactorChallenge(user)
+	if err != nil || challenge != nil {
+		return challenge, err
+	}
+	return s.startSession(user)
+}
+
+// checkNotSuspended refuses sessions to suspended users, the error tells them why and for how long
+func checkNotSuspended(user user.User) error {
+	if !user.IsSuspended() {
+		return nil
+	}
+	if user.SuspendedUntil != nil {
+		return fmt.Errorf("%w until %s: %s", ErrAccountSuspended, user.SuspendedUntil.Format(time.RFC3339), user.SuspensionReason)
+	}
+	return fmt.Errorf("%w: %s", ErrAccountSuspended, user.SuspensionReason)
+}
+
+// Signup implements AuthService. Config.Auth.SignupMode decides who may sign up, users signing
+// up with an invite code get the role of the invite. Roles requiring two-factor authentication get
+// the enrollment challenge instead of a session, see IssueTokens.
+func (s *authService) Signup(input dto.AuthSignupInput) (*dto.AuthResultDto, error) {
+	if err := CheckSignupAllowed(s.Config, input.Email, input.InviteCode != ""); err != nil {
+		return nil, err
+	}
+	if err := s.PasswordPolicy.Validate(input.Password, input.Username, input.Email); err != nil {
+		return nil, err
+	}
+	var user user.User
+	copier.Copy(&user, &input)
+	// userMeta, _ := json.Marshal(map[string]interface{}{})
+	// user.Meta = datatypes.JSON(userMeta)
+	hashedPassword, err := s.HashPassword(input.Password)
+	if err != nil {
+		return nil, err
+	}
+	user.Password = hashedPassword
+
+	err = s.Db.Transaction(func(tx *gorm.DB) error {
+		if input.InviteCode != "" {
+			redeemed, err := s.InviteService.Redeem(tx, input.InviteCode)
+			if err != nil {
+				return err
+			}
+			user.InviteID = &redeemed.ID
+			user.Role = redeemed.Role
+		}
+		return tx.Create(&user).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	// The account is usable right away, a failed delivery can be retried through the resend endpoint
+	if err := s.sendEmailVerification(user); err != nil {
+		fmt.Println("Failed to send verification email:", err)
+	}
+	return s.IssueTokens(user)
+}
+
+// ForgotPassword implements AuthService. Unknown emails are silently ignored so the
+// endpoint can't be used to find out which addresses are registered.
+func (s *authService) ForgotPassword(input dto.AuthForgotPasswordInput) error {
+	var user user.User
+	if err := s.Db.Where("email = ?", input.Email).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	// Only the most recent reset link stays valid
+	if err := s.invalidateOneTimeTokens(user.ID, PasswordReset); err != nil {
+		return err
+	}
+	token, err := s.issueOneTimeToken(user.ID, PasswordReset, s.passwordResetTTL())
+	if err != nil {
+		return err
+	}
+
+	resetURL := fmt.Sprintf("%s/reset-password?token=%s", s.Config.App.FrontendURL, url.QueryEscape(token))
+	return s.Mailer.Send(mail.Message{
+		To:      []string{user.Email},
+		Subject: "Reset your Gourze password",
+		Body: fmt.Sprintf("Hi %s,\n\nWe received a request to reset your password. Open the link below to choose a new one:\n\n%s\n\nThe link expires in %d minutes. If you didn't ask for this, you can ignore this email.\n",
+			user.FullName, resetURL, int(s.passwordResetTTL().Minutes())),
+	})
+}
+
+// ResetPassword implements AuthService. A successful reset signs the user out everywhere.
+func (s *authService) ResetPassword(input dto.AuthResetPasswordInput) error {
+	hashedPassword, err := s.HashPassword(input.Password)
+	if err != nil {
+		return err
+	}
+
+	var userID uint
+	err = s.Db.Transaction(func(tx *gorm.DB) error {
+		resetToken, err := s.consumeOneTimeToken(tx, input.Token, PasswordReset)
+		if err != nil {
+			return err
+		}
+		userID = resetToken.UserID
+		var resetUser user.User
+		if err := tx.First(&resetUser, userID).Error; err != nil {
+			return err
+		}
+		// Failing here rolls the transaction back, so the link can be used again with a better password
+		if err := s.PasswordPolicy.Validate(input.Password, resetUser.Username, resetUser.Email); err != nil {
+			return err
+		}
+		return tx.Model(&resetUser).Updates(map[string]interface{}{"password": hashedPassword, "password_change_required": false}).Error
+	})
+	if err != nil {
+		return err
+	}
+	return s.SignoutAll(userID)
+}
+
+// VerifyEmail implements AuthService.
+func (s *authService) VerifyEmail(input dto.AuthVerifyEmailInput) error {
+	return s.Db.Transaction(func(tx *gorm.DB) error {
+		verificationToken, err := s.consumeOneTimeToken(tx, input.Token, EmailVerification)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&user.User{}).Where("id = ?", verificationToken.UserID).Update("email_verified_at", time.Now()).Error
+	})
+}
+
+// ResendEmailVerification implements AuthService. Previously sent links stop working.
+func (s *authService) ResendEmailVerification(userID uint) error {
+	var user user.User
+	if err := s.Db.First(&user, userID).Error; err != nil {
+		return err
+	}
+	if user.EmailVerifiedAt != nil {
+		return ErrEmailAlreadyVerified
+	}
+	return s.sendEmailVerification(user)
+}
+
+func (s *authService) sendEmailVerification(user user.User) error {
+	if err := s.invalidateOneTimeTokens(user.ID, EmailVerification); err != nil {
+		return err
+	}
+	token, err := s.issueOneTimeToken(user.ID, EmailVerification, s.emailVerificationTTL())
+	if err != nil {
+		return err
+	}
+
+	verifyURL := fmt.Sprintf("%s/verify-email?token=%s", s.Config.App.FrontendURL, url.QueryEscape(token))
+	return s.Mailer.Send(mail.Message{
+		To:      []string{user.Email},
+		Subject: "Verify your Gourze email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below:\n\n%s\n\nThe link expires in %d hours.\n",
+			user.FullName, verifyURL, int(s.emailVerificationTTL().Hours())),
+	})
+}
+
+func (s *authService) HashPassword(password string) (string, error) {
+	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hashedBytes), err
+}
+
+func (s *authService) CompareHashAndPassword(hashedPassword, password string) error {
+	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+}
+
+func (s *authService) buildAuthResult(user user.User, refreshToken string, sessionID string) (*dto.AuthResultDto, error) {
+	accessToken, err := s.generateAccessToken(user, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	var authUser dto.AuthUser
+	copier.Copy(&authUser, &user)
+	return &dto.AuthResultDto{
+		AccessToken:           accessToken,
+		RefreshToken:          refreshToken,
+		AccessTokenExpiredAt:  time.Now().Add(s.accessTokenTTL()).Unix(),
+		RefreshTokenExpiredAt: time.Now().Add(s.refreshTokenTTL()).Unix(),
+		User:                  authUser,
+	}, nil
+}
+
+// issueRefreshToken persists the hash of a new refresh token in the given family and returns the raw token
+func (s *authService) issueRefreshToken(db *gorm.DB, userID uint, familyID string) (string, *RefreshToken, error) {
+	token, err := generateRandomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+	refreshToken := RefreshToken{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(s.refreshTokenTTL()),
+	}
+	if err := db.Create(&refreshToken).Error; err != nil {
+		return "", nil, err
+	}
+	return token, &refreshToken, nil
+}
+
+// issueOneTimeToken persists the hash of a new single use token and returns the raw token
+func (s *authService) issueOneTimeToken(userID uint, purpose TokenPurpose, ttl time.Duration) (string, error) {
+	token, err := generateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	oneTimeToken := OneTimeToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := s.Db.Create(&oneTimeToken).Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// consumeOneTimeToken marks a valid token as used. It fails for unknown, expired, used or foreign-purpose tokens.
+func (s *authService) consumeOneTimeToken(tx *gorm.DB, token string, purpose TokenPurpose) (*OneTimeToken, error) {
+	var oneTimeToken OneTimeToken
+	if err := tx.Where("token_hash = ? AND purpose = ?", hashToken(token), purpose).First(&oneTimeToken).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+	if oneTimeToken.UsedAt != nil || time.Now().After(oneTimeToken.ExpiresAt) {
+		return nil, ErrInvalidToken
+	}
+	result := tx.Model(&OneTimeToken{}).
+		Where("id = ? AND used_at IS NULL", oneTimeToken.ID).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInvalidToken
+	}
+	return &oneTimeToken, nil
+}
+
+func (s *authService) invalidateOneTimeTokens(userID uint, purpose TokenPurpose) error {
+	return s.Db.Model(&OneTimeToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Update("used_at", time.Now()).Error
+}
+
+func (s *authService) revokeRefreshTokenFamily(familyID string) error {
+	if err := s.Db.Model(&Session{}).Where("family_id = ? AND revoked_at IS NULL", familyID).Update("revoked_at", time.Now()).Error; err != nil {
+		return err
+	}
+	return s.Db.Model(&RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (s *authService) accessTokenTTL() time.Duration {
+	if s.Config.Auth.AccessTokenExpirationTime == 0 {
+		return time.Hour
+	}
+	return time.Duration(s.Config.Auth.AccessTokenExpirationTime) * time.Second
+}
+
+func (s *authService) refreshTokenTTL() time.Duration {
+	if s.Config.Auth.RefreshTokenExpirationTime == 0 {
+		return 30 * 24 * time.Hour
+	}
+	return time.Duration(s.Config.Auth.RefreshTokenExpirationTime) * time.Second
+}
+
+func (s *authService) passwordResetTTL() time.Duration {
+	if s.Config.Auth.PasswordResetExpirationTime == 0 {
+		return time.Hour
+	}
+	return time.Duration(s.Config.Auth.PasswordResetExpirationTime) * time.Second
+}
+
+func (s *authService) emailVerificationTTL() time.Duration {
+	if s.Config.Auth.EmailVerificationExpirationTime == 0 {
+		return 24 * time.Hour
+	}
+	return time.Duration(s.Config.Auth.EmailVerificationExpirationTime) * time.Second
+}
+
+func NewAuthService(db *gorm.DB, conf *config.Config, revocationStore RevocationStore, mailer mail.Mailer, keyManager KeyManager, auditLogger AuditLogger, passwordPolicy password.PasswordPolicy, inviteService invite.InviteService) AuthService {
+	return &authService{Db: db, Config: conf, RevocationStore: revocationStore, Mailer: mailer, KeyManager: keyManager, AuditLogger: auditLogger, PasswordPolicy: passwordPolicy, InviteService: inviteService}
+}
+
+// NewSessionRevoker lets the user module sign users out, see user.SessionRevoker
+func NewSessionRevoker(service AuthService) user.SessionRevoker {
+	return service
+}
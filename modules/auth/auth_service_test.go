@@ -1,11 +1,20 @@
 package auth
 
 import (
+	"regexp"
 	"testing"
+	"time"
 
 	"github.com/irvanherz/gourze/config"
+	"github.com/irvanherz/gourze/modules/apikey"
 	"github.com/irvanherz/gourze/modules/auth/dto"
+	"github.com/irvanherz/gourze/modules/invite"
+	inviteDto "github.com/irvanherz/gourze/modules/invite/dto"
+	"github.com/irvanherz/gourze/modules/mail"
+	"github.com/irvanherz/gourze/modules/password"
+	"github.com/irvanherz/gourze/modules/rbac"
 	"github.com/irvanherz/gourze/modules/user"
+	"github.com/pquerna/otp/totp"
 	"github.com/stretchr/testify/suite"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/driver/sqlite"
@@ -14,9 +23,33 @@ import (
 
 type AuthServiceTestSuite struct {
 	suite.Suite
-	db      *gorm.DB
-	config  *config.Config
-	service AuthService
+	db              *gorm.DB
+	config          *config.Config
+	revocationStore RevocationStore
+	mailer          *fakeMailer
+	service         AuthService
+}
+
+// fakeMailer records sent messages instead of delivering them
+type fakeMailer struct {
+	messages []mail.Message
+}
+
+func (m *fakeMailer) Send(message mail.Message) error {
+	m.messages = append(m.messages, message)
+	return nil
+}
+
+// lastToken extracts the token query parameter from the last sent message
+func (m *fakeMailer) lastToken() string {
+	if len(m.messages) == 0 {
+		return ""
+	}
+	match := regexp.MustCompile(`token=([A-Za-z0-9_\-]+)`).FindStringSubmatch(m.messages[len(m.messages)-1].Body)
+	if match == nil {
+		return ""
+	}
+	return match[1]
 }
 
 func (suite *AuthServiceTestSuite) SetupTest() {
@@ -26,12 +59,14 @@ func (suite *AuthServiceTestSuite) SetupTest() {
 			JWTSecret: "testsecret",
 		},
 	}
-	suite.service = NewAuthService(suite.db, suite.config)
+	suite.revocationStore = NewMemoryRevocationStore()
+	suite.mailer = &fakeMailer{}
+	suite.service = NewAuthService(suite.db, suite.config, suite.revocationStore, suite.mailer, NewKeyManager(suite.db, suite.config), NewDatabaseAuditLogger(suite.db), password.NewPasswordPolicy(suite.config, password.NewBreachedPasswordChecker(suite.config)), invite.NewInviteService(suite.db))
 }
 
 func setupTestDB() *gorm.DB {
 	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
-	db.AutoMigrate(&user.User{})
+	db.AutoMigrate(&user.User{}, &RefreshToken{}, &RevokedToken{}, &UserTokenRevocation{}, &OneTimeToken{}, &TwoFactorCredential{}, &RecoveryCode{}, &SigninThrottle{}, &SigningKey{}, &AuditLog{}, &Session{}, &PasskeyCredential{}, &PasskeyChallenge{}, &apikey.ApiKey{}, &invite.Invite{})
 	return db
 }
 
@@ -50,6 +85,28 @@ func (suite *AuthServiceTestSuite) TestSignin_Success() {
 	suite.NotEmpty(result.AccessToken)
 }
 
+func (suite *AuthServiceTestSuite) TestSignin_Suspended() {
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.DefaultCost)
+	account := user.User{Username: "john_doe", Email: "john@doe.com", Password: string(hashedPassword)}
+	suite.db.Create(&account)
+	input := dto.AuthSigninInput{UsernameOrEmail: "john_doe", Password: "password123"}
+	result, err := suite.service.Signin(input)
+	suite.Require().NoError(err)
+
+	now, until := time.Now(), time.Now().Add(time.Hour)
+	suite.db.Model(&account).Updates(map[string]interface{}{"suspended_at": now, "suspended_until": until, "suspension_reason": "Spam"})
+	_, err = suite.service.Signin(input)
+	suite.ErrorIs(err, ErrAccountSuspended)
+	suite.ErrorContains(err, "Spam")
+	_, err = suite.service.Refresh(dto.AuthRefreshTokenInput{RefreshToken: result.RefreshToken})
+	suite.ErrorIs(err, ErrAccountSuspended)
+
+	// Expired suspensions no longer apply
+	suite.db.Model(&account).Update("suspended_until", now)
+	_, err = suite.service.Signin(input)
+	suite.NoError(err)
+}
+
 func (suite *AuthServiceTestSuite) TestSignin_InvalidPassword() {
 	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.DefaultCost)
 	suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com", Password: string(hashedPassword)})
@@ -75,6 +132,519 @@ func (suite *AuthServiceTestSuite) TestSignin_UserNotFound() {
 	suite.Nil(result)
 }
 
+func (suite *AuthServiceTestSuite) TestSignin_IssuesRefreshToken() {
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.DefaultCost)
+	suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com", Password: string(hashedPassword)})
+
+	result, err := suite.service.Signin(dto.AuthSigninInput{UsernameOrEmail: "john_doe", Password: "password123"})
+	suite.NoError(err)
+	suite.NotEmpty(result.RefreshToken)
+
+	var stored RefreshToken
+	suite.NoError(suite.db.First(&stored).Error)
+	suite.NotEqual(result.RefreshToken, stored.TokenHash)
+	suite.Equal(hashToken(result.RefreshToken), stored.TokenHash)
+}
+
+func (suite *AuthServiceTestSuite) TestRefresh_RotatesToken() {
+	suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com"})
+	refreshToken, _ := suite.service.GenerateRefreshToken(user.User{ID: 1})
+
+	result, err := suite.service.Refresh(dto.AuthRefreshTokenInput{RefreshToken: refreshToken})
+	suite.NoError(err)
+	suite.NotEmpty(result.AccessToken)
+	suite.NotEqual(refreshToken, result.RefreshToken)
+
+	var previous RefreshToken
+	suite.db.Where("token_hash = ?", hashToken(refreshToken)).First(&previous)
+	suite.NotNil(previous.RevokedAt)
+	suite.NotNil(previous.ReplacedByID)
+}
+
+func (suite *AuthServiceTestSuite) TestRefresh_ReuseRevokesFamily() {
+	suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com"})
+	refreshToken, _ := suite.service.GenerateRefreshToken(user.User{ID: 1})
+	rotated, err := suite.service.Refresh(dto.AuthRefreshTokenInput{RefreshToken: refreshToken})
+	suite.NoError(err)
+
+	_, err = suite.service.Refresh(dto.AuthRefreshTokenInput{RefreshToken: refreshToken})
+	suite.ErrorIs(err, ErrRefreshTokenReused)
+
+	_, err = suite.service.Refresh(dto.AuthRefreshTokenInput{RefreshToken: rotated.RefreshToken})
+	suite.ErrorIs(err, ErrRefreshTokenReused)
+}
+
+func (suite *AuthServiceTestSuite) TestRefresh_InvalidToken() {
+	result, err := suite.service.Refresh(dto.AuthRefreshTokenInput{RefreshToken: "unknown"})
+	suite.ErrorIs(err, ErrInvalidRefreshToken)
+	suite.Nil(result)
+}
+
+func (suite *AuthServiceTestSuite) TestSignout_RevokesTokens() {
+	suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com"})
+	refreshToken, _ := suite.service.GenerateRefreshToken(user.User{ID: 1})
+
+	err := suite.service.Signout("token-id", time.Now().Add(time.Hour), refreshToken)
+	suite.NoError(err)
+
+	revoked, _ := suite.revocationStore.IsRevoked("token-id", 1, time.Now())
+	suite.True(revoked)
+	_, err = suite.service.Refresh(dto.AuthRefreshTokenInput{RefreshToken: refreshToken})
+	suite.Error(err)
+}
+
+func (suite *AuthServiceTestSuite) TestSignoutAll_RevokesEarlierTokens() {
+	suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com"})
+	refreshToken, _ := suite.service.GenerateRefreshToken(user.User{ID: 1})
+	issuedAt := time.Now().Add(-time.Minute)
+
+	suite.NoError(suite.service.SignoutAll(1))
+
+	revoked, _ := suite.revocationStore.IsRevoked("other-token", 1, issuedAt)
+	suite.True(revoked)
+	revoked, _ = suite.revocationStore.IsRevoked("other-token", 2, issuedAt)
+	suite.False(revoked)
+	_, err := suite.service.Refresh(dto.AuthRefreshTokenInput{RefreshToken: refreshToken})
+	suite.Error(err)
+}
+
+func (suite *AuthServiceTestSuite) TestForgotPassword_UnknownEmail() {
+	err := suite.service.ForgotPassword(dto.AuthForgotPasswordInput{Email: "nobody@doe.com"})
+	suite.NoError(err)
+	suite.Empty(suite.mailer.messages)
+}
+
+func (suite *AuthServiceTestSuite) TestResetPassword_Success() {
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.DefaultCost)
+	suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com", Password: string(hashedPassword)})
+	refreshToken, _ := suite.service.GenerateRefreshToken(user.User{ID: 1})
+
+	suite.NoError(suite.service.ForgotPassword(dto.AuthForgotPasswordInput{Email: "john@doe.com"}))
+	suite.Len(suite.mailer.messages, 1)
+	suite.Equal([]string{"john@doe.com"}, suite.mailer.messages[0].To)
+	token := suite.mailer.lastToken()
+	suite.NotEmpty(token)
+
+	suite.NoError(suite.service.ResetPassword(dto.AuthResetPasswordInput{Token: token, Password: "newpassword123"}))
+
+	_, err := suite.service.Signin(dto.AuthSigninInput{UsernameOrEmail: "john_doe", Password: "newpassword123"})
+	suite.NoError(err)
+	_, err = suite.service.Refresh(dto.AuthRefreshTokenInput{RefreshToken: refreshToken})
+	suite.Error(err)
+
+	// Tokens are single use
+	err = suite.service.ResetPassword(dto.AuthResetPasswordInput{Token: token, Password: "anotherpassword"})
+	suite.ErrorIs(err, ErrInvalidToken)
+}
+
+func (suite *AuthServiceTestSuite) TestResetPassword_ExpiredToken() {
+	suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com"})
+	suite.NoError(suite.service.ForgotPassword(dto.AuthForgotPasswordInput{Email: "john@doe.com"}))
+	suite.db.Model(&OneTimeToken{}).Where("1 = 1").Update("expires_at", time.Now().Add(-time.Minute))
+
+	err := suite.service.ResetPassword(dto.AuthResetPasswordInput{Token: suite.mailer.lastToken(), Password: "newpassword123"})
+	suite.ErrorIs(err, ErrInvalidToken)
+}
+
+func (suite *AuthServiceTestSuite) TestSignup_SendsVerificationEmail() {
+	_, err := suite.service.Signup(dto.AuthSignupInput{Username: "john_doe", Email: "john@doe.com", FullName: "John Doe", Password: "Correct-Horse-42"})
+	suite.NoError(err)
+	suite.Len(suite.mailer.messages, 1)
+
+	suite.NoError(suite.service.VerifyEmail(dto.AuthVerifyEmailInput{Token: suite.mailer.lastToken()}))
+	var verified user.User
+	suite.db.First(&verified, 1)
+	suite.NotNil(verified.EmailVerifiedAt)
+
+	suite.ErrorIs(suite.service.ResendEmailVerification(1), ErrEmailAlreadyVerified)
+}
+
+func (suite *AuthServiceTestSuite) TestSignup_Modes() {
+	input := dto.AuthSignupInput{Username: "john_doe", Email: "john@acme.com", FullName: "John Doe", Password: "Correct-Horse-42"}
+
+	suite.config.Auth.SignupMode = SignupClosed
+	_, err := suite.service.Signup(input)
+	suite.ErrorIs(err, ErrSignupNotAllowed)
+
+	suite.config.Auth.SignupMode = SignupDomain
+	suite.config.Auth.SignupAllowedDomains = []string{"ACME.com"}
+	_, err = suite.service.Signup(dto.AuthSignupInput{Username: "jane_doe", Email: "jane@gmail.com", FullName: "Jane Doe", Password: "Correct-Horse-42"})
+	suite.ErrorIs(err, ErrSignupNotAllowed)
+	_, err = suite.service.Signup(input)
+	suite.NoError(err)
+
+	suite.config.Auth.SignupMode = SignupInvite
+	_, err = suite.service.Signup(dto.AuthSignupInput{Username: "jane_doe", Email: "jane@gmail.com", FullName: "Jane Doe", Password: "Correct-Horse-42"})
+	suite.ErrorIs(err, ErrSignupNotAllowed)
+}
+
+func (suite *AuthServiceTestSuite) TestSignup_WithInvite() {
+	suite.config.Auth.SignupMode = SignupInvite
+	invites := invite.NewInviteService(suite.db)
+	created, err := invites.CreateInvite(rbac.Actor{ID: 1, Role: user.Super}, &inviteDto.InviteCreateInput{Role: string(user.Admin), MaxUses: 1})
+	suite.Require().NoError(err)
+
+	_, err = suite.service.Signup(dto.AuthSignupInput{Username: "john_doe", Email: "john@doe.com", FullName: "John Doe", Password: "Correct-Horse-42", InviteCode: "WRONG"})
+	suite.ErrorIs(err, invite.ErrInvalidInvite)
+
+	result, err := suite.service.Signup(dto.AuthSignupInput{Username: "john_doe", Email: "john@doe.com", FullName: "John Doe", Password: "Correct-Horse-42", InviteCode: created.Code})
+	suite.NoError(err)
+	suite.NotEmpty(result.AccessToken)
+	var signedUp user.User
+	suite.db.Where("username = ?", "john_doe").First(&signedUp)
+	suite.Equal(user.Admin, signedUp.Role)
+	suite.Equal(&created.ID, signedUp.InviteID)
+
+	// The invite was for a single signup
+	_, err = suite.service.Signup(dto.AuthSignupInput{Username: "jane_doe", Email: "jane@doe.com", FullName: "Jane Doe", Password: "Correct-Horse-42", InviteCode: created.Code})
+	suite.ErrorIs(err, invite.ErrInvalidInvite)
+}
+
+func (suite *AuthServiceTestSuite) TestSignup_InviteForRoleRequiringTwoFactor() {
+	suite.config.Auth.TwoFactorRequiredRoles = []string{string(user.Admin)}
+	invites := invite.NewInviteService(suite.db)
+	created, err := invites.CreateInvite(rbac.Actor{ID: 1, Role: user.Super}, &inviteDto.InviteCreateInput{Role: string(user.Admin), MaxUses: 1})
+	suite.Require().NoError(err)
+
+	// The new admin has to enroll before getting a session
+	result, err := suite.service.Signup(dto.AuthSignupInput{Username: "john_doe", Email: "john@doe.com", FullName: "John Doe", Password: "Correct-Horse-42", InviteCode: created.Code})
+	suite.NoError(err)
+	suite.True(result.TwoFactorRequired)
+	suite.True(result.TwoFactorEnrollmentRequired)
+	suite.Empty(result.AccessToken)
+	suite.Empty(result.RefreshToken)
+	var sessions int64
+	suite.db.Model(&Session{}).Count(&sessions)
+	suite.Zero(sessions)
+}
+
+func (suite *AuthServiceTestSuite) TestSignup_WeakPassword() {
+	_, err := suite.service.Signup(dto.AuthSignupInput{Username: "john_doe", Email: "john@doe.com", FullName: "John Doe", Password: "password123"})
+	suite.ErrorIs(err, password.ErrBreachedPassword)
+	_, err = suite.service.Signup(dto.AuthSignupInput{Username: "john_doe", Email: "john@doe.com", FullName: "John Doe", Password: "short"})
+	suite.ErrorIs(err, password.ErrWeakPassword)
+	_, err = suite.service.Signup(dto.AuthSignupInput{Username: "john_doe", Email: "john@doe.com", FullName: "John Doe", Password: "my-john_doe-pass"})
+	suite.ErrorIs(err, password.ErrWeakPassword)
+
+	var count int64
+	suite.db.Model(&user.User{}).Count(&count)
+	suite.Zero(count)
+}
+
+func (suite *AuthServiceTestSuite) TestResetPassword_WeakPassword() {
+	suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com"})
+	suite.NoError(suite.service.ForgotPassword(dto.AuthForgotPasswordInput{Email: "john@doe.com"}))
+	token := suite.mailer.lastToken()
+
+	err := suite.service.ResetPassword(dto.AuthResetPasswordInput{Token: token, Password: "password123"})
+	suite.ErrorIs(err, password.ErrBreachedPassword)
+	// The token isn't consumed by a rejected password
+	suite.NoError(suite.service.ResetPassword(dto.AuthResetPasswordInput{Token: token, Password: "newpassword123"}))
+}
+
+func (suite *AuthServiceTestSuite) TestSignin_PasswordChangeRequired() {
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("root"), bcrypt.DefaultCost)
+	suite.db.Create(&user.User{Username: "root", Email: "root@localhost", Password: string(hashedPassword), Role: user.Super, PasswordChangeRequired: true})
+
+	result, err := suite.service.Signin(dto.AuthSigninInput{UsernameOrEmail: "root", Password: "root"})
+	suite.NoError(err)
+	suite.True(result.PasswordChangeRequired)
+	suite.Empty(result.AccessToken)
+	suite.NotEmpty(result.ChallengeToken)
+
+	// The challenge token only completes a password change
+	_, err = suite.service.Refresh(dto.AuthRefreshTokenInput{RefreshToken: result.ChallengeToken})
+	suite.Error(err)
+	_, err = suite.service.ChangePassword(dto.AuthChangePasswordInput{ChallengeToken: result.ChallengeToken, CurrentPassword: "wrong", NewPassword: "Correct-Horse-42"}, 0)
+	suite.ErrorIs(err, ErrInvalidCredentials)
+	_, err = suite.service.ChangePassword(dto.AuthChangePasswordInput{ChallengeToken: result.ChallengeToken, CurrentPassword: "root", NewPassword: "root"}, 0)
+	suite.ErrorIs(err, password.ErrWeakPassword)
+
+	changed, err := suite.service.ChangePassword(dto.AuthChangePasswordInput{ChallengeToken: result.ChallengeToken, CurrentPassword: "root", NewPassword: "Correct-Horse-42"}, 0)
+	suite.NoError(err)
+	suite.False(changed.PasswordChangeRequired)
+	suite.NotEmpty(changed.AccessToken)
+
+	signedIn, err := suite.service.Signin(dto.AuthSigninInput{UsernameOrEmail: "root", Password: "Correct-Horse-42"})
+	suite.NoError(err)
+	suite.False(signedIn.PasswordChangeRequired)
+	suite.NotEmpty(signedIn.AccessToken)
+}
+
+func (suite *AuthServiceTestSuite) TestChangePassword_SignsOutOtherSessions() {
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.DefaultCost)
+	suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com", Password: string(hashedPassword)})
+	signedIn, _ := suite.service.Signin(dto.AuthSigninInput{UsernameOrEmail: "john_doe", Password: "password123"})
+
+	changed, err := suite.service.ChangePassword(dto.AuthChangePasswordInput{CurrentPassword: "password123", NewPassword: "Correct-Horse-42"}, 1)
+	suite.NoError(err)
+	_, err = suite.service.Refresh(dto.AuthRefreshTokenInput{RefreshToken: signedIn.RefreshToken})
+	suite.Error(err)
+	_, err = suite.service.Refresh(dto.AuthRefreshTokenInput{RefreshToken: changed.RefreshToken})
+	suite.NoError(err)
+}
+
+func (suite *AuthServiceTestSuite) TestResendEmailVerification_InvalidatesPreviousLink() {
+	suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com"})
+	suite.NoError(suite.service.ResendEmailVerification(1))
+	firstToken := suite.mailer.lastToken()
+	suite.NoError(suite.service.ResendEmailVerification(1))
+
+	suite.ErrorIs(suite.service.VerifyEmail(dto.AuthVerifyEmailInput{Token: firstToken}), ErrInvalidToken)
+	suite.NoError(suite.service.VerifyEmail(dto.AuthVerifyEmailInput{Token: suite.mailer.lastToken()}))
+}
+
+func (suite *AuthServiceTestSuite) TestVerifyEmail_RejectsResetToken() {
+	suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com"})
+	suite.NoError(suite.service.ForgotPassword(dto.AuthForgotPasswordInput{Email: "john@doe.com"}))
+
+	suite.ErrorIs(suite.service.VerifyEmail(dto.AuthVerifyEmailInput{Token: suite.mailer.lastToken()}), ErrInvalidToken)
+}
+
+func (suite *AuthServiceTestSuite) TestMagicLink_Success() {
+	suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com"})
+	suite.NoError(suite.service.RequestMagicLink(dto.AuthMagicLinkInput{Email: "john@doe.com"}))
+	suite.Len(suite.mailer.messages, 1)
+	suite.Contains(suite.mailer.messages[0].Body, "/magic-link?token=")
+	token := suite.mailer.lastToken()
+
+	result, err := suite.service.ConsumeMagicLink(dto.AuthMagicLinkConsumeInput{Token: token})
+	suite.NoError(err)
+	suite.NotEmpty(result.AccessToken)
+	suite.NotEmpty(result.RefreshToken)
+	suite.Equal("john_doe", result.User.Username)
+	var signedIn user.User
+	suite.db.First(&signedIn, 1)
+	suite.NotNil(signedIn.EmailVerifiedAt)
+
+	// Links are single use
+	_, err = suite.service.ConsumeMagicLink(dto.AuthMagicLinkConsumeInput{Token: token})
+	suite.ErrorIs(err, ErrInvalidToken)
+}
+
+func (suite *AuthServiceTestSuite) TestMagicLink_InvalidTokens() {
+	suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com"})
+	suite.NoError(suite.service.RequestMagicLink(dto.AuthMagicLinkInput{Email: "nobody@doe.com"}))
+	suite.Empty(suite.mailer.messages)
+
+	// Only the latest link works
+	suite.NoError(suite.service.RequestMagicLink(dto.AuthMagicLinkInput{Email: "john@doe.com"}))
+	firstToken := suite.mailer.lastToken()
+	suite.NoError(suite.service.RequestMagicLink(dto.AuthMagicLinkInput{Email: "john@doe.com"}))
+	_, err := suite.service.ConsumeMagicLink(dto.AuthMagicLinkConsumeInput{Token: firstToken})
+	suite.ErrorIs(err, ErrInvalidToken)
+
+	suite.db.Model(&OneTimeToken{}).Where("1 = 1").Update("expires_at", time.Now().Add(-time.Minute))
+	_, err = suite.service.ConsumeMagicLink(dto.AuthMagicLinkConsumeInput{Token: suite.mailer.lastToken()})
+	suite.ErrorIs(err, ErrInvalidToken)
+
+	// Tokens of other purposes don't sign in
+	suite.NoError(suite.service.ForgotPassword(dto.AuthForgotPasswordInput{Email: "john@doe.com"}))
+	_, err = suite.service.ConsumeMagicLink(dto.AuthMagicLinkConsumeInput{Token: suite.mailer.lastToken()})
+	suite.ErrorIs(err, ErrInvalidToken)
+}
+
+func (suite *AuthServiceTestSuite) TestMagicLink_TwoFactorChallenge() {
+	suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com"})
+	suite.db.Create(&TwoFactorCredential{UserID: 1, Secret: "JBSWY3DPEHPK3PXP", EnabledAt: &time.Time{}})
+	suite.NoError(suite.service.RequestMagicLink(dto.AuthMagicLinkInput{Email: "john@doe.com"}))
+
+	result, err := suite.service.ConsumeMagicLink(dto.AuthMagicLinkConsumeInput{Token: suite.mailer.lastToken()})
+	suite.NoError(err)
+	suite.True(result.TwoFactorRequired)
+	suite.Empty(result.AccessToken)
+	suite.NotEmpty(result.ChallengeToken)
+}
+
+func (suite *AuthServiceTestSuite) TestSignin_UniformInvalidCredentials() {
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.DefaultCost)
+	suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com", Password: string(hashedPassword)})
+
+	_, err := suite.service.Signin(dto.AuthSigninInput{UsernameOrEmail: "john_doe", Password: "wrongpassword"})
+	suite.ErrorIs(err, ErrInvalidCredentials)
+	_, err = suite.service.Signin(dto.AuthSigninInput{UsernameOrEmail: "nonexistent_user", Password: "password123"})
+	suite.ErrorIs(err, ErrInvalidCredentials)
+}
+
+func (suite *AuthServiceTestSuite) TestSignin_LocksOutAccount() {
+	suite.config.Auth.SigninMaxAttempts = 3
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.DefaultCost)
+	suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com", Password: string(hashedPassword)})
+
+	for i := 0; i < 3; i++ {
+		_, err := suite.service.Signin(dto.AuthSigninInput{UsernameOrEmail: "john_doe", Password: "wrongpassword", IPAddress: "10.0.0.1"})
+		suite.ErrorIs(err, ErrInvalidCredentials)
+	}
+	// The right password doesn't help while locked, neither through the email
+	_, err := suite.service.Signin(dto.AuthSigninInput{UsernameOrEmail: "john@doe.com", Password: "password123", IPAddress: "10.0.0.2"})
+	var lockedErr *SigninLockedError
+	suite.ErrorAs(err, &lockedErr)
+	suite.InDelta(time.Minute.Seconds(), lockedErr.RetryAfter.Seconds(), 1)
+
+	suite.NoError(suite.service.UnlockUser(1))
+	_, err = suite.service.Signin(dto.AuthSigninInput{UsernameOrEmail: "john_doe", Password: "password123", IPAddress: "10.0.0.2"})
+	suite.NoError(err)
+}
+
+func (suite *AuthServiceTestSuite) TestSignin_LockoutBacksOffExponentially() {
+	suite.config.Auth.SigninMaxAttempts = 2
+	suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com", Password: "x"})
+
+	for i := 0; i < 2; i++ {
+		suite.service.Signin(dto.AuthSigninInput{UsernameOrEmail: "john_doe", Password: "wrongpassword"})
+	}
+	// Let the first lockout pass, the next failure locks twice as long
+	suite.db.Model(&SigninThrottle{}).Where("1 = 1").Update("locked_until", time.Now().Add(-time.Second))
+	suite.service.Signin(dto.AuthSigninInput{UsernameOrEmail: "john_doe", Password: "wrongpassword"})
+
+	var throttle SigninThrottle
+	suite.NoError(suite.db.Where("subject = ?", "user:1").First(&throttle).Error)
+	suite.Equal(uint64(3), throttle.FailedCount)
+	suite.InDelta((2 * time.Minute).Seconds(), time.Until(*throttle.LockedUntil).Seconds(), 1)
+}
+
+func (suite *AuthServiceTestSuite) TestSignin_LocksOutIPAddress() {
+	suite.config.Auth.SigninIPMaxAttempts = 3
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.DefaultCost)
+	suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com", Password: string(hashedPassword)})
+
+	for _, username := range []string{"alice", "bob", "carol"} {
+		_, err := suite.service.Signin(dto.AuthSigninInput{UsernameOrEmail: username, Password: "guess", IPAddress: "10.0.0.1"})
+		suite.ErrorIs(err, ErrInvalidCredentials)
+	}
+	_, err := suite.service.Signin(dto.AuthSigninInput{UsernameOrEmail: "john_doe", Password: "password123", IPAddress: "10.0.0.1"})
+	suite.ErrorIs(err, ErrTooManySigninAttempts)
+	_, err = suite.service.Signin(dto.AuthSigninInput{UsernameOrEmail: "john_doe", Password: "password123", IPAddress: "10.0.0.2"})
+	suite.NoError(err)
+}
+
+func (suite *AuthServiceTestSuite) TestConfirmPassword_LocksOutAccount() {
+	suite.config.Auth.SigninMaxAttempts = 3
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.DefaultCost)
+	suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com", Password: string(hashedPassword)})
+
+	for i := 0; i < 3; i++ {
+		suite.ErrorIs(suite.service.ConfirmPassword(1, "wrongpassword"), ErrInvalidCredentials)
+	}
+	// Guessing the password of a signed in user locks out signins too
+	suite.ErrorIs(suite.service.ConfirmPassword(1, "password123"), ErrTooManySigninAttempts)
+	_, err := suite.service.Signin(dto.AuthSigninInput{UsernameOrEmail: "john_doe", Password: "password123"})
+	suite.ErrorIs(err, ErrTooManySigninAttempts)
+
+	suite.NoError(suite.service.UnlockUser(1))
+	suite.NoError(suite.service.ConfirmPassword(1, "password123"))
+}
+
+// enableTwoFactor enrolls and activates TOTP for the user and returns the secret and recovery codes
+func (suite *AuthServiceTestSuite) enableTwoFactor(userID uint) (string, []string) {
+	enrollment, err := suite.service.EnrollTwoFactor(dto.AuthTwoFactorEnrollInput{}, userID)
+	suite.Require().NoError(err)
+	code, _ := totp.GenerateCode(enrollment.Secret, time.Now())
+	activation, err := suite.service.ActivateTwoFactor(dto.AuthTwoFactorActivateInput{Code: code}, userID)
+	suite.Require().NoError(err)
+	suite.Nil(activation.Auth)
+	// Let the activation code's time step pass so the next code isn't a replay
+	suite.db.Model(&TwoFactorCredential{}).Where("user_id = ?", userID).Update("last_used_step", time.Now().Unix()/30-2)
+	return enrollment.Secret, activation.RecoveryCodes
+}
+
+func (suite *AuthServiceTestSuite) TestSignin_TwoFactorChallenge() {
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.DefaultCost)
+	suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com", Password: string(hashedPassword)})
+	secret, _ := suite.enableTwoFactor(1)
+
+	result, err := suite.service.Signin(dto.AuthSigninInput{UsernameOrEmail: "john_doe", Password: "password123"})
+	suite.NoError(err)
+	suite.True(result.TwoFactorRequired)
+	suite.Empty(result.AccessToken)
+	suite.Empty(result.RefreshToken)
+	suite.NotEmpty(result.ChallengeToken)
+
+	_, err = suite.service.VerifyTwoFactor(dto.AuthTwoFactorVerifyInput{ChallengeToken: result.ChallengeToken, Code: "000000"})
+	suite.ErrorIs(err, ErrInvalidTwoFactorCode)
+
+	code, _ := totp.GenerateCode(secret, time.Now())
+	verified, err := suite.service.VerifyTwoFactor(dto.AuthTwoFactorVerifyInput{ChallengeToken: result.ChallengeToken, Code: code})
+	suite.NoError(err)
+	suite.NotEmpty(verified.AccessToken)
+	suite.NotEmpty(verified.RefreshToken)
+
+	// The same code can't be replayed
+	_, err = suite.service.VerifyTwoFactor(dto.AuthTwoFactorVerifyInput{ChallengeToken: result.ChallengeToken, Code: code})
+	suite.ErrorIs(err, ErrInvalidTwoFactorCode)
+}
+
+func (suite *AuthServiceTestSuite) TestVerifyTwoFactor_RecoveryCodeIsSingleUse() {
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.DefaultCost)
+	suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com", Password: string(hashedPassword)})
+	_, recoveryCodes := suite.enableTwoFactor(1)
+	suite.Len(recoveryCodes, recoveryCodeCount)
+
+	result, _ := suite.service.Signin(dto.AuthSigninInput{UsernameOrEmail: "john_doe", Password: "password123"})
+	_, err := suite.service.VerifyTwoFactor(dto.AuthTwoFactorVerifyInput{ChallengeToken: result.ChallengeToken, RecoveryCode: recoveryCodes[0]})
+	suite.NoError(err)
+	_, err = suite.service.VerifyTwoFactor(dto.AuthTwoFactorVerifyInput{ChallengeToken: result.ChallengeToken, RecoveryCode: recoveryCodes[0]})
+	suite.ErrorIs(err, ErrInvalidTwoFactorCode)
+}
+
+func (suite *AuthServiceTestSuite) TestSignin_TwoFactorRequiredForRole() {
+	suite.config.Auth.TwoFactorRequiredRoles = []string{string(user.Admin)}
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.DefaultCost)
+	suite.db.Create(&user.User{Username: "admin", Email: "admin@doe.com", Password: string(hashedPassword), Role: user.Admin})
+
+	result, err := suite.service.Signin(dto.AuthSigninInput{UsernameOrEmail: "admin", Password: "password123"})
+	suite.NoError(err)
+	suite.True(result.TwoFactorRequired)
+	suite.True(result.TwoFactorEnrollmentRequired)
+	suite.Empty(result.AccessToken)
+
+	// Enrollment through the challenge token completes the signin
+	enrollment, err := suite.service.EnrollTwoFactor(dto.AuthTwoFactorEnrollInput{ChallengeToken: result.ChallengeToken}, 0)
+	suite.NoError(err)
+	suite.Contains(enrollment.OtpauthURI, "otpauth://totp/")
+	code, _ := totp.GenerateCode(enrollment.Secret, time.Now())
+	activation, err := suite.service.ActivateTwoFactor(dto.AuthTwoFactorActivateInput{ChallengeToken: result.ChallengeToken, Code: code}, 0)
+	suite.NoError(err)
+	suite.NotNil(activation.Auth)
+	suite.NotEmpty(activation.Auth.AccessToken)
+
+	suite.ErrorIs(suite.service.DisableTwoFactor(1, dto.AuthTwoFactorDisableInput{Code: code}), ErrTwoFactorRequired)
+}
+
+func (suite *AuthServiceTestSuite) TestImpersonate() {
+	suite.db.Create(&user.User{Username: "root", Email: "root@gourze.com", Role: user.Super})
+	suite.db.Create(&user.User{Username: "admin", Email: "admin@doe.com", Role: user.Admin})
+	suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com"})
+	suite.db.Create(&user.User{Username: "root2", Email: "root2@gourze.com", Role: user.Super})
+	super := rbac.Actor{ID: 1, Role: user.Super}
+
+	result, err := suite.service.Impersonate(super, 3, "127.0.0.1")
+	suite.Require().NoError(err)
+	suite.Equal("john_doe", result.User.Username)
+	suite.Equal(uint(1), result.ImpersonatorID)
+	claims, err := parseClaims(suite.config, suite.service.(*authService).KeyManager, result.AccessToken, accessTokenType)
+	suite.Require().NoError(err)
+	suite.Equal("3", claims.Subject)
+	suite.Equal("1", claims.Act.Subject)
+	suite.WithinDuration(time.Now().Add(15*time.Minute), claims.ExpiresAt.Time, time.Minute)
+
+	var log AuditLog
+	suite.NoError(suite.db.First(&log).Error)
+	suite.Equal(AuditImpersonationStart, log.Action)
+	suite.Equal(uint(1), log.ActorID)
+	suite.Equal(uint(3), log.UserID)
+	suite.Equal(claims.ID, log.TokenID)
+
+	_, err = suite.service.Impersonate(rbac.Actor{ID: 2, Role: user.Admin}, 3, "")
+	suite.ErrorIs(err, ErrImpersonationForbidden)
+	_, err = suite.service.Impersonate(super, 4, "")
+	suite.ErrorIs(err, ErrImpersonationForbidden)
+	_, err = suite.service.Impersonate(super, 1, "")
+	suite.ErrorIs(err, ErrImpersonationForbidden)
+	_, err = suite.service.Impersonate(super, 99, "")
+	suite.ErrorIs(err, gorm.ErrRecordNotFound)
+}
+
 func TestAuthServiceTestSuite(t *testing.T) {
 	suite.Run(t, new(AuthServiceTestSuite))
 }
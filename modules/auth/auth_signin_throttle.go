@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidCredentials    = errors.New("invalid username or password")
+	ErrTooManySigninAttempts = errors.New("too many failed signin attempts, try again later")
+)
+
+// SigninLockedError is returned while an account or client IP is locked out. It matches ErrTooManySigninAttempts.
+type SigninLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *SigninLockedError) Error() string {
+	return ErrTooManySigninAttempts.Error()
+}
+
+func (e *SigninLockedError) Is(target error) bool {
+	return target == ErrTooManySigninAttempts
+}
+
+// SigninThrottle counts the recent failed signins of an account or a client IP, see signinThrottleKey
+type SigninThrottle struct {
+	ID           uint       `gorm:"primarykey" json:"id"`
+	Subject      string     `gorm:"unique;type:varchar(320)" json:"subject"`
+	FailedCount  uint64     `gorm:"not null;default:0" json:"failedCount"`
+	LastFailedAt time.Time  `gorm:"type:timestamp" json:"lastFailedAt"`
+	LockedUntil  *time.Time `gorm:"type:timestamp" json:"lockedUntil"`
+	CreatedAt    time.Time  `gorm:"type:timestamp" json:"createdAt"`
+	UpdatedAt    time.Time  `gorm:"type:timestamp" json:"updatedAt"`
+}
+
+// dummyPasswordHash is compared against when the account doesn't exist, so a miss takes as long as a wrong password
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("gourze-dummy-password"), bcrypt.DefaultCost)
+	return hash
+})
+
+// signinThrottleKey identifies a throttled subject. Unknown usernames are throttled by name so
+// they lock out exactly like existing accounts.
+func signinThrottleKey(kind string, value any) string {
+	return strings.ToLower(fmt.Sprintf("%s:%v", kind, value))
+}
+
+// UnlockUser implements AuthService. It clears the failed signin attempts of an account.
+func (s *authService) UnlockUser(userID uint) error {
+	return s.Db.Where("subject = ?", signinThrottleKey("user", userID)).Delete(&SigninThrottle{}).Error
+}
+
+// checkSigninThrottle fails with a SigninLockedError when any of the keys is locked out
+func (s *authService) checkSigninThrottle(keys ...string) error {
+	var throttles []SigninThrottle
+	if err := s.Db.Where("subject IN ? AND locked_until > ?", keys, time.Now()).Find(&throttles).Error; err != nil {
+		return err
+	}
+	var retryAfter time.Duration
+	for _, throttle := range throttles {
+		retryAfter = max(retryAfter, time.Until(*throttle.LockedUntil))
+	}
+	if retryAfter > 0 {
+		return &SigninLockedError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// recordSigninFailure counts a failed attempt for key. Once maxAttempts is reached the key is locked
+// out, and every further failure doubles the lockout up to Config.Auth.SigninMaxLockoutTime.
+func (s *authService) recordSigninFailure(key string, maxAttempts uint64) error {
+	now := time.Now()
+	return s.Db.Transaction(func(tx *gorm.DB) error {
+		// Failures older than the longest lockout are forgotten
+		if err := tx.Model(&SigninThrottle{}).
+			Where("subject = ? AND last_failed_at < ? AND (locked_until IS NULL OR locked_until < ?)", key, now.Add(-s.signinMaxLockoutTime()), now).
+			Update("failed_count", 0).Error; err != nil {
+			return err
+		}
+		throttle := SigninThrottle{Subject: key, FailedCount: 1, LastFailedAt: now}
+		if err := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "subject"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"failed_count":   gorm.Expr("signin_throttles.failed_count + 1"),
+				"last_failed_at": now,
+				"updated_at":     now,
+			}),
+		}).Create(&throttle).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("subject = ?", key).First(&throttle).Error; err != nil {
+			return err
+		}
+		if throttle.FailedCount < maxAttempts {
+			return nil
+		}
+
+		lockout := s.signinLockoutTime()
+		for i := maxAttempts; i < throttle.FailedCount && lockout < s.signinMaxLockoutTime(); i++ {
+			lockout *= 2
+		}
+		lockedUntil := now.Add(min(lockout, s.signinMaxLockoutTime()))
+		return tx.Model(&throttle).Update("locked_until", lockedUntil).Error
+	})
+}
+
+func (s *authService) resetSigninThrottle(key string) error {
+	return s.Db.Where("subject = ?", key).Delete(&SigninThrottle{}).Error
+}
+
+func (s *authService) signinMaxAttempts() uint64 {
+	if s.Config.Auth.SigninMaxAttempts == 0 {
+		return 5
+	}
+	return s.Config.Auth.SigninMaxAttempts
+}
+
+func (s *authService) signinIPMaxAttempts() uint64 {
+	if s.Config.Auth.SigninIPMaxAttempts == 0 {
+		return 50
+	}
+	return s.Config.Auth.SigninIPMaxAttempts
+}
+
+func (s *authService) signinLockoutTime() time.Duration {
+	if s.Config.Auth.SigninLockoutTime == 0 {
+		return time.Minute
+	}
+	return time.Duration(s.Config.Auth.SigninLockoutTime) * time.Second
+}
+
+func (s *authService) signinMaxLockoutTime() time.Duration {
+	if s.Config.Auth.SigninMaxLockoutTime == 0 {
+		return time.Hour
+	}
+	return time.Duration(s.Config.Auth.SigninMaxLockoutTime) * time.Second
+}
@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/irvanherz/gourze/config"
+)
+
+// Values of Config.Auth.SignupMode
+const (
+	// SignupOpen lets anybody sign up
+	SignupOpen = "open"
+	// SignupInvite requires an invite code
+	SignupInvite = "invite"
+	// SignupDomain requires an email address of Config.Auth.SignupAllowedDomains
+	SignupDomain = "domain"
+	// SignupClosed refuses every signup, accounts are created by admins
+	SignupClosed = "closed"
+)
+
+var (
+	ErrSignupNotAllowed = errors.New("signup is not allowed")
+	ErrEmailNotAllowed  = errors.New("email address is not allowed")
+)
+
+// CheckSignupAllowed tells whether an account may be created for email under the signup mode.
+// Accounts created without an invite, e.g. through an identity provider, pass withInvite false.
+// Unknown modes are treated as closed.
+func CheckSignupAllowed(conf *config.Config, email string, withInvite bool) error {
+	switch conf.Auth.SignupMode {
+	case "", SignupOpen:
+		return nil
+	case SignupInvite:
+		if !withInvite {
+			return fmt.Errorf("%w: an invite code is required", ErrSignupNotAllowed)
+		}
+		return nil
+	case SignupDomain:
+		if !isAllowedDomain(conf, email) {
+			return fmt.Errorf("%w: use the email address of your organization", ErrSignupNotAllowed)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: signups are closed", ErrSignupNotAllowed)
+	}
+}
+
+// CheckEmailAllowed tells whether an existing account may switch to email. In domain mode the
+// address must stay within Config.Auth.SignupAllowedDomains, or changing it would bypass the signup rule.
+func CheckEmailAllowed(conf *config.Config, email string) error {
+	if conf.Auth.SignupMode == SignupDomain && !isAllowedDomain(conf, email) {
+		return fmt.Errorf("%w: use the email address of your organization", ErrEmailNotAllowed)
+	}
+	return nil
+}
+
+func isAllowedDomain(conf *config.Config, email string) bool {
+	_, domain, _ := strings.Cut(strings.ToLower(strings.TrimSpace(email)), "@")
+	return domain != "" && slices.ContainsFunc(conf.Auth.SignupAllowedDomains, func(allowedDomain string) bool {
+		return strings.EqualFold(strings.TrimSpace(allowedDomain), domain)
+	})
+}
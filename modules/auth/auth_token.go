@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/irvanherz/gourze/config"
+	"github.com/irvanherz/gourze/modules/user"
+)
+
+// Values of the "typ" claim of the JWTs we sign
+const (
+	accessTokenType        = "access"
+	twoFactorChallengeType = "2fa-challenge"
+	passwordChangeType     = "password-change"
+)
+
+// Claims are the claims of the JWTs we sign. The issuer and audience come from the config,
+// the subject is the user ID.
+type Claims struct {
+	jwt.RegisteredClaims
+	Role user.UserRole `json:"role,omitempty"`
+	// SessionID is the refresh token family the token was issued for
+	SessionID string `json:"sid,omitempty"`
+	// Scope is a space separated list of scopes restricting what the token may do
+	Scope string `json:"scope,omitempty"`
+	Type  string `json:"typ"`
+	// Act identifies the admin behind an impersonation token, see RFC 8693 section 4.1
+	Act *ActorClaim `json:"act,omitempty"`
+}
+
+// ActorClaim is the "act" claim of an impersonation token
+type ActorClaim struct {
+	Subject string `json:"sub"`
+}
+
+// UserID returns the subject as a user ID
+func (c *Claims) UserID() (uint, error) {
+	id, err := strconv.ParseUint(c.Subject, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid subject: %w", err)
+	}
+	return uint(id), nil
+}
+
+// ImpersonatorID returns the ID of the admin impersonating the subject, or 0 for regular tokens
+func (c *Claims) ImpersonatorID() (uint, error) {
+	if c.Act == nil {
+		return 0, nil
+	}
+	id, err := strconv.ParseUint(c.Act.Subject, 10, 64)
+	if err != nil || id == 0 {
+		return 0, fmt.Errorf("invalid actor subject: %v", c.Act.Subject)
+	}
+	return uint(id), nil
+}
+
+// signClaims fills in the issuer and audience and signs the claims with the current key
+func signClaims(conf *config.Config, keys KeyManager, claims *Claims) (string, error) {
+	claims.Issuer = conf.Auth.JWTIssuer
+	if conf.Auth.JWTAudience != "" {
+		claims.Audience = jwt.ClaimStrings{conf.Auth.JWTAudience}
+	}
+	return keys.Sign(claims)
+}
+
+// parseClaims verifies the signature, expiry, issuer, audience and type of a token
+func parseClaims(conf *config.Config, keys KeyManager, tokenString string, tokenType string) (*Claims, error) {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(keys.ValidMethods()),
+		jwt.WithIssuer(conf.Auth.JWTIssuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	}
+	if conf.Auth.JWTAudience != "" {
+		options = append(options, jwt.WithAudience(conf.Auth.JWTAudience))
+	}
+	var claims Claims
+	token, err := jwt.ParseWithClaims(tokenString, &claims, keys.Keyfunc, options...)
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+	// Other kinds of tokens we sign, like 2FA challenges, must not work in place of each other
+	if claims.Type != tokenType {
+		return nil, ErrInvalidToken
+	}
+	if _, err := claims.UserID(); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if _, err := claims.ImpersonatorID(); err != nil {
+		return nil, ErrInvalidToken
+	}
+	return &claims, nil
+}
+
+// generateRandomToken returns a URL-safe random string built from size random bytes
+func generateRandomToken(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the hex encoded SHA-256 of an opaque token, which is what gets persisted
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
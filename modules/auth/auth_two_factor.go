@@ -0,0 +1,331 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/irvanherz/gourze/modules/auth/dto"
+	"github.com/irvanherz/gourze/modules/user"
+	"github.com/jinzhu/copier"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"gorm.io/gorm"
+)
+
+const (
+	twoFactorChallengeTTL = 5 * time.Minute
+	twoFactorPeriod       = 30
+	recoveryCodeCount     = 10
+)
+
+var (
+	ErrInvalidTwoFactorCode    = errors.New("invalid two-factor code")
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnrolled    = errors.New("two-factor authentication is not enrolled")
+	ErrTwoFactorRequired       = errors.New("two-factor authentication is mandatory for this account")
+)
+
+// EnrollTwoFactor implements AuthService. It (re)generates a pending TOTP secret that
+// only takes effect once confirmed with ActivateTwoFactor.
+func (s *authService) EnrollTwoFactor(input dto.AuthTwoFactorEnrollInput, userID uint) (*dto.AuthTwoFactorEnrollmentDto, error) {
+	user, err := s.resolveTwoFactorUser(input.ChallengeToken, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var credential TwoFactorCredential
+	err = s.Db.Where("user_id = ?", user.ID).First(&credential).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if credential.EnabledAt != nil {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      s.twoFactorIssuer(),
+		AccountName: user.Email,
+		Period:      twoFactorPeriod,
+		Digits:      otp.DigitsSix,
+		Algorithm:   otp.AlgorithmSHA1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	credential.UserID = user.ID
+	credential.Secret = key.Secret()
+	credential.LastUsedStep = 0
+	if err := s.Db.Save(&credential).Error; err != nil {
+		return nil, err
+	}
+	return &dto.AuthTwoFactorEnrollmentDto{
+		Secret:     key.Secret(),
+		OtpauthURI: key.URL(),
+	}, nil
+}
+
+// ActivateTwoFactor implements AuthService. It confirms the pending enrollment with a first
+// code and returns fresh recovery codes. When the enrollment was started with a challenge
+// token, the signin is completed as well.
+func (s *authService) ActivateTwoFactor(input dto.AuthTwoFactorActivateInput, userID uint) (*dto.AuthTwoFactorActivationDto, error) {
+	user, err := s.resolveTwoFactorUser(input.ChallengeToken, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var credential TwoFactorCredential
+	if err := s.Db.Where("user_id = ?", user.ID).First(&credential).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTwoFactorNotEnrolled
+		}
+		return nil, err
+	}
+	if credential.EnabledAt != nil {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	var recoveryCodes []string
+	err = s.Db.Transaction(func(tx *gorm.DB) error {
+		if err := s.useTotpCode(tx, &credential, input.Code); err != nil {
+			return err
+		}
+		if err := tx.Model(&credential).Update("enabled_at", time.Now()).Error; err != nil {
+			return err
+		}
+		recoveryCodes, err = s.regenerateRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &dto.AuthTwoFactorActivationDto{RecoveryCodes: recoveryCodes}
+	if input.ChallengeToken != "" {
+		if result.Auth, err = s.startSession(*user); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// VerifyTwoFactor implements AuthService. It completes a signin started by Signin using a TOTP or recovery code.
+func (s *authService) VerifyTwoFactor(input dto.AuthTwoFactorVerifyInput) (*dto.AuthResultDto, error) {
+	userID, err := s.parseTwoFactorChallenge(input.ChallengeToken)
+	if err != nil {
+		return nil, err
+	}
+	var user user.User
+	if err := s.Db.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	var credential TwoFactorCredential
+	if err := s.Db.Where("user_id = ? AND enabled_at IS NOT NULL", user.ID).First(&credential).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTwoFactorNotEnrolled
+		}
+		return nil, err
+	}
+	// Second factor guesses count towards the same lockout as password guesses
+	accountKey := signinThrottleKey("user", user.ID)
+	if err := s.checkSigninThrottle(accountKey); err != nil {
+		return nil, err
+	}
+	if input.RecoveryCode != "" {
+		err = s.useRecoveryCode(s.Db, user.ID, input.RecoveryCode)
+	} else {
+		err = s.useTotpCode(s.Db, &credential, input.Code)
+	}
+	if errors.Is(err, ErrInvalidTwoFactorCode) {
+		if err := s.recordSigninFailure(accountKey, s.signinMaxAttempts()); err != nil {
+			return nil, err
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.resetSigninThrottle(accountKey); err != nil {
+		return nil, err
+	}
+
+	return s.startSession(user)
+}
+
+// DisableTwoFactor implements AuthService.
+func (s *authService) DisableTwoFactor(userID uint, input dto.AuthTwoFactorDisableInput) error {
+	var user user.User
+	if err := s.Db.First(&user, userID).Error; err != nil {
+		return err
+	}
+	if s.isTwoFactorRequired(user) {
+		return ErrTwoFactorRequired
+	}
+	var credential TwoFactorCredential
+	if err := s.Db.Where("user_id = ? AND enabled_at IS NOT NULL", user.ID).First(&credential).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrTwoFactorNotEnrolled
+		}
+		return err
+	}
+	return s.Db.Transaction(func(tx *gorm.DB) error {
+		if err := s.useTotpCode(tx, &credential, input.Code); err != nil {
+			if err := s.useRecoveryCode(tx, user.ID, input.Code); err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&credential).Error
+	})
+}
+
+// twoFactorChallenge returns the partial signin result for users that must pass a second factor, or nil
+func (s *authService) twoFactorChallenge(user user.User) (*dto.AuthResultDto, error) {
+	var count int64
+	if err := s.Db.Model(&TwoFactorCredential{}).Where("user_id = ? AND enabled_at IS NOT NULL", user.ID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	enabled := count > 0
+	if !enabled && !s.isTwoFactorRequired(user) {
+		return nil, nil
+	}
+
+	now := time.Now()
+	challengeToken, err := signClaims(s.Config, s.KeyManager, &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.FormatUint(uint64(user.ID), 10),
+			ExpiresAt: jwt.NewNumericDate(now.Add(twoFactorChallengeTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+		Type: twoFactorChallengeType,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var authUser dto.AuthUser
+	copier.Copy(&authUser, &user)
+	return &dto.AuthResultDto{
+		User:                        authUser,
+		TwoFactorRequired:           true,
+		TwoFactorEnrollmentRequired: !enabled,
+		ChallengeToken:              challengeToken,
+	}, nil
+}
+
+func (s *authService) parseTwoFactorChallenge(challengeToken string) (uint, error) {
+	claims, err := parseClaims(s.Config, s.KeyManager, challengeToken, twoFactorChallengeType)
+	if err != nil {
+		return 0, err
+	}
+	return claims.UserID()
+}
+
+// resolveTwoFactorUser returns the signed in user, or the user of the challenge token when not signed in
+func (s *authService) resolveTwoFactorUser(challengeToken string, userID uint) (*user.User, error) {
+	if userID == 0 {
+		var err error
+		if userID, err = s.parseTwoFactorChallenge(challengeToken); err != nil {
+			return nil, err
+		}
+	}
+	var user user.User
+	if err := s.Db.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *authService) twoFactorIssuer() string {
+	if s.Config.Auth.TwoFactorIssuer == "" {
+		return "Gourze"
+	}
+	return s.Config.Auth.TwoFactorIssuer
+}
+
+func (s *authService) isTwoFactorRequired(user user.User) bool {
+	return slices.Contains(s.Config.Auth.TwoFactorRequiredRoles, string(user.Role))
+}
+
+// useTotpCode validates a TOTP code, allowing one step of clock drift, and rejects codes
+// from a time step that was already used to prevent replays
+func (s *authService) useTotpCode(tx *gorm.DB, credential *TwoFactorCredential, code string) error {
+	now := time.Now()
+	currentStep := now.Unix() / twoFactorPeriod
+	for _, step := range []int64{currentStep - 1, currentStep, currentStep + 1} {
+		if step <= credential.LastUsedStep {
+			continue
+		}
+		expected, err := totp.GenerateCodeCustom(credential.Secret, time.Unix(step*twoFactorPeriod, 0), totp.ValidateOpts{
+			Period:    twoFactorPeriod,
+			Digits:    otp.DigitsSix,
+			Algorithm: otp.AlgorithmSHA1,
+		})
+		if err != nil {
+			return err
+		}
+		if expected != strings.TrimSpace(code) {
+			continue
+		}
+		result := tx.Model(&TwoFactorCredential{}).
+			Where("id = ? AND last_used_step < ?", credential.ID, step).
+			Update("last_used_step", step)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidTwoFactorCode
+		}
+		credential.LastUsedStep = step
+		return nil
+	}
+	return ErrInvalidTwoFactorCode
+}
+
+func (s *authService) useRecoveryCode(tx *gorm.DB, userID uint, code string) error {
+	codeHash := hashToken(normalizeRecoveryCode(code))
+	result := tx.Model(&RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// regenerateRecoveryCodes replaces all recovery codes of a user and returns the new plain codes
+func (s *authService) regenerateRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	codes := make([]string, recoveryCodeCount)
+	records := make([]RecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 6)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))
+		codes[i] = fmt.Sprintf("%s-%s", code[:5], code[5:])
+		records[i] = RecoveryCode{UserID: userID, CodeHash: hashToken(normalizeRecoveryCode(codes[i]))}
+	}
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
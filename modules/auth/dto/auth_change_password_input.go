@@ -0,0 +1,9 @@
+package dto
+
+type AuthChangePasswordInput struct {
+	// ChallengeToken lets users who must change their password before they can sign in do so
+	ChallengeToken  string `json:"challengeToken"`
+	CurrentPassword string `json:"currentPassword" binding:"required"`
+	NewPassword     string `json:"newPassword" binding:"required"`
+	SkipCookies     bool   `json:"skipCookies"`
+}
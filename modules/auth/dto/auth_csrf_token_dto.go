@@ -0,0 +1,5 @@
+package dto
+
+type AuthCSRFTokenDto struct {
+	CSRFToken string `json:"csrfToken"`
+}
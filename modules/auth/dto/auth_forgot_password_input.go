@@ -0,0 +1,5 @@
+package dto
+
+type AuthForgotPasswordInput struct {
+	Email string `json:"email" binding:"required,email"`
+}
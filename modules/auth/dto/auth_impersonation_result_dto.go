@@ -0,0 +1,9 @@
+package dto
+
+// AuthImpersonationResultDto is the short lived access token of an impersonation, it comes without a refresh token
+type AuthImpersonationResultDto struct {
+	AccessToken          string   `json:"accessToken"`
+	AccessTokenExpiredAt int64    `json:"accessTokenExpiredAt"`
+	User                 AuthUser `json:"user"`
+	ImpersonatorID       uint     `json:"impersonatorId"`
+}
@@ -0,0 +1,11 @@
+package dto
+
+type AuthMagicLinkInput struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type AuthMagicLinkConsumeInput struct {
+	Token string `form:"token" binding:"required"`
+	// SkipCookies returns the tokens in the response body only, for clients that cannot use cookies
+	SkipCookies bool `form:"skipCookies"`
+}
@@ -0,0 +1,17 @@
+package dto
+
+import "encoding/json"
+
+type AuthPasskeyRegisterInput struct {
+	ChallengeID string `json:"challengeId" binding:"required"`
+	Name        string `json:"name" binding:"max=255"`
+	// Credential is the PublicKeyCredential returned by navigator.credentials.create(), as JSON
+	Credential json.RawMessage `json:"credential" binding:"required"`
+}
+
+type AuthPasskeySigninInput struct {
+	ChallengeID string `json:"challengeId" binding:"required"`
+	// Credential is the PublicKeyCredential returned by navigator.credentials.get(), as JSON
+	Credential  json.RawMessage `json:"credential" binding:"required"`
+	SkipCookies bool            `json:"skipCookies"`
+}
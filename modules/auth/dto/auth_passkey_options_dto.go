@@ -0,0 +1,8 @@
+package dto
+
+type AuthPasskeyOptionsDto struct {
+	// ChallengeID identifies the ceremony when finishing it
+	ChallengeID string `json:"challengeId"`
+	// Options are passed as is to navigator.credentials.create() or get()
+	Options interface{} `json:"options"`
+}
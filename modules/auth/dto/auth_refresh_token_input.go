@@ -1,5 +1,6 @@
-package dto
-
-type AuthRefreshTokenInput struct {
-	RefreshToken string `json:"refreshToken" binding:"required"`
-}
+package dto
+
+type AuthRefreshTokenInput struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
+	SkipCookies  bool   `json:"skipCookies"`
+}
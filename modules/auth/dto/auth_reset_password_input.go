@@ -0,0 +1,6 @@
+package dto
+
+type AuthResetPasswordInput struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
@@ -1,18 +1,25 @@
-package dto
-
-import "github.com/irvanherz/gourze/modules/user"
-
-type AuthResultDto struct {
-	AccessToken          string   `json:"accessToken"`
-	RefreshToken         string   `json:"refreshToken"`
-	AccessTokenExpiredAt int64    `json:"accessTokenExpiredAt"`
-	User                 AuthUser `json:"user"`
-}
-
-type AuthUser struct {
-	ID       uint          `json:"id"`
-	Username string        `json:"username"`
-	Email    string        `json:"email"`
-	Role     user.UserRole `json:"role"`
-	FullName string        `json:"fullName"`
-}
+package dto
+
+import "github.com/irvanherz/gourze/modules/user"
+
+type AuthResultDto struct {
+	AccessToken           string   `json:"accessToken"`
+	RefreshToken          string   `json:"refreshToken"`
+	AccessTokenExpiredAt  int64    `json:"accessTokenExpiredAt"`
+	RefreshTokenExpiredAt int64    `json:"refreshTokenExpiredAt"`
+	User                  AuthUser `json:"user"`
+	// Set instead of the tokens when the signin must be completed with a second factor
+	TwoFactorRequired           bool `json:"twoFactorRequired,omitempty"`
+	TwoFactorEnrollmentRequired bool `json:"twoFactorEnrollmentRequired,omitempty"`
+	// Set instead of the tokens when the password must be changed before signing in
+	PasswordChangeRequired bool   `json:"passwordChangeRequired,omitempty"`
+	ChallengeToken         string `json:"challengeToken,omitempty"`
+}
+
+type AuthUser struct {
+	ID       uint          `json:"id"`
+	Username string        `json:"username"`
+	Email    string        `json:"email"`
+	Role     user.UserRole `json:"role"`
+	FullName string        `json:"fullName"`
+}
@@ -1,6 +1,10 @@
-package dto
-
-type AuthSigninInput struct {
-	UsernameOrEmail string `json:"usernameOrEmail" binding:"required"`
-	Password        string `json:"password" binding:"required"`
-}
+package dto
+
+type AuthSigninInput struct {
+	UsernameOrEmail string `json:"usernameOrEmail" binding:"required"`
+	Password        string `json:"password" binding:"required"`
+	// SkipCookies returns the tokens in the response body only, for clients that cannot use cookies
+	SkipCookies bool `json:"skipCookies"`
+	// IPAddress is the client address, filled in by the controller for brute-force protection
+	IPAddress string `json:"-"`
+}
@@ -0,0 +1,5 @@
+package dto
+
+type AuthSignoutInput struct {
+	RefreshToken string `json:"refreshToken"`
+}
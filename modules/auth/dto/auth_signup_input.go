@@ -1,8 +1,10 @@
-package dto
-
-type AuthSignupInput struct {
-	Username string `json:"username" binding:"required"`
-	Email    string `json:"email" binding:"required"`
-	FullName string `json:"fullName" binding:"required"`
-	Password string `json:"password" binding:"required"`
-}
+package dto
+
+type AuthSignupInput struct {
+	Username string `json:"username" binding:"required"`
+	Email    string `json:"email" binding:"required"`
+	FullName string `json:"fullName" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	// InviteCode is required when signups are invite only, see Config.Auth.SignupMode
+	InviteCode string `json:"inviteCode"`
+}
@@ -0,0 +1,23 @@
+package dto
+
+type AuthTwoFactorEnrollInput struct {
+	// ChallengeToken lets users who must enroll before they can sign in start the enrollment
+	ChallengeToken string `json:"challengeToken"`
+}
+
+type AuthTwoFactorActivateInput struct {
+	ChallengeToken string `json:"challengeToken"`
+	Code           string `json:"code" binding:"required"`
+	SkipCookies    bool   `json:"skipCookies"`
+}
+
+type AuthTwoFactorVerifyInput struct {
+	ChallengeToken string `json:"challengeToken" binding:"required"`
+	Code           string `json:"code" binding:"required_without=RecoveryCode"`
+	RecoveryCode   string `json:"recoveryCode" binding:"required_without=Code"`
+	SkipCookies    bool   `json:"skipCookies"`
+}
+
+type AuthTwoFactorDisableInput struct {
+	Code string `json:"code" binding:"required"`
+}
@@ -0,0 +1,12 @@
+package dto
+
+type AuthTwoFactorEnrollmentDto struct {
+	Secret     string `json:"secret"`
+	OtpauthURI string `json:"otpauthUri"`
+}
+
+type AuthTwoFactorActivationDto struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+	// Auth is set when the activation completed a signin started with a challenge token
+	Auth *AuthResultDto `json:"auth,omitempty"`
+}
@@ -0,0 +1,5 @@
+package dto
+
+type AuthVerifyEmailInput struct {
+	Token string `json:"token" binding:"required"`
+}
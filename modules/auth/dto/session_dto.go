@@ -0,0 +1,15 @@
+package dto
+
+import "time"
+
+type SessionDto struct {
+	ID         uint      `json:"id"`
+	Device     string    `json:"device"`
+	UserAgent  string    `json:"userAgent"`
+	IPAddress  string    `json:"ipAddress"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	CreatedAt  time.Time `json:"createdAt"`
+	// Current marks the session the request was made from
+	Current bool `json:"current"`
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/irvanherz/gourze/utils"
+	"gorm.io/gorm"
+)
+
+type SessionController interface {
+	FindManySessions(*gin.Context)
+	RevokeSession(*gin.Context)
+}
+
+type sessionController struct {
+	Service SessionService
+}
+
+func NewSessionController(service SessionService) SessionController {
+	return &sessionController{service}
+}
+
+func (sc *sessionController) FindManySessions(c *gin.Context) {
+	currentUser, err := utils.GetCurrentUser(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"code": "unauthorized", "message": "Unauthorized"})
+		return
+	}
+	sessions, err := sc.Service.FindManySessions(currentUser.ID, currentUser.SessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Success", "data": sessions})
+}
+
+// RevokeSession signs one of the current user's devices out
+func (sc *sessionController) RevokeSession(c *gin.Context) {
+	currentUser, err := utils.GetCurrentUser(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"code": "unauthorized", "message": "Unauthorized"})
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": "Invalid session ID"})
+		return
+	}
+	if err := sc.Service.RevokeSession(currentUser.ID, uint(id)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"code": "not-found", "message": "Session not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Session revoked"})
+}
@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/irvanherz/gourze/modules/auth/dto"
+	"github.com/jinzhu/copier"
+	"gorm.io/gorm"
+)
+
+// sessionTouchInterval limits how often the activity of a session is written to the database
+const sessionTouchInterval = time.Minute
+
+var ErrSessionRevoked = errors.New("session has been revoked")
+
+type SessionService interface {
+	// FindManySessions lists the active sessions of a user, flagging the one currentSessionID refers to
+	FindManySessions(userID uint, currentSessionID string) ([]dto.SessionDto, error)
+	// RevokeSession signs a device out: its refresh tokens stop working and its access tokens are rejected
+	RevokeSession(userID uint, sessionID uint) error
+	// Touch records the activity of the session a "sid" claim refers to, it fails with ErrSessionRevoked
+	// when the session was revoked. Tokens of sessions that were never recorded are let through.
+	Touch(familyID string, ipAddress string, userAgent string) error
+}
+
+type sessionService struct {
+	Db *gorm.DB
+}
+
+func NewSessionService(db *gorm.DB) SessionService {
+	return &sessionService{Db: db}
+}
+
+func (s *sessionService) FindManySessions(userID uint, currentSessionID string) ([]dto.SessionDto, error) {
+	var sessions []Session
+	err := s.Db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at desc").
+		Find(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+	result := make([]dto.SessionDto, len(sessions))
+	for i, session := range sessions {
+		copier.Copy(&result[i], &session)
+		result[i].Current = currentSessionID != "" && session.FamilyID == currentSessionID
+	}
+	return result, nil
+}
+
+func (s *sessionService) RevokeSession(userID uint, sessionID uint) error {
+	var session Session
+	if err := s.Db.Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).First(&session).Error; err != nil {
+		return err
+	}
+	return s.Db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Model(&session).Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Model(&RefreshToken{}).
+			Where("family_id = ? AND revoked_at IS NULL", session.FamilyID).
+			Update("revoked_at", now).Error
+	})
+}
+
+func (s *sessionService) Touch(familyID string, ipAddress string, userAgent string) error {
+	var session Session
+	if err := s.Db.Where("family_id = ?", familyID).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if session.RevokedAt != nil {
+		return ErrSessionRevoked
+	}
+	if time.Since(session.LastSeenAt) < sessionTouchInterval && session.IPAddress == ipAddress && session.UserAgent == userAgent {
+		return nil
+	}
+	return s.Db.Model(&session).Updates(map[string]interface{}{
+		"last_seen_at": time.Now(),
+		"ip_address":   ipAddress,
+		"user_agent":   truncate(userAgent, 512),
+		"device":       describeDevice(userAgent),
+	}).Error
+}
+
+// describeDevice turns a user agent into a short label such as "Chrome on macOS"
+func describeDevice(userAgent string) string {
+	var browser, os string
+	switch {
+	case strings.Contains(userAgent, "Edg/"):
+		browser = "Edge"
+	case strings.Contains(userAgent, "OPR/"):
+		browser = "Opera"
+	case strings.Contains(userAgent, "Firefox/"):
+		browser = "Firefox"
+	case strings.Contains(userAgent, "Chrome/"):
+		browser = "Chrome"
+	case strings.Contains(userAgent, "Safari/"):
+		browser = "Safari"
+	}
+	switch {
+	case strings.Contains(userAgent, "iPhone"), strings.Contains(userAgent, "iPad"):
+		os = "iOS"
+	case strings.Contains(userAgent, "Android"):
+		os = "Android"
+	case strings.Contains(userAgent, "Windows"):
+		os = "Windows"
+	case strings.Contains(userAgent, "Mac OS X"):
+		os = "macOS"
+	case strings.Contains(userAgent, "Linux"):
+		os = "Linux"
+	}
+	switch {
+	case browser != "" && os != "":
+		return browser + " on " + os
+	case browser != "" || os != "":
+		return browser + os
+	case userAgent != "":
+		return truncate(userAgent, 255)
+	default:
+		return "Unknown device"
+	}
+}
+
+func truncate(value string, size int) string {
+	if len(value) > size {
+		return value[:size]
+	}
+	return value
+}
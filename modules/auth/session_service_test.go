@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/irvanherz/gourze/config"
+	"github.com/irvanherz/gourze/modules/auth/dto"
+	"github.com/irvanherz/gourze/modules/invite"
+	"github.com/irvanherz/gourze/modules/password"
+	"github.com/irvanherz/gourze/modules/user"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+)
+
+type SessionServiceTestSuite struct {
+	suite.Suite
+	db          *gorm.DB
+	authService AuthService
+	service     SessionService
+}
+
+func (suite *SessionServiceTestSuite) SetupTest() {
+	suite.db = setupTestDB()
+	conf := &config.Config{Auth: config.AuthConfig{JWTSecret: "testsecret"}}
+	suite.authService = NewAuthService(suite.db, conf, NewMemoryRevocationStore(), &fakeMailer{}, NewKeyManager(suite.db, conf), NewDatabaseAuditLogger(suite.db), password.NewPasswordPolicy(conf, password.NewBreachedPasswordChecker(conf)), invite.NewInviteService(suite.db))
+	suite.service = NewSessionService(suite.db)
+	suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com"})
+	suite.db.Create(&user.User{Username: "jane_doe", Email: "jane@doe.com"})
+}
+
+func (suite *SessionServiceTestSuite) TestFindManySessions() {
+	laptop, _ := suite.authService.IssueTokens(user.User{ID: 1})
+	suite.authService.IssueTokens(user.User{ID: 1})
+	suite.authService.IssueTokens(user.User{ID: 2})
+
+	var session Session
+	suite.db.Order("id").First(&session)
+	suite.NoError(suite.service.Touch(session.FamilyID, "10.0.0.1", "Mozilla/5.0 (Macintosh; Intel Mac OS X 14_0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36"))
+
+	sessions, err := suite.service.FindManySessions(1, session.FamilyID)
+	suite.NoError(err)
+	suite.Len(sessions, 2)
+	suite.Equal(session.ID, sessions[0].ID)
+	suite.True(sessions[0].Current)
+	suite.False(sessions[1].Current)
+	suite.Equal("Chrome on macOS", sessions[0].Device)
+	suite.Equal("10.0.0.1", sessions[0].IPAddress)
+
+	// Refreshing keeps the session and extends it
+	refreshed, err := suite.authService.Refresh(dto.AuthRefreshTokenInput{RefreshToken: laptop.RefreshToken})
+	suite.NoError(err)
+	suite.NotEmpty(refreshed.AccessToken)
+	sessions, _ = suite.service.FindManySessions(1, "")
+	suite.Len(sessions, 2)
+}
+
+func (suite *SessionServiceTestSuite) TestRevokeSession() {
+	result, _ := suite.authService.IssueTokens(user.User{ID: 1})
+	var session Session
+	suite.db.First(&session)
+
+	suite.ErrorIs(suite.service.RevokeSession(2, session.ID), gorm.ErrRecordNotFound)
+	suite.NoError(suite.service.RevokeSession(1, session.ID))
+	suite.ErrorIs(suite.service.RevokeSession(1, session.ID), gorm.ErrRecordNotFound)
+
+	suite.ErrorIs(suite.service.Touch(session.FamilyID, "", ""), ErrSessionRevoked)
+	_, err := suite.authService.Refresh(dto.AuthRefreshTokenInput{RefreshToken: result.RefreshToken})
+	suite.Error(err)
+	sessions, _ := suite.service.FindManySessions(1, "")
+	suite.Empty(sessions)
+}
+
+func (suite *SessionServiceTestSuite) TestSignoutRevokesSessions() {
+	result, _ := suite.authService.IssueTokens(user.User{ID: 1})
+	suite.authService.IssueTokens(user.User{ID: 1})
+
+	suite.NoError(suite.authService.Signout("", time.Time{}, result.RefreshToken))
+	sessions, _ := suite.service.FindManySessions(1, "")
+	suite.Len(sessions, 1)
+
+	suite.NoError(suite.authService.SignoutAll(1))
+	sessions, _ = suite.service.FindManySessions(1, "")
+	suite.Empty(sessions)
+}
+
+func (suite *SessionServiceTestSuite) TestTouch_UnknownSession() {
+	// Tokens issued before sessions were recorded keep working
+	suite.NoError(suite.service.Touch("unknown", "", ""))
+}
+
+func (suite *SessionServiceTestSuite) TestDescribeDevice() {
+	suite.Equal("Safari on iOS", describeDevice("Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1"))
+	suite.Equal("Firefox on Linux", describeDevice("Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0"))
+	suite.Equal("curl/8.4.0", describeDevice("curl/8.4.0"))
+	suite.Equal("Unknown device", describeDevice(""))
+}
+
+func TestSessionServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(SessionServiceTestSuite))
+}
@@ -1,128 +1,204 @@
-package course
-
-import (
-	"net/http"
-	"strconv"
-
-	"github.com/gin-gonic/gin"
-	"github.com/irvanherz/gourze/modules/course/dto"
-	"github.com/irvanherz/gourze/modules/user"
-	"github.com/irvanherz/gourze/utils"
-)
-
-type CourseController interface {
-	FindManyCourses(*gin.Context)
-	FindCourseByID(*gin.Context)
-	CreateCourse(*gin.Context)
-	UpdateCourseByID(*gin.Context)
-	DeleteCourseByID(*gin.Context)
-}
-
-type courseController struct {
-	Service CourseService
-}
-
-func NewCourseController(service CourseService) CourseController {
-	return &courseController{service}
-}
-
-func (cc *courseController) FindManyCourses(c *gin.Context) {
-	var filter dto.CourseFilterInput
-	if err := c.ShouldBindQuery(&filter); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
-		return
-	}
-	courses, count, err := cc.Service.FindManyCourses(&filter)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
-		return
-	}
-	page := filter.Page
-	take := filter.Take
-	numPages := (count + int64(take) - 1) / int64(take)
-
-	c.JSON(http.StatusOK, gin.H{
-		"code":    "ok",
-		"message": "Success",
-		"data":    courses,
-		"meta": gin.H{
-			"numItems": count,
-			"page":     page,
-			"numPages": numPages,
-			"take":     take,
-		},
-	})
-}
-
-func (cc *courseController) CreateCourse(c *gin.Context) {
-	var input dto.CourseCreateInput
-	currentUser, _ := utils.GetCurrentUser(c)
-	if input.UserID == 0 {
-		input.UserID = currentUser.ID
-	}
-
-	if input.UserID != currentUser.ID && (currentUser.Role != user.Super && currentUser.Role != user.Admin) {
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"code": "unauthorized", "message": "Unauthorized"})
-		return
-	}
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
-		return
-	}
-	course, err := cc.Service.CreateCourse(&input)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
-		return
-	}
-	c.JSON(http.StatusCreated, gin.H{"code": "ok", "message": "Course created successfully", "data": course})
-}
-
-func (cc *courseController) FindCourseByID(c *gin.Context) {
-	id := c.Param("id")
-	uid, err := strconv.ParseUint(id, 10, 32)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": "Invalid course ID"})
-		return
-	}
-	course, err := cc.Service.FindCourseByID(uint(uid))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
-		return
-	}
-	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Success", "data": course})
-}
-
-func (cc *courseController) UpdateCourseByID(c *gin.Context) {
-	var input dto.CourseUpdateInput
-	id := c.Param("id")
-	uid, err := strconv.ParseUint(id, 10, 32)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": "Invalid course ID"})
-		return
-	}
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
-		return
-	}
-	course, err := cc.Service.UpdateCourseByID(uint(uid), &input)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
-		return
-	}
-	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Course updated successfully", "data": course})
-}
-
-func (cc *courseController) DeleteCourseByID(c *gin.Context) {
-	id := c.Param("id")
-	uid, err := strconv.ParseUint(id, 10, 32)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": "Invalid course ID"})
-		return
-	}
-	course, err := cc.Service.DeleteCourseByID(uint(uid))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
-		return
-	}
-	c.JSON(http.StatusNoContent, gin.H{"code": "ok", "message": "Course deleted successfully", "data": course})
-}
+package course
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/irvanherz/gourze/modules/course/dto"
+	"github.com/irvanherz/gourze/modules/rbac"
+	"github.com/irvanherz/gourze/utils"
+	"gorm.io/gorm"
+)
+
+type CourseController interface {
+	FindManyCourses(*gin.Context)
+	FindCourseByID(*gin.Context)
+	CreateCourse(*gin.Context)
+	UpdateCourseByID(*gin.Context)
+	DeleteCourseByID(*gin.Context)
+	PublishCourse(*gin.Context)
+	AddCoOwner(*gin.Context)
+	RemoveCoOwner(*gin.Context)
+}
+
+type courseController struct {
+	Service CourseService
+}
+
+func NewCourseController(service CourseService) CourseController {
+	return &courseController{service}
+}
+
+func (cc *courseController) FindManyCourses(c *gin.Context) {
+	var filter dto.CourseFilterInput
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
+		return
+	}
+	courses, count, err := cc.Service.FindManyCourses(viewer(c), &filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+		return
+	}
+	page := filter.Page
+	take := filter.Take
+	numPages := (count + int64(take) - 1) / int64(take)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    "ok",
+		"message": "Success",
+		"data":    courses,
+		"meta": gin.H{
+			"numItems": count,
+			"page":     page,
+			"numPages": numPages,
+			"take":     take,
+		},
+	})
+}
+
+func (cc *courseController) CreateCourse(c *gin.Context) {
+	var input dto.CourseCreateInput
+	currentUser, _ := utils.GetCurrentUser(c)
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
+		return
+	}
+	course, err := cc.Service.CreateCourse(currentUser.Actor(), &input)
+	if err != nil {
+		respondCourseError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"code": "ok", "message": "Course created successfully", "data": course})
+}
+
+func (cc *courseController) FindCourseByID(c *gin.Context) {
+	id := c.Param("id")
+	uid, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": "Invalid course ID"})
+		return
+	}
+	course, err := cc.Service.FindCourseByID(viewer(c), uint(uid))
+	if err != nil {
+		respondCourseError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Success", "data": course})
+}
+
+func (cc *courseController) UpdateCourseByID(c *gin.Context) {
+	var input dto.CourseUpdateInput
+	id := c.Param("id")
+	uid, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": "Invalid course ID"})
+		return
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
+		return
+	}
+	currentUser, _ := utils.GetCurrentUser(c)
+	course, err := cc.Service.UpdateCourseByID(currentUser.Actor(), uint(uid), &input)
+	if err != nil {
+		respondCourseError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Course updated successfully", "data": course})
+}
+
+func (cc *courseController) DeleteCourseByID(c *gin.Context) {
+	id := c.Param("id")
+	uid, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": "Invalid course ID"})
+		return
+	}
+	currentUser, _ := utils.GetCurrentUser(c)
+	course, err := cc.Service.DeleteCourseByID(currentUser.Actor(), uint(uid))
+	if err != nil {
+		respondCourseError(c, err)
+		return
+	}
+	c.JSON(http.StatusNoContent, gin.H{"code": "ok", "message": "Course deleted successfully", "data": course})
+}
+
+// PublishCourse lists the course on the public profile of its owner and notifies their followers
+func (cc *courseController) PublishCourse(c *gin.Context) {
+	uid, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": "Invalid course ID"})
+		return
+	}
+	currentUser, _ := utils.GetCurrentUser(c)
+	course, err := cc.Service.PublishCourse(currentUser.Actor(), uint(uid))
+	if err != nil {
+		respondCourseError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Course published successfully", "data": course})
+}
+
+func (cc *courseController) AddCoOwner(c *gin.Context) {
+	var input dto.CourseCoOwnerCreateInput
+	uid, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": "Invalid course ID"})
+		return
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
+		return
+	}
+	currentUser, _ := utils.GetCurrentUser(c)
+	coOwner, err := cc.Service.AddCoOwner(currentUser.Actor(), uint(uid), &input)
+	if err != nil {
+		respondCourseError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"code": "ok", "message": "Co-owner added successfully", "data": coOwner})
+}
+
+func (cc *courseController) RemoveCoOwner(c *gin.Context) {
+	uid, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": "Invalid course ID"})
+		return
+	}
+	userID, err := strconv.ParseUint(c.Param("userId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": "Invalid user ID"})
+		return
+	}
+	currentUser, _ := utils.GetCurrentUser(c)
+	if err := cc.Service.RemoveCoOwner(currentUser.Actor(), uint(uid), uint(userID)); err != nil {
+		respondCourseError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Co-owner removed successfully"})
+}
+
+func respondCourseError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"code": "not-found", "message": err.Error()})
+	case errors.Is(err, rbac.ErrForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"code": "forbidden", "message": err.Error()})
+	case errors.Is(err, ErrNotInstructor):
+		c.JSON(http.StatusForbidden, gin.H{"code": "instructor-required", "message": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+	}
+}
+
+// viewer returns the actor of the signed in user, or the zero Actor for guests
+func viewer(c *gin.Context) rbac.Actor {
+	currentUser, err := utils.GetCurrentUser(c)
+	if err != nil {
+		return rbac.Actor{}
+	}
+	return currentUser.Actor()
+}
@@ -1,11 +1,11 @@
-package course
-
-import "go.uber.org/fx"
-
-// Module exports dependencies for the course module
-var Module = fx.Module("course",
-	fx.Provide(NewCourseService),
-	fx.Provide(NewCourseController),
-	fx.Provide(NewCategoryService),
-	fx.Provide(NewCategoryController),
-)
+package course
+
+import "go.uber.org/fx"
+
+// Module exports dependencies for the course module
+var Module = fx.Module("course",
+	fx.Provide(NewCourseService),
+	fx.Provide(NewCourseController),
+	fx.Provide(NewCategoryService),
+	fx.Provide(NewCategoryController),
+)
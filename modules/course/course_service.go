@@ -1,87 +1,228 @@
-package course
-
-import (
-	"github.com/creasty/defaults"
-	"github.com/irvanherz/gourze/modules/course/dto"
-	"github.com/jinzhu/copier"
-	"gorm.io/gorm"
-)
-
-type CourseService interface {
-	FindManyCourses(filter *dto.CourseFilterInput) ([]Course, int64, error)
-	CreateCourse(input *dto.CourseCreateInput) (*Course, error)
-	FindCourseByID(id uint) (*Course, error)
-	UpdateCourseByID(id uint, input *dto.CourseUpdateInput) (*Course, error)
-	DeleteCourseByID(id uint) (*Course, error)
-}
-
-type courseService struct {
-	Db *gorm.DB
-}
-
-func NewCourseService(db *gorm.DB) CourseService {
-	return &courseService{Db: db}
-}
-
-func (s *courseService) FindManyCourses(filter *dto.CourseFilterInput) ([]Course, int64, error) {
-	var courses []Course
-	var count int64
-
-	if err := defaults.Set(filter); err != nil {
-		return nil, 0, err
-	}
-	query := s.Db
-	query = filter.ApplyFilter(query)
-
-	if err := query.Model(&Course{}).Count(&count).Error; err != nil {
-		return nil, 0, err
-	}
-
-	query = filter.ApplyPagination(query)
-
-	if err := query.Preload("User").Preload("Category").Find(&courses).Error; err != nil {
-		return nil, 0, err
-	}
-	return courses, count, nil
-}
-
-func (s *courseService) CreateCourse(input *dto.CourseCreateInput) (*Course, error) {
-	var course Course
-	copier.Copy(&course, &input)
-
-	if err := s.Db.Preload("User").Preload("Category").Create(&course).Error; err != nil {
-		return nil, err
-	}
-	return &course, nil
-}
-
-func (s *courseService) FindCourseByID(id uint) (*Course, error) {
-	var course Course
-	if err := s.Db.Preload("User").Preload("Category").First(&course, id).Error; err != nil {
-		return nil, err
-	}
-	return &course, nil
-}
-
-func (s *courseService) UpdateCourseByID(id uint, input *dto.CourseUpdateInput) (*Course, error) {
-	var course Course
-	if err := s.Db.First(&course, id).Error; err != nil {
-		return nil, err
-	}
-	copier.Copy(&course, &input)
-	if err := s.Db.Preload("User").Preload("Category").Save(&course).Error; err != nil {
-		return nil, err
-	}
-	return &course, nil
-}
-
-func (s *courseService) DeleteCourseByID(id uint) (*Course, error) {
-	var course Course
-	if err := s.Db.First(&course, id).Error; err != nil {
-		return nil, err
-	}
-	if err := s.Db.Preload("User").Preload("Category").Delete(&Course{}, id).Error; err != nil {
-		return nil, err
-	}
-	return &course, nil
-}
+package course
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/creasty/defaults"
+	"github.com/irvanherz/gourze/modules/course/dto"
+	"github.com/irvanherz/gourze/modules/follow"
+	"github.com/irvanherz/gourze/modules/rbac"
+	"github.com/irvanherz/gourze/modules/user"
+	"github.com/jinzhu/copier"
+	"gorm.io/gorm"
+)
+
+var ErrNotInstructor = errors.New("only instructors can create courses, apply to become one first")
+
+// CourseService lets owners and co-owners edit their courses. Deleting, publishing a course and managing
+// its co-owners is left to the owner. Users holding course:manage may do all of it on any course but
+// publishing, which needs course:publish. Unpublished courses are only shown to their owners, co-owners
+// and users holding course:manage, guests are passed as the zero Actor.
+type CourseService interface {
+	FindManyCourses(actor rbac.Actor, filter *dto.CourseFilterInput) ([]Course, int64, error)
+	CreateCourse(actor rbac.Actor, input *dto.CourseCreateInput) (*Course, error)
+	FindCourseByID(actor rbac.Actor, id uint) (*Course, error)
+	UpdateCourseByID(actor rbac.Actor, id uint, input *dto.CourseUpdateInput) (*Course, error)
+	DeleteCourseByID(actor rbac.Actor, id uint) (*Course, error)
+	PublishCourse(actor rbac.Actor, id uint) (*Course, error)
+	AddCoOwner(actor rbac.Actor, id uint, input *dto.CourseCoOwnerCreateInput) (*CourseCoOwner, error)
+	RemoveCoOwner(actor rbac.Actor, id uint, userID uint) error
+}
+
+type courseService struct {
+	Db            *gorm.DB
+	Policy        rbac.Policy
+	FollowService follow.FollowService
+}
+
+func NewCourseService(db *gorm.DB, policy rbac.Policy, followService follow.FollowService) CourseService {
+	return &courseService{Db: db, Policy: policy, FollowService: followService}
+}
+
+func (s *courseService) FindManyCourses(actor rbac.Actor, filter *dto.CourseFilterInput) ([]Course, int64, error) {
+	var courses []Course
+	var count int64
+
+	if err := defaults.Set(filter); err != nil {
+		return nil, 0, err
+	}
+	query, err := s.visibleCourses(actor)
+	if err != nil {
+		return nil, 0, err
+	}
+	query = filter.ApplyFilter(query)
+
+	if err := query.Model(&Course{}).Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+
+	query = filter.ApplyPagination(query)
+
+	if err := query.Preload("User").Preload("Category").Find(&courses).Error; err != nil {
+		return nil, 0, err
+	}
+	return courses, count, nil
+}
+
+// CreateCourse implements CourseService. Only instructors, whose application was approved, and admins
+// hold course:create.
+func (s *courseService) CreateCourse(actor rbac.Actor, input *dto.CourseCreateInput) (*Course, error) {
+	if err := s.Policy.Authorize(actor, rbac.CourseCreate); err != nil {
+		if errors.Is(err, rbac.ErrForbidden) {
+			return nil, ErrNotInstructor
+		}
+		return nil, err
+	}
+	// Creating a course on behalf of someone else needs course:manage
+	if input.UserID == 0 {
+		input.UserID = actor.ID
+	}
+	if err := s.Policy.Authorize(actor, rbac.CourseManage, input.UserID); err != nil {
+		return nil, err
+	}
+	var course Course
+	copier.Copy(&course, &input)
+
+	if err := s.Db.Preload("User").Preload("Category").Create(&course).Error; err != nil {
+		return nil, err
+	}
+	return &course, nil
+}
+
+func (s *courseService) FindCourseByID(actor rbac.Actor, id uint) (*Course, error) {
+	var course Course
+	if err := s.Db.Preload("User").Preload("Category").Preload("CoOwners.User").First(&course, id).Error; err != nil {
+		return nil, err
+	}
+	if course.PublishedAt == nil {
+		if err := s.Policy.Authorize(actor, rbac.CourseManage, ownerIDs(course)...); err != nil {
+			if errors.Is(err, rbac.ErrForbidden) {
+				// Unpublished courses don't exist for anybody else
+				return nil, gorm.ErrRecordNotFound
+			}
+			return nil, err
+		}
+	}
+	return &course, nil
+}
+
+func (s *courseService) UpdateCourseByID(actor rbac.Actor, id uint, input *dto.CourseUpdateInput) (*Course, error) {
+	var course Course
+	if err := s.Db.Preload("CoOwners").First(&course, id).Error; err != nil {
+		return nil, err
+	}
+	if err := s.Policy.Authorize(actor, rbac.CourseManage, ownerIDs(course)...); err != nil {
+		return nil, err
+	}
+	copier.Copy(&course, &input)
+	if err := s.Db.Preload("User").Preload("Category").Save(&course).Error; err != nil {
+		return nil, err
+	}
+	return &course, nil
+}
+
+func (s *courseService) DeleteCourseByID(actor rbac.Actor, id uint) (*Course, error) {
+	var course Course
+	if err := s.Db.First(&course, id).Error; err != nil {
+		return nil, err
+	}
+	if err := s.Policy.Authorize(actor, rbac.CourseManage, course.UserID); err != nil {
+		return nil, err
+	}
+	if err := s.Db.Preload("User").Preload("Category").Delete(&Course{}, id).Error; err != nil {
+		return nil, err
+	}
+	return &course, nil
+}
+
+// PublishCourse implements CourseService. Followers of the owner are emailed in the background the
+// first time a course is published, publishing it again changes nothing.
+func (s *courseService) PublishCourse(actor rbac.Actor, id uint) (*Course, error) {
+	var course Course
+	if err := s.Db.First(&course, id).Error; err != nil {
+		return nil, err
+	}
+	if err := s.Policy.Authorize(actor, rbac.CoursePublish, course.UserID); err != nil {
+		return nil, err
+	}
+	if course.PublishedAt == nil {
+		now := time.Now()
+		// Guard against publishing twice at the same time, which would notify followers twice
+		result := s.Db.Model(&Course{}).Where("id = ? AND published_at IS NULL", id).Update("published_at", now)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected > 0 {
+			// The course is published either way, followers missing out on the email isn't worth failing for
+			go func() {
+				if err := s.FollowService.NotifyCoursePublished(course.UserID, course.ID, course.Name); err != nil {
+					fmt.Println("Failed to notify followers:", err)
+				}
+			}()
+		}
+	}
+	return s.FindCourseByID(actor, id)
+}
+
+func (s *courseService) AddCoOwner(actor rbac.Actor, id uint, input *dto.CourseCoOwnerCreateInput) (*CourseCoOwner, error) {
+	var course Course
+	if err := s.Db.First(&course, id).Error; err != nil {
+		return nil, err
+	}
+	if err := s.Policy.Authorize(actor, rbac.CourseManage, course.UserID); err != nil {
+		return nil, err
+	}
+	var coOwner user.User
+	if err := s.Db.First(&coOwner, input.UserID).Error; err != nil {
+		return nil, err
+	}
+	courseCoOwner := CourseCoOwner{CourseID: course.ID, UserID: coOwner.ID}
+	if err := s.Db.Where(&courseCoOwner).FirstOrCreate(&courseCoOwner).Error; err != nil {
+		return nil, err
+	}
+	courseCoOwner.User = coOwner
+	return &courseCoOwner, nil
+}
+
+func (s *courseService) RemoveCoOwner(actor rbac.Actor, id uint, userID uint) error {
+	var course Course
+	if err := s.Db.First(&course, id).Error; err != nil {
+		return err
+	}
+	if err := s.Policy.Authorize(actor, rbac.CourseManage, course.UserID); err != nil {
+		return err
+	}
+	result := s.Db.Where("course_id = ? AND user_id = ?", course.ID, userID).Delete(&CourseCoOwner{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// visibleCourses restricts the courses to the published ones and those the actor owns or co-owns,
+// unless the actor holds course:manage
+func (s *courseService) visibleCourses(actor rbac.Actor) (*gorm.DB, error) {
+	err := s.Policy.Authorize(actor, rbac.CourseManage)
+	if err == nil {
+		return s.Db, nil
+	}
+	if !errors.Is(err, rbac.ErrForbidden) {
+		return nil, err
+	}
+	coOwned := s.Db.Model(&CourseCoOwner{}).Select("course_id").Where("user_id = ?", actor.ID)
+	return s.Db.Where("(published_at IS NOT NULL OR user_id = ? OR id IN (?))", actor.ID, coOwned), nil
+}
+
+// ownerIDs lists the owner and co-owners of course, whose CoOwners must be loaded
+func ownerIDs(course Course) []uint {
+	ids := []uint{course.UserID}
+	for _, coOwner := range course.CoOwners {
+		ids = append(ids, coOwner.UserID)
+	}
+	return ids
+}
@@ -0,0 +1,166 @@
+package course
+
+import (
+	"testing"
+	"time"
+
+	"github.com/irvanherz/gourze/modules/course/dto"
+	"github.com/irvanherz/gourze/modules/follow"
+	"github.com/irvanherz/gourze/modules/rbac"
+	"github.com/irvanherz/gourze/modules/user"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// fakeFollowService passes on the courses followers are notified of, which happens in the background
+type fakeFollowService struct {
+	follow.FollowService
+	notified chan uint
+}
+
+func (s *fakeFollowService) NotifyCoursePublished(instructorID uint, courseID uint, courseName string) error {
+	s.notified <- courseID
+	return nil
+}
+
+type CourseServiceTestSuite struct {
+	suite.Suite
+	db            *gorm.DB
+	followService *fakeFollowService
+	service       CourseService
+	owner         rbac.Actor
+	other         rbac.Actor
+	admin         rbac.Actor
+}
+
+func (suite *CourseServiceTestSuite) SetupTest() {
+	suite.db, _ = gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	suite.db.AutoMigrate(&user.User{}, &Category{}, &Course{}, &CourseCoOwner{}, &rbac.Permission{}, &rbac.Role{})
+	rbac.SeedRoles(suite.db)
+	suite.followService = &fakeFollowService{notified: make(chan uint, 10)}
+	suite.service = NewCourseService(suite.db, rbac.NewPolicy(rbac.NewRbacService(suite.db)), suite.followService)
+
+	suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com"})
+	suite.db.Create(&user.User{Username: "jane_doe", Email: "jane@doe.com"})
+	suite.db.Create(&user.User{Username: "admin", Email: "admin@doe.com", Role: user.Admin})
+	suite.owner = rbac.Actor{ID: 1, Role: user.Generic}
+	suite.other = rbac.Actor{ID: 2, Role: user.Generic}
+	suite.admin = rbac.Actor{ID: 3, Role: user.Admin}
+	suite.db.Create(&Course{Name: "Go", UserID: 1})
+}
+
+func (suite *CourseServiceTestSuite) TestUpdateCourseByID_OwnersOnly() {
+	name := "Go 101"
+	_, err := suite.service.UpdateCourseByID(suite.other, 1, &dto.CourseUpdateInput{Name: &name})
+	suite.ErrorIs(err, rbac.ErrForbidden)
+
+	course, err := suite.service.UpdateCourseByID(suite.owner, 1, &dto.CourseUpdateInput{Name: &name})
+	suite.NoError(err)
+	suite.Equal("Go 101", course.Name)
+
+	_, err = suite.service.UpdateCourseByID(suite.admin, 1, &dto.CourseUpdateInput{Name: &name})
+	suite.NoError(err)
+}
+
+func (suite *CourseServiceTestSuite) TestCoOwner() {
+	_, err := suite.service.AddCoOwner(suite.other, 1, &dto.CourseCoOwnerCreateInput{UserID: 2})
+	suite.ErrorIs(err, rbac.ErrForbidden)
+	_, err = suite.service.AddCoOwner(suite.owner, 1, &dto.CourseCoOwnerCreateInput{UserID: 2})
+	suite.NoError(err)
+
+	// Co-owners edit the course but can't delete it
+	name := "Go 101"
+	_, err = suite.service.UpdateCourseByID(suite.other, 1, &dto.CourseUpdateInput{Name: &name})
+	suite.NoError(err)
+	_, err = suite.service.DeleteCourseByID(suite.other, 1)
+	suite.ErrorIs(err, rbac.ErrForbidden)
+
+	suite.NoError(suite.service.RemoveCoOwner(suite.owner, 1, 2))
+	_, err = suite.service.UpdateCourseByID(suite.other, 1, &dto.CourseUpdateInput{Name: &name})
+	suite.ErrorIs(err, rbac.ErrForbidden)
+}
+
+func (suite *CourseServiceTestSuite) TestCreateCourse_InstructorsOnly() {
+	_, err := suite.service.CreateCourse(suite.other, &dto.CourseCreateInput{Name: "Rust"})
+	suite.ErrorIs(err, ErrNotInstructor)
+
+	course, err := suite.service.CreateCourse(rbac.Actor{ID: 2, Role: user.Instructor}, &dto.CourseCreateInput{Name: "Rust"})
+	suite.NoError(err)
+	suite.Equal(uint(2), course.UserID)
+}
+
+func (suite *CourseServiceTestSuite) TestCreateCourse_OnBehalfOfOthers() {
+	instructor := rbac.Actor{ID: 2, Role: user.Instructor}
+	course, err := suite.service.CreateCourse(instructor, &dto.CourseCreateInput{Name: "Rust"})
+	suite.NoError(err)
+	suite.Equal(uint(2), course.UserID)
+
+	_, err = suite.service.CreateCourse(instructor, &dto.CourseCreateInput{Name: "Rust", UserID: 1})
+	suite.ErrorIs(err, rbac.ErrForbidden)
+	_, err = suite.service.CreateCourse(suite.admin, &dto.CourseCreateInput{Name: "Rust", UserID: 1})
+	suite.NoError(err)
+}
+
+func (suite *CourseServiceTestSuite) TestPublishCourse() {
+	_, err := suite.service.PublishCourse(suite.other, 1)
+	suite.ErrorIs(err, rbac.ErrForbidden)
+
+	course, err := suite.service.PublishCourse(suite.owner, 1)
+	suite.NoError(err)
+	suite.NotNil(course.PublishedAt)
+	select {
+	case courseID := <-suite.followService.notified:
+		suite.Equal(uint(1), courseID)
+	case <-time.After(time.Second):
+		suite.Fail("followers were not notified")
+	}
+
+	// Followers hear about a course once
+	_, err = suite.service.PublishCourse(suite.admin, 1)
+	suite.NoError(err)
+	suite.Empty(suite.followService.notified)
+}
+
+func (suite *CourseServiceTestSuite) TestUnpublishedCourses() {
+	suite.db.Create(&Course{Name: "Rust", UserID: 2})
+	suite.db.Create(&CourseCoOwner{CourseID: 2, UserID: 1})
+	publishedAt := time.Now()
+	suite.db.Create(&Course{Name: "Zig", UserID: 2, PublishedAt: &publishedAt})
+
+	// Guests and other users only see published courses, owners and co-owners see their drafts too
+	for _, tc := range []struct {
+		actor rbac.Actor
+		names []string
+	}{
+		{rbac.Actor{}, []string{"Zig"}},
+		{rbac.Actor{ID: 4, Role: user.Generic}, []string{"Zig"}},
+		{suite.owner, []string{"Go", "Rust", "Zig"}},
+		{suite.other, []string{"Rust", "Zig"}},
+		{suite.admin, []string{"Go", "Rust", "Zig"}},
+	} {
+		courses, count, err := suite.service.FindManyCourses(tc.actor, &dto.CourseFilterInput{})
+		suite.NoError(err)
+		suite.Equal(int64(len(tc.names)), count)
+		var names []string
+		for _, course := range courses {
+			names = append(names, course.Name)
+		}
+		suite.Equal(tc.names, names)
+	}
+
+	_, err := suite.service.FindCourseByID(rbac.Actor{}, 1)
+	suite.ErrorIs(err, gorm.ErrRecordNotFound)
+	_, err = suite.service.FindCourseByID(suite.other, 1)
+	suite.ErrorIs(err, gorm.ErrRecordNotFound)
+	_, err = suite.service.FindCourseByID(suite.owner, 2)
+	suite.NoError(err)
+	_, err = suite.service.FindCourseByID(suite.admin, 1)
+	suite.NoError(err)
+	_, err = suite.service.FindCourseByID(rbac.Actor{}, 3)
+	suite.NoError(err)
+}
+
+func TestCourseServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(CourseServiceTestSuite))
+}
@@ -1,6 +1,6 @@
-package dto
-
-type CategoryCreateInput struct {
-	Name        string `json:"name"`
-	Description string `json:"description"`
-}
+package dto
+
+type CategoryCreateInput struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
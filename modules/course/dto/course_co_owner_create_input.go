@@ -0,0 +1,5 @@
+package dto
+
+type CourseCoOwnerCreateInput struct {
+	UserID uint `json:"userId" binding:"required"`
+}
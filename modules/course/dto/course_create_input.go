@@ -1,9 +1,9 @@
-package dto
-
-type CourseCreateInput struct {
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price"`
-	CategoryID  uint    `json:"categoryId"`
-	UserID      uint    `json:"userId"`
-}
+package dto
+
+type CourseCreateInput struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Price       float64 `json:"price"`
+	CategoryID  uint    `json:"categoryId"`
+	UserID      uint    `json:"userId"`
+}
@@ -0,0 +1,76 @@
+package follow
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/irvanherz/gourze/utils"
+	"gorm.io/gorm"
+)
+
+type FollowController interface {
+	Follow(*gin.Context)
+	Unfollow(*gin.Context)
+	FindManyFollowing(*gin.Context)
+}
+
+type followController struct {
+	Service FollowService
+}
+
+func NewFollowController(service FollowService) FollowController {
+	return &followController{service}
+}
+
+func (fc *followController) Follow(c *gin.Context) {
+	uid, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": "Invalid user ID"})
+		return
+	}
+	currentUser, _ := utils.GetCurrentUser(c)
+	follow, err := fc.Service.Follow(currentUser.Actor(), uint(uid))
+	if err != nil {
+		respondFollowError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "You now follow this instructor", "data": follow})
+}
+
+func (fc *followController) Unfollow(c *gin.Context) {
+	uid, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": "Invalid user ID"})
+		return
+	}
+	currentUser, _ := utils.GetCurrentUser(c)
+	if err := fc.Service.Unfollow(currentUser.Actor(), uint(uid)); err != nil {
+		respondFollowError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "You no longer follow this instructor"})
+}
+
+// FindManyFollowing lists the instructors the current user follows
+func (fc *followController) FindManyFollowing(c *gin.Context) {
+	currentUser, _ := utils.GetCurrentUser(c)
+	follows, err := fc.Service.FindManyFollowing(currentUser.Actor())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Success", "data": follows})
+}
+
+func respondFollowError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"code": "not-found", "message": err.Error()})
+	case errors.Is(err, ErrCannotFollowSelf), errors.Is(err, ErrNotInstructor):
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+	}
+}
@@ -0,0 +1,16 @@
+package follow
+
+import (
+	"time"
+
+	"github.com/irvanherz/gourze/modules/user"
+)
+
+// Follow subscribes a user to the courses an instructor publishes
+type Follow struct {
+	ID           uint      `gorm:"primarykey" json:"id"`
+	FollowerID   uint      `gorm:"type:integer;not null;uniqueIndex:idx_follow" json:"followerId"`
+	InstructorID uint      `gorm:"type:integer;not null;uniqueIndex:idx_follow;index" json:"instructorId"`
+	CreatedAt    time.Time `gorm:"type:timestamp" json:"createdAt"`
+	Instructor   user.User `json:"instructor" gorm:"foreignKey:InstructorID"`
+}
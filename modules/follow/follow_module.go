@@ -0,0 +1,9 @@
+package follow
+
+import "go.uber.org/fx"
+
+// Module exports dependencies for the follow module
+var Module = fx.Module("follow",
+	fx.Provide(NewFollowService),
+	fx.Provide(NewFollowController),
+)
@@ -0,0 +1,120 @@
+package follow
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/irvanherz/gourze/config"
+	"github.com/irvanherz/gourze/modules/mail"
+	"github.com/irvanherz/gourze/modules/rbac"
+	"github.com/irvanherz/gourze/modules/user"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrCannotFollowSelf = errors.New("you can't follow yourself")
+	ErrNotInstructor    = errors.New("only instructors can be followed")
+)
+
+// FollowService lets users follow instructors, followers get an email whenever the instructor
+// publishes a course
+type FollowService interface {
+	Follow(actor rbac.Actor, instructorID uint) (*Follow, error)
+	Unfollow(actor rbac.Actor, instructorID uint) error
+	FindManyFollowing(actor rbac.Actor) ([]Follow, error)
+	NotifyCoursePublished(instructorID uint, courseID uint, courseName string) error
+}
+
+type followService struct {
+	Db     *gorm.DB
+	Config *config.Config
+	Policy rbac.Policy
+	Mailer mail.Mailer
+}
+
+func NewFollowService(db *gorm.DB, conf *config.Config, policy rbac.Policy, mailer mail.Mailer) FollowService {
+	return &followService{Db: db, Config: conf, Policy: policy, Mailer: mailer}
+}
+
+// Follow implements FollowService. Instructors are the users holding course:create, following
+// someone twice is a no-op.
+func (s *followService) Follow(actor rbac.Actor, instructorID uint) (*Follow, error) {
+	if instructorID == actor.ID {
+		return nil, ErrCannotFollowSelf
+	}
+	var instructor user.User
+	if err := s.Db.First(&instructor, instructorID).Error; err != nil {
+		return nil, err
+	}
+	if err := s.Policy.Authorize(rbac.Actor{ID: instructor.ID, Role: instructor.Role}, rbac.CourseCreate); err != nil {
+		if errors.Is(err, rbac.ErrForbidden) {
+			return nil, ErrNotInstructor
+		}
+		return nil, err
+	}
+	follow := Follow{FollowerID: actor.ID, InstructorID: instructor.ID}
+	if err := s.Db.Where(&follow).FirstOrCreate(&follow).Error; err != nil {
+		return nil, err
+	}
+	follow.Instructor = instructor
+	return &follow, nil
+}
+
+func (s *followService) Unfollow(actor rbac.Actor, instructorID uint) error {
+	result := s.Db.Where("follower_id = ? AND instructor_id = ?", actor.ID, instructorID).Delete(&Follow{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// FindManyFollowing implements FollowService. Instructors who deleted their account are left out.
+func (s *followService) FindManyFollowing(actor rbac.Actor) ([]Follow, error) {
+	var follows []Follow
+	err := s.Db.InnerJoins("Instructor").
+		Where("follows.follower_id = ?", actor.ID).
+		Order("follows.id DESC").
+		Find(&follows).Error
+	if err != nil {
+		return nil, err
+	}
+	return follows, nil
+}
+
+// NotifyCoursePublished implements FollowService. Each follower gets their own email, so addresses
+// aren't shared between followers. A failed delivery doesn't stop the others.
+func (s *followService) NotifyCoursePublished(instructorID uint, courseID uint, courseName string) error {
+	var instructor user.User
+	if err := s.Db.First(&instructor, instructorID).Error; err != nil {
+		return err
+	}
+	var followers []user.User
+	err := s.Db.Joins("JOIN follows ON follows.follower_id = users.id").
+		Where("follows.instructor_id = ?", instructorID).
+		Find(&followers).Error
+	if err != nil {
+		return err
+	}
+
+	instructorName := instructor.FullName
+	if instructorName == "" {
+		instructorName = instructor.Username
+	}
+	courseURL := fmt.Sprintf("%s/courses/%d", s.Config.App.FrontendURL, courseID)
+	var errs []error
+	for _, follower := range followers {
+		err := s.Mailer.Send(mail.Message{
+			To:      []string{follower.Email},
+			Subject: fmt.Sprintf("New course by %s: %s", instructorName, courseName),
+			Body: fmt.Sprintf("Hi %s,\n\n%s just published a new course, %s:\n\n%s\n\nYou get this email because you follow %s. Unfollow them on their profile to stop these emails.\n",
+				follower.FullName, instructorName, courseName, courseURL, instructorName),
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to notify %s: %w", follower.Email, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,88 @@
+package follow
+
+import (
+	"testing"
+
+	"github.com/irvanherz/gourze/config"
+	"github.com/irvanherz/gourze/modules/mail"
+	"github.com/irvanherz/gourze/modules/rbac"
+	"github.com/irvanherz/gourze/modules/user"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// fakeMailer records sent messages instead of delivering them
+type fakeMailer struct {
+	messages []mail.Message
+}
+
+func (m *fakeMailer) Send(message mail.Message) error {
+	m.messages = append(m.messages, message)
+	return nil
+}
+
+type FollowServiceTestSuite struct {
+	suite.Suite
+	db         *gorm.DB
+	mailer     *fakeMailer
+	service    FollowService
+	learner    rbac.Actor
+	instructor rbac.Actor
+}
+
+func (suite *FollowServiceTestSuite) SetupTest() {
+	suite.db, _ = gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	suite.db.AutoMigrate(&user.User{}, &Follow{}, &rbac.Permission{}, &rbac.Role{})
+	rbac.SeedRoles(suite.db)
+	suite.mailer = &fakeMailer{}
+	conf := &config.Config{App: config.AppConfig{FrontendURL: "https://gourze.test"}}
+	suite.service = NewFollowService(suite.db, conf, rbac.NewPolicy(rbac.NewRbacService(suite.db)), suite.mailer)
+
+	suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com", FullName: "John Doe"})
+	suite.db.Create(&user.User{Username: "jane_doe", Email: "jane@doe.com", FullName: "Jane Doe", Role: user.Instructor})
+	suite.db.Create(&user.User{Username: "jim_doe", Email: "jim@doe.com"})
+	suite.learner = rbac.Actor{ID: 1, Role: user.Generic}
+	suite.instructor = rbac.Actor{ID: 2, Role: user.Instructor}
+}
+
+func (suite *FollowServiceTestSuite) TestFollow() {
+	follow, err := suite.service.Follow(suite.learner, 2)
+	suite.NoError(err)
+	suite.Equal("jane_doe", follow.Instructor.Username)
+	// Following twice keeps a single follow
+	_, err = suite.service.Follow(suite.learner, 2)
+	suite.NoError(err)
+	following, err := suite.service.FindManyFollowing(suite.learner)
+	suite.NoError(err)
+	suite.Len(following, 1)
+
+	_, err = suite.service.Follow(suite.instructor, 2)
+	suite.ErrorIs(err, ErrCannotFollowSelf)
+	_, err = suite.service.Follow(suite.instructor, 3)
+	suite.ErrorIs(err, ErrNotInstructor)
+	_, err = suite.service.Follow(suite.learner, 99)
+	suite.ErrorIs(err, gorm.ErrRecordNotFound)
+
+	suite.NoError(suite.service.Unfollow(suite.learner, 2))
+	suite.ErrorIs(suite.service.Unfollow(suite.learner, 2), gorm.ErrRecordNotFound)
+	following, _ = suite.service.FindManyFollowing(suite.learner)
+	suite.Empty(following)
+}
+
+func (suite *FollowServiceTestSuite) TestNotifyCoursePublished() {
+	suite.service.Follow(suite.learner, 2)
+	suite.service.Follow(rbac.Actor{ID: 3, Role: user.Generic}, 2)
+	// Deleted followers aren't emailed
+	suite.db.Delete(&user.User{}, 3)
+
+	suite.NoError(suite.service.NotifyCoursePublished(2, 7, "Go 101"))
+	suite.Len(suite.mailer.messages, 1)
+	suite.Equal([]string{"john@doe.com"}, suite.mailer.messages[0].To)
+	suite.Equal("New course by Jane Doe: Go 101", suite.mailer.messages[0].Subject)
+	suite.Contains(suite.mailer.messages[0].Body, "https://gourze.test/courses/7")
+}
+
+func TestFollowServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(FollowServiceTestSuite))
+}
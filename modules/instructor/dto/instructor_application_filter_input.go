@@ -0,0 +1,24 @@
+package dto
+
+import (
+	"gorm.io/gorm"
+)
+
+type InstructorApplicationFilterInput struct {
+	Page   uint   `form:"page" default:"1"`
+	Take   uint   `form:"take" default:"10"`
+	Status string `form:"status" binding:"omitempty,oneof=pending approved rejected"`
+}
+
+func (filter *InstructorApplicationFilterInput) ApplyFilter(query *gorm.DB) *gorm.DB {
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	return query
+}
+
+// ApplyPagination lists the oldest applications first, in the order they should be reviewed
+func (filter *InstructorApplicationFilterInput) ApplyPagination(query *gorm.DB) *gorm.DB {
+	offset := (filter.Page - 1) * filter.Take
+	return query.Order("id").Offset(int(offset)).Limit(int(filter.Take))
+}
@@ -0,0 +1,15 @@
+package dto
+
+type InstructorApplicationInput struct {
+	Headline string `json:"headline" binding:"required,max=255"`
+	Bio      string `json:"bio" binding:"required,max=5000"`
+	// SampleContentURLs link to videos, articles or courses showing how the applicant teaches
+	SampleContentURLs []string          `json:"sampleContentUrls" binding:"required,min=1,max=10,dive,url"`
+	PayoutMethod      string            `json:"payoutMethod" binding:"required,oneof=bank_transfer paypal"`
+	PayoutDetails     map[string]string `json:"payoutDetails" binding:"required"`
+}
+
+// InstructorReviewInput is used to approve and reject applications, rejections need notes
+type InstructorReviewInput struct {
+	Notes string `json:"notes" binding:"max=2000"`
+}
@@ -0,0 +1,138 @@
+package instructor
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/irvanherz/gourze/modules/instructor/dto"
+	"github.com/irvanherz/gourze/modules/rbac"
+	"github.com/irvanherz/gourze/utils"
+	"gorm.io/gorm"
+)
+
+type InstructorController interface {
+	FindManyApplications(*gin.Context)
+	SubmitApplication(*gin.Context)
+	FindApplicationByID(*gin.Context)
+	ApproveApplication(*gin.Context)
+	RejectApplication(*gin.Context)
+}
+
+type instructorController struct {
+	Service InstructorService
+}
+
+func NewInstructorController(service InstructorService) InstructorController {
+	return &instructorController{service}
+}
+
+func (ic *instructorController) FindManyApplications(c *gin.Context) {
+	var filter dto.InstructorApplicationFilterInput
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
+		return
+	}
+	currentUser, _ := utils.GetCurrentUser(c)
+	applications, count, err := ic.Service.FindManyApplications(currentUser.Actor(), &filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+		return
+	}
+	page := filter.Page
+	take := filter.Take
+	numPages := (count + int64(take) - 1) / int64(take)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    "ok",
+		"message": "Success",
+		"data":    applications,
+		"meta": gin.H{
+			"numItems": count,
+			"page":     page,
+			"numPages": numPages,
+			"take":     take,
+		},
+	})
+}
+
+func (ic *instructorController) SubmitApplication(c *gin.Context) {
+	var input dto.InstructorApplicationInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
+		return
+	}
+	currentUser, _ := utils.GetCurrentUser(c)
+	application, err := ic.Service.SubmitApplication(currentUser.Actor(), &input)
+	if err != nil {
+		respondInstructorError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"code": "ok", "message": "Application submitted, it will be reviewed shortly", "data": application})
+}
+
+func (ic *instructorController) FindApplicationByID(c *gin.Context) {
+	uid, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": "Invalid application ID"})
+		return
+	}
+	currentUser, _ := utils.GetCurrentUser(c)
+	application, err := ic.Service.FindApplicationByID(currentUser.Actor(), uint(uid))
+	if err != nil {
+		respondInstructorError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Success", "data": application})
+}
+
+// ApproveApplication makes the applicant an instructor
+func (ic *instructorController) ApproveApplication(c *gin.Context) {
+	ic.review(c, ic.Service.ApproveApplication, "Application approved")
+}
+
+func (ic *instructorController) RejectApplication(c *gin.Context) {
+	ic.review(c, ic.Service.RejectApplication, "Application rejected")
+}
+
+func (ic *instructorController) review(c *gin.Context, decide func(rbac.Actor, uint, *dto.InstructorReviewInput) (*Application, error), message string) {
+	uid, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": "Invalid application ID"})
+		return
+	}
+	var input dto.InstructorReviewInput
+	// Approvals may come without a body
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
+		return
+	}
+	currentUser, _ := utils.GetCurrentUser(c)
+	application, err := decide(currentUser.Actor(), uint(uid), &input)
+	if err != nil {
+		respondInstructorError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": message, "data": application})
+}
+
+func respondInstructorError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"code": "not-found", "message": "Application not found"})
+	case errors.Is(err, rbac.ErrForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"code": "forbidden", "message": err.Error()})
+	case errors.Is(err, ErrAlreadyInstructor):
+		c.JSON(http.StatusConflict, gin.H{"code": "already-instructor", "message": err.Error()})
+	case errors.Is(err, ErrApplicationPending):
+		c.JSON(http.StatusConflict, gin.H{"code": "application-pending", "message": err.Error()})
+	case errors.Is(err, ErrApplicationReviewed):
+		c.JSON(http.StatusConflict, gin.H{"code": "application-reviewed", "message": err.Error()})
+	case errors.Is(err, ErrReviewNotesRequired):
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+	}
+}
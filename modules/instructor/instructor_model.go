@@ -0,0 +1,41 @@
+package instructor
+
+import (
+	"time"
+
+	"github.com/irvanherz/gourze/modules/user"
+	"gorm.io/datatypes"
+)
+
+type ApplicationStatus string
+
+const (
+	Pending  ApplicationStatus = "pending"
+	Approved ApplicationStatus = "approved"
+	Rejected ApplicationStatus = "rejected"
+)
+
+// Application is the request of a user to become an instructor. Users holding instructor:review
+// approve or reject it, ReviewNotes tells the applicant why.
+type Application struct {
+	ID                uint                        `gorm:"primarykey" json:"id"`
+	UserID            uint                        `gorm:"index" json:"userId"`
+	Headline          string                      `gorm:"type:varchar(255)" json:"headline"`
+	Bio               string                      `gorm:"type:text" json:"bio"`
+	SampleContentURLs datatypes.JSONSlice[string] `gorm:"type:jsonb;not null" json:"sampleContentUrls"`
+	// PayoutDetails are the account details of PayoutMethod, e.g. the bank account number
+	PayoutMethod  string            `gorm:"type:varchar(32)" json:"payoutMethod"`
+	PayoutDetails datatypes.JSONMap `gorm:"type:jsonb;not null" json:"payoutDetails"`
+	Status        ApplicationStatus `gorm:"type:varchar(16);not null;default:'pending';index" json:"status"`
+	ReviewerID    *uint             `gorm:"type:integer" json:"reviewerId"`
+	ReviewNotes   string            `gorm:"type:text" json:"reviewNotes"`
+	ReviewedAt    *time.Time        `gorm:"type:timestamp" json:"reviewedAt"`
+	CreatedAt     time.Time         `gorm:"type:timestamp" json:"createdAt"`
+	UpdatedAt     time.Time         `gorm:"type:timestamp" json:"updatedAt"`
+	User          user.User         `json:"user" gorm:"foreignKey:UserID"`
+}
+
+// TableName keeps the table recognizable among the other tables
+func (Application) TableName() string {
+	return "instructor_applications"
+}
@@ -0,0 +1,9 @@
+package instructor
+
+import "go.uber.org/fx"
+
+// Module exports dependencies for the instructor module
+var Module = fx.Module("instructor",
+	fx.Provide(NewInstructorService),
+	fx.Provide(NewInstructorController),
+)
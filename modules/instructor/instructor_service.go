@@ -0,0 +1,168 @@
+package instructor
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/creasty/defaults"
+	"github.com/irvanherz/gourze/modules/instructor/dto"
+	"github.com/irvanherz/gourze/modules/rbac"
+	"github.com/irvanherz/gourze/modules/user"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrAlreadyInstructor   = errors.New("you can already create courses")
+	ErrApplicationPending  = errors.New("you already have an application waiting for review")
+	ErrApplicationReviewed = errors.New("application has already been reviewed")
+	ErrReviewNotesRequired = errors.New("rejections need notes telling the applicant why")
+)
+
+// InstructorService handles applications to become an instructor. Applicants see their own
+// applications, users holding instructor:review see and review all of them.
+type InstructorService interface {
+	SubmitApplication(actor rbac.Actor, input *dto.InstructorApplicationInput) (*Application, error)
+	FindManyApplications(actor rbac.Actor, filter *dto.InstructorApplicationFilterInput) ([]Application, int64, error)
+	FindApplicationByID(actor rbac.Actor, id uint) (*Application, error)
+	ApproveApplication(actor rbac.Actor, id uint, input *dto.InstructorReviewInput) (*Application, error)
+	RejectApplication(actor rbac.Actor, id uint, input *dto.InstructorReviewInput) (*Application, error)
+}
+
+type instructorService struct {
+	Db     *gorm.DB
+	Policy rbac.Policy
+}
+
+func NewInstructorService(db *gorm.DB, policy rbac.Policy) InstructorService {
+	return &instructorService{Db: db, Policy: policy}
+}
+
+// SubmitApplication implements InstructorService. Users may apply again once their previous
+// application was rejected.
+func (s *instructorService) SubmitApplication(actor rbac.Actor, input *dto.InstructorApplicationInput) (*Application, error) {
+	if err := s.Policy.Authorize(actor, rbac.CourseCreate); err == nil {
+		return nil, ErrAlreadyInstructor
+	} else if !errors.Is(err, rbac.ErrForbidden) {
+		return nil, err
+	}
+	var pending int64
+	if err := s.Db.Model(&Application{}).Where("user_id = ? AND status = ?", actor.ID, Pending).Count(&pending).Error; err != nil {
+		return nil, err
+	}
+	if pending > 0 {
+		return nil, ErrApplicationPending
+	}
+
+	payoutDetails := datatypes.JSONMap{}
+	for key, value := range input.PayoutDetails {
+		payoutDetails[key] = value
+	}
+	application := Application{
+		UserID:            actor.ID,
+		Headline:          strings.TrimSpace(input.Headline),
+		Bio:               input.Bio,
+		SampleContentURLs: input.SampleContentURLs,
+		PayoutMethod:      input.PayoutMethod,
+		PayoutDetails:     payoutDetails,
+		Status:            Pending,
+	}
+	if err := s.Db.Create(&application).Error; err != nil {
+		return nil, err
+	}
+	return &application, nil
+}
+
+func (s *instructorService) FindManyApplications(actor rbac.Actor, filter *dto.InstructorApplicationFilterInput) ([]Application, int64, error) {
+	var applications []Application
+	var count int64
+
+	if err := defaults.Set(filter); err != nil {
+		return nil, 0, err
+	}
+	query, err := s.Policy.Scope(s.Db, actor, rbac.InstructorReview, "user_id")
+	if err != nil {
+		return nil, 0, err
+	}
+	query = filter.ApplyFilter(query)
+
+	if err := query.Model(&Application{}).Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+
+	query = filter.ApplyPagination(query)
+
+	if err := query.Preload("User").Find(&applications).Error; err != nil {
+		return nil, 0, err
+	}
+	return applications, count, nil
+}
+
+func (s *instructorService) FindApplicationByID(actor rbac.Actor, id uint) (*Application, error) {
+	return s.findApplication(actor, id)
+}
+
+// ApproveApplication implements InstructorService. Generic applicants become instructors, users
+// who were granted a higher role in the meantime keep it. The new role is in the access tokens
+// issued from then on, i.e. after the next refresh.
+func (s *instructorService) ApproveApplication(actor rbac.Actor, id uint, input *dto.InstructorReviewInput) (*Application, error) {
+	return s.review(actor, id, Approved, input.Notes, func(tx *gorm.DB, application *Application) error {
+		return tx.Model(&user.User{}).
+			Where("id = ? AND role = ?", application.UserID, user.Generic).
+			Update("role", user.Instructor).Error
+	})
+}
+
+func (s *instructorService) RejectApplication(actor rbac.Actor, id uint, input *dto.InstructorReviewInput) (*Application, error) {
+	if strings.TrimSpace(input.Notes) == "" {
+		return nil, ErrReviewNotesRequired
+	}
+	return s.review(actor, id, Rejected, input.Notes, nil)
+}
+
+// review records the decision on a pending application, and runs apply in the same transaction.
+// Nobody reviews their own application.
+func (s *instructorService) review(actor rbac.Actor, id uint, status ApplicationStatus, notes string, apply func(tx *gorm.DB, application *Application) error) (*Application, error) {
+	application, err := s.findApplication(actor, id)
+	if err != nil {
+		return nil, err
+	}
+	if application.UserID == actor.ID {
+		return nil, rbac.ErrForbidden
+	}
+	err = s.Db.Transaction(func(tx *gorm.DB) error {
+		// Guard against two reviewers deciding at the same time
+		now := time.Now()
+		result := tx.Model(&Application{}).
+			Where("id = ? AND status = ?", id, Pending).
+			Updates(map[string]interface{}{"status": status, "reviewer_id": actor.ID, "review_notes": notes, "reviewed_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrApplicationReviewed
+		}
+		if apply != nil {
+			return apply(tx, application)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.findApplication(actor, id)
+}
+
+// findApplication loads an application within the scope of the actor, applications of other users are not found
+func (s *instructorService) findApplication(actor rbac.Actor, id uint) (*Application, error) {
+	query, err := s.Policy.Scope(s.Db, actor, rbac.InstructorReview, "user_id")
+	if err != nil {
+		return nil, err
+	}
+	var application Application
+	if err := query.Preload("User").First(&application, id).Error; err != nil {
+		return nil, err
+	}
+	return &application, nil
+}
@@ -0,0 +1,115 @@
+package instructor
+
+import (
+	"testing"
+
+	"github.com/irvanherz/gourze/modules/instructor/dto"
+	"github.com/irvanherz/gourze/modules/rbac"
+	"github.com/irvanherz/gourze/modules/user"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type InstructorServiceTestSuite struct {
+	suite.Suite
+	db        *gorm.DB
+	service   InstructorService
+	applicant rbac.Actor
+	admin     rbac.Actor
+}
+
+func (suite *InstructorServiceTestSuite) SetupTest() {
+	suite.db, _ = gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	suite.db.AutoMigrate(&user.User{}, &Application{}, &rbac.Permission{}, &rbac.Role{})
+	rbac.SeedRoles(suite.db)
+	suite.service = NewInstructorService(suite.db, rbac.NewPolicy(rbac.NewRbacService(suite.db)))
+
+	suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com"})
+	suite.db.Create(&user.User{Username: "admin", Email: "admin@doe.com", Role: user.Admin})
+	suite.applicant = rbac.Actor{ID: 1, Role: user.Generic}
+	suite.admin = rbac.Actor{ID: 2, Role: user.Admin}
+}
+
+func applicationInput() *dto.InstructorApplicationInput {
+	return &dto.InstructorApplicationInput{
+		Headline:          "Go developer",
+		Bio:               "Ten years of backend development",
+		SampleContentURLs: []string{"https://youtube.com/watch?v=go"},
+		PayoutMethod:      "bank_transfer",
+		PayoutDetails:     map[string]string{"accountNumber": "123456"},
+	}
+}
+
+func (suite *InstructorServiceTestSuite) TestSubmitApplication() {
+	application, err := suite.service.SubmitApplication(suite.applicant, applicationInput())
+	suite.NoError(err)
+	suite.Equal(Pending, application.Status)
+	suite.Equal("123456", application.PayoutDetails["accountNumber"])
+
+	_, err = suite.service.SubmitApplication(suite.applicant, applicationInput())
+	suite.ErrorIs(err, ErrApplicationPending)
+	_, err = suite.service.SubmitApplication(suite.admin, applicationInput())
+	suite.ErrorIs(err, ErrAlreadyInstructor)
+}
+
+func (suite *InstructorServiceTestSuite) TestApproveApplication() {
+	application, _ := suite.service.SubmitApplication(suite.applicant, applicationInput())
+
+	// Applicants can't review, not even their own application
+	_, err := suite.service.ApproveApplication(suite.applicant, application.ID, &dto.InstructorReviewInput{})
+	suite.ErrorIs(err, rbac.ErrForbidden)
+
+	approved, err := suite.service.ApproveApplication(suite.admin, application.ID, &dto.InstructorReviewInput{Notes: "Welcome"})
+	suite.NoError(err)
+	suite.Equal(Approved, approved.Status)
+	suite.Equal(uint(2), *approved.ReviewerID)
+	suite.NotNil(approved.ReviewedAt)
+	suite.Equal(user.Instructor, approved.User.Role)
+
+	_, err = suite.service.RejectApplication(suite.admin, application.ID, &dto.InstructorReviewInput{Notes: "Changed my mind"})
+	suite.ErrorIs(err, ErrApplicationReviewed)
+	_, err = suite.service.SubmitApplication(rbac.Actor{ID: 1, Role: user.Instructor}, applicationInput())
+	suite.ErrorIs(err, ErrAlreadyInstructor)
+}
+
+func (suite *InstructorServiceTestSuite) TestRejectApplication() {
+	application, _ := suite.service.SubmitApplication(suite.applicant, applicationInput())
+
+	_, err := suite.service.RejectApplication(suite.admin, application.ID, &dto.InstructorReviewInput{})
+	suite.ErrorIs(err, ErrReviewNotesRequired)
+	rejected, err := suite.service.RejectApplication(suite.admin, application.ID, &dto.InstructorReviewInput{Notes: "Sample videos are private"})
+	suite.NoError(err)
+	suite.Equal(Rejected, rejected.Status)
+	suite.Equal(user.Generic, rejected.User.Role)
+
+	// The applicant sees why and may apply again
+	seen, err := suite.service.FindApplicationByID(suite.applicant, application.ID)
+	suite.NoError(err)
+	suite.Equal("Sample videos are private", seen.ReviewNotes)
+	_, err = suite.service.SubmitApplication(suite.applicant, applicationInput())
+	suite.NoError(err)
+}
+
+func (suite *InstructorServiceTestSuite) TestFindManyApplications_Scope() {
+	suite.db.Create(&user.User{Username: "jane_doe", Email: "jane@doe.com"})
+	suite.service.SubmitApplication(suite.applicant, applicationInput())
+	other, _ := suite.service.SubmitApplication(rbac.Actor{ID: 3, Role: user.Generic}, applicationInput())
+
+	applications, count, err := suite.service.FindManyApplications(suite.applicant, &dto.InstructorApplicationFilterInput{})
+	suite.NoError(err)
+	suite.Equal(int64(1), count)
+	suite.Equal(uint(1), applications[0].UserID)
+	_, err = suite.service.FindApplicationByID(suite.applicant, other.ID)
+	suite.ErrorIs(err, gorm.ErrRecordNotFound)
+
+	suite.service.RejectApplication(suite.admin, other.ID, &dto.InstructorReviewInput{Notes: "Incomplete"})
+	applications, count, err = suite.service.FindManyApplications(suite.admin, &dto.InstructorApplicationFilterInput{Status: string(Pending)})
+	suite.NoError(err)
+	suite.Equal(int64(1), count)
+	suite.Equal("john_doe", applications[0].User.Username)
+}
+
+func TestInstructorServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(InstructorServiceTestSuite))
+}
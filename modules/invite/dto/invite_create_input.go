@@ -0,0 +1,11 @@
+package dto
+
+import "time"
+
+type InviteCreateInput struct {
+	Note string `json:"note" binding:"max=255"`
+	// Role is assigned to the users signing up with the invite, generic when empty
+	Role      string     `json:"role"`
+	MaxUses   uint       `json:"maxUses" binding:"required,min=1"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
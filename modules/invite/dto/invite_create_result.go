@@ -0,0 +1,13 @@
+package dto
+
+import "time"
+
+// InviteCreateResult is the only place the plain code is ever returned
+type InviteCreateResult struct {
+	ID        uint       `json:"id"`
+	Code      string     `json:"code"`
+	Note      string     `json:"note"`
+	Role      string     `json:"role"`
+	MaxUses   uint       `json:"maxUses"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
@@ -0,0 +1,80 @@
+package invite
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/irvanherz/gourze/modules/invite/dto"
+	"github.com/irvanherz/gourze/modules/rbac"
+	"github.com/irvanherz/gourze/utils"
+	"gorm.io/gorm"
+)
+
+type InviteController interface {
+	FindManyInvites(*gin.Context)
+	CreateInvite(*gin.Context)
+	RevokeInvite(*gin.Context)
+}
+
+type inviteController struct {
+	Service InviteService
+}
+
+func NewInviteController(service InviteService) InviteController {
+	return &inviteController{service}
+}
+
+func (ic *inviteController) FindManyInvites(c *gin.Context) {
+	invites, err := ic.Service.FindManyInvites()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Success", "data": invites})
+}
+
+func (ic *inviteController) CreateInvite(c *gin.Context) {
+	currentUser, err := utils.GetCurrentUser(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"code": "unauthorized", "message": "Unauthorized"})
+		return
+	}
+	var input dto.InviteCreateInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
+		return
+	}
+	result, err := ic.Service.CreateInvite(currentUser.Actor(), &input)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidInviteRole), errors.Is(err, ErrInviteExpired):
+			c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
+		case errors.Is(err, rbac.ErrForbidden):
+			c.JSON(http.StatusForbidden, gin.H{"code": "forbidden", "message": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"code": "ok", "message": "Invite created, store the code now as it won't be shown again", "data": result})
+}
+
+func (ic *inviteController) RevokeInvite(c *gin.Context) {
+	uid, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": "Invalid invite ID"})
+		return
+	}
+	invite, err := ic.Service.RevokeInvite(uint(uid))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"code": "not-found", "message": "Invite not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Invite revoked", "data": invite})
+}
@@ -0,0 +1,23 @@
+package invite
+
+import (
+	"time"
+
+	"github.com/irvanherz/gourze/modules/user"
+)
+
+// Invite lets people sign up while signups are restricted, see Config.Auth.SignupMode. Only the
+// hash of the code is stored, Note helps admins tell invites apart.
+type Invite struct {
+	ID          uint          `gorm:"primarykey" json:"id"`
+	CodeHash    string        `gorm:"unique;type:varchar(64)" json:"-"`
+	Note        string        `gorm:"type:varchar(255)" json:"note"`
+	Role        user.UserRole `gorm:"type:varchar(64);default:'generic'" json:"role"`
+	MaxUses     uint          `gorm:"not null" json:"maxUses"`
+	UseCount    uint          `gorm:"not null;default:0" json:"useCount"`
+	CreatedByID uint          `gorm:"index" json:"createdById"`
+	ExpiresAt   *time.Time    `gorm:"type:timestamp" json:"expiresAt"`
+	RevokedAt   *time.Time    `gorm:"type:timestamp" json:"revokedAt"`
+	CreatedAt   time.Time     `gorm:"type:timestamp" json:"createdAt"`
+	UpdatedAt   time.Time     `gorm:"type:timestamp" json:"updatedAt"`
+}
@@ -0,0 +1,9 @@
+package invite
+
+import "go.uber.org/fx"
+
+// Module exports dependencies for the invite module
+var Module = fx.Module("invite",
+	fx.Provide(NewInviteService),
+	fx.Provide(NewInviteController),
+)
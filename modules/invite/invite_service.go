@@ -0,0 +1,161 @@
+package invite
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/irvanherz/gourze/modules/invite/dto"
+	"github.com/irvanherz/gourze/modules/rbac"
+	"github.com/irvanherz/gourze/modules/user"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidInvite     = errors.New("invalid, expired or used up invite code")
+	ErrInviteExpired     = errors.New("invite expiry must be in the future")
+	ErrInvalidInviteRole = errors.New("invites can't grant this role")
+)
+
+type InviteService interface {
+	CreateInvite(actor rbac.Actor, input *dto.InviteCreateInput) (*dto.InviteCreateResult, error)
+	FindManyInvites() ([]Invite, error)
+	RevokeInvite(id uint) (*Invite, error)
+	// Redeem uses up one use of the invite within tx, which must also create the user
+	Redeem(tx *gorm.DB, code string) (*Invite, error)
+}
+
+type inviteService struct {
+	Db *gorm.DB
+}
+
+func NewInviteService(db *gorm.DB) InviteService {
+	return &inviteService{Db: db}
+}
+
+// CreateInvite implements InviteService. Invites never grant the super role, and only super
+// users may invite admins.
+func (s *inviteService) CreateInvite(actor rbac.Actor, input *dto.InviteCreateInput) (*dto.InviteCreateResult, error) {
+	role := user.Generic
+	if input.Role != "" {
+		parsedRole, err := user.ParseUserRole(input.Role)
+		if err != nil {
+			// Roles created through the rbac API are as good as the built-in ones
+			if err := s.Db.Where("name = ?", input.Role).First(&rbac.Role{}).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return nil, ErrInvalidInviteRole
+				}
+				return nil, err
+			}
+			parsedRole = user.UserRole(input.Role)
+		}
+		if parsedRole == user.Super {
+			return nil, ErrInvalidInviteRole
+		}
+		role = parsedRole
+	}
+	if role == user.Admin && actor.Role != user.Super {
+		return nil, rbac.ErrForbidden
+	}
+	if input.ExpiresAt != nil && input.ExpiresAt.Before(time.Now()) {
+		return nil, ErrInviteExpired
+	}
+
+	code, err := generateCode()
+	if err != nil {
+		return nil, err
+	}
+	invite := Invite{
+		CodeHash:    hashCode(code),
+		Note:        input.Note,
+		Role:        role,
+		MaxUses:     input.MaxUses,
+		CreatedByID: actor.ID,
+		ExpiresAt:   input.ExpiresAt,
+	}
+	if err := s.Db.Create(&invite).Error; err != nil {
+		return nil, err
+	}
+	return &dto.InviteCreateResult{
+		ID:        invite.ID,
+		Code:      code,
+		Note:      invite.Note,
+		Role:      string(invite.Role),
+		MaxUses:   invite.MaxUses,
+		ExpiresAt: invite.ExpiresAt,
+	}, nil
+}
+
+func (s *inviteService) FindManyInvites() ([]Invite, error) {
+	var invites []Invite
+	if err := s.Db.Order("id desc").Find(&invites).Error; err != nil {
+		return nil, err
+	}
+	return invites, nil
+}
+
+func (s *inviteService) RevokeInvite(id uint) (*Invite, error) {
+	var invite Invite
+	if err := s.Db.First(&invite, id).Error; err != nil {
+		return nil, err
+	}
+	if invite.RevokedAt == nil {
+		now := time.Now()
+		invite.RevokedAt = &now
+		if err := s.Db.Model(&invite).Update("revoked_at", now).Error; err != nil {
+			return nil, err
+		}
+	}
+	return &invite, nil
+}
+
+// Redeem implements InviteService. The use count is incremented with a conditional update so
+// concurrent signups can't go over MaxUses.
+func (s *inviteService) Redeem(tx *gorm.DB, code string) (*Invite, error) {
+	var invite Invite
+	if err := tx.Where("code_hash = ?", hashCode(code)).First(&invite).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidInvite
+		}
+		return nil, err
+	}
+	if invite.RevokedAt != nil || (invite.ExpiresAt != nil && time.Now().After(*invite.ExpiresAt)) {
+		return nil, ErrInvalidInvite
+	}
+	result := tx.Model(&Invite{}).
+		Where("id = ? AND use_count < max_uses", invite.ID).
+		UpdateColumn("use_count", gorm.Expr("use_count + 1"))
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInvalidInvite
+	}
+	invite.UseCount++
+	return &invite, nil
+}
+
+// generateCode returns a code that is easy to read out, e.g. K7QJ-M2XA-PF4D-W9RT
+func generateCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	encoded := base32.StdEncoding.EncodeToString(b)
+	groups := make([]string, 0, len(encoded)/4)
+	for i := 0; i < len(encoded); i += 4 {
+		groups = append(groups, encoded[i:i+4])
+	}
+	return strings.Join(groups, "-"), nil
+}
+
+// hashCode ignores case, spaces and dashes, which people tend to get wrong when typing codes
+func hashCode(code string) string {
+	normalized := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
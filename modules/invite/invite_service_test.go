@@ -0,0 +1,102 @@
+package invite
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/irvanherz/gourze/modules/invite/dto"
+	"github.com/irvanherz/gourze/modules/rbac"
+	"github.com/irvanherz/gourze/modules/user"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type InviteServiceTestSuite struct {
+	suite.Suite
+	db      *gorm.DB
+	service InviteService
+	admin   rbac.Actor
+}
+
+func (suite *InviteServiceTestSuite) SetupTest() {
+	suite.db, _ = gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	suite.db.AutoMigrate(&Invite{}, &rbac.Permission{}, &rbac.Role{})
+	suite.service = NewInviteService(suite.db)
+	suite.admin = rbac.Actor{ID: 1, Role: user.Admin}
+}
+
+func (suite *InviteServiceTestSuite) TestCreateInvite_StoresOnlyHash() {
+	result, err := suite.service.CreateInvite(suite.admin, &dto.InviteCreateInput{Note: "Acme cohort", MaxUses: 10})
+	suite.NoError(err)
+	suite.Len(result.Code, 19)
+	suite.Equal(string(user.Generic), result.Role)
+
+	var stored Invite
+	suite.NoError(suite.db.First(&stored, result.ID).Error)
+	suite.NotEqual(result.Code, stored.CodeHash)
+	suite.Equal(uint(1), stored.CreatedByID)
+}
+
+func (suite *InviteServiceTestSuite) TestCreateInvite_Roles() {
+	_, err := suite.service.CreateInvite(rbac.Actor{ID: 1, Role: user.Super}, &dto.InviteCreateInput{Role: string(user.Super), MaxUses: 1})
+	suite.ErrorIs(err, ErrInvalidInviteRole)
+	_, err = suite.service.CreateInvite(suite.admin, &dto.InviteCreateInput{Role: string(user.Admin), MaxUses: 1})
+	suite.ErrorIs(err, rbac.ErrForbidden)
+
+	result, err := suite.service.CreateInvite(rbac.Actor{ID: 1, Role: user.Super}, &dto.InviteCreateInput{Role: string(user.Admin), MaxUses: 1})
+	suite.NoError(err)
+	suite.Equal(string(user.Admin), result.Role)
+
+	_, err = suite.service.CreateInvite(suite.admin, &dto.InviteCreateInput{Role: "moderator", MaxUses: 1})
+	suite.ErrorIs(err, ErrInvalidInviteRole)
+	suite.db.Create(&rbac.Role{Name: "moderator"})
+	result, err = suite.service.CreateInvite(suite.admin, &dto.InviteCreateInput{Role: "moderator", MaxUses: 1})
+	suite.NoError(err)
+	suite.Equal("moderator", result.Role)
+
+	past := time.Now().Add(-time.Hour)
+	_, err = suite.service.CreateInvite(suite.admin, &dto.InviteCreateInput{MaxUses: 1, ExpiresAt: &past})
+	suite.ErrorIs(err, ErrInviteExpired)
+}
+
+func (suite *InviteServiceTestSuite) TestRedeem_UsageLimit() {
+	result, _ := suite.service.CreateInvite(suite.admin, &dto.InviteCreateInput{MaxUses: 2})
+
+	redeemed, err := suite.service.Redeem(suite.db, result.Code)
+	suite.NoError(err)
+	suite.Equal(result.ID, redeemed.ID)
+	// Codes are matched regardless of case and dashes
+	_, err = suite.service.Redeem(suite.db, strings.ToLower(strings.ReplaceAll(result.Code, "-", " ")))
+	suite.NoError(err)
+	_, err = suite.service.Redeem(suite.db, result.Code)
+	suite.ErrorIs(err, ErrInvalidInvite)
+
+	var stored Invite
+	suite.db.First(&stored, result.ID)
+	suite.Equal(uint(2), stored.UseCount)
+}
+
+func (suite *InviteServiceTestSuite) TestRedeem_ExpiredOrRevoked() {
+	_, err := suite.service.Redeem(suite.db, "UNKNOWN")
+	suite.ErrorIs(err, ErrInvalidInvite)
+
+	expiring, _ := suite.service.CreateInvite(suite.admin, &dto.InviteCreateInput{MaxUses: 5})
+	suite.db.Model(&Invite{}).Where("id = ?", expiring.ID).Update("expires_at", time.Now().Add(-time.Minute))
+	_, err = suite.service.Redeem(suite.db, expiring.Code)
+	suite.ErrorIs(err, ErrInvalidInvite)
+
+	revoked, _ := suite.service.CreateInvite(suite.admin, &dto.InviteCreateInput{MaxUses: 5})
+	_, err = suite.service.RevokeInvite(revoked.ID)
+	suite.NoError(err)
+	_, err = suite.service.Redeem(suite.db, revoked.Code)
+	suite.ErrorIs(err, ErrInvalidInvite)
+
+	_, err = suite.service.RevokeInvite(99)
+	suite.ErrorIs(err, gorm.ErrRecordNotFound)
+}
+
+func TestInviteServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(InviteServiceTestSuite))
+}
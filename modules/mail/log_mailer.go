@@ -0,0 +1,44 @@
+package mail
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logMailer doesn't deliver anything, it writes messages to a file or to the standard logger.
+// Meant for local development and tests.
+type logMailer struct {
+	mu      sync.Mutex
+	LogPath string
+}
+
+func NewLogMailer(logPath string) Mailer {
+	return &logMailer{LogPath: logPath}
+}
+
+func (m *logMailer) Send(message Message) error {
+	entry := fmt.Sprintf("---\nDate: %s\nTo: %s\nSubject: %s\n\n%s\n",
+		time.Now().Format(time.RFC1123Z),
+		strings.Join(message.To, ", "),
+		message.Subject,
+		message.Body,
+	)
+	if m.LogPath == "" {
+		log.Print("📧 " + entry)
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	file, err := os.OpenFile(m.LogPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open mail log: %w", err)
+	}
+	defer file.Close()
+	_, err = file.WriteString(entry)
+	return err
+}
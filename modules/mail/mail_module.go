@@ -0,0 +1,8 @@
+package mail
+
+import "go.uber.org/fx"
+
+// Module exports dependencies for the mail module
+var Module = fx.Module("mail",
+	fx.Provide(NewMailer),
+)
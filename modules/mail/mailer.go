@@ -0,0 +1,25 @@
+package mail
+
+import (
+	"github.com/irvanherz/gourze/config"
+)
+
+type Message struct {
+	To      []string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(message Message) error
+}
+
+// NewMailer picks the mailer implementation configured by MAIL_DRIVER ("smtp" or "log")
+func NewMailer(config *config.Config) Mailer {
+	switch config.Mail.Driver {
+	case "smtp":
+		return NewSMTPMailer(config.Mail)
+	default:
+		return NewLogMailer(config.Mail.LogPath)
+	}
+}
@@ -0,0 +1,42 @@
+package mail
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+
+	"github.com/irvanherz/gourze/config"
+)
+
+type smtpMailer struct {
+	Config config.MailConfig
+}
+
+func NewSMTPMailer(config config.MailConfig) Mailer {
+	return &smtpMailer{Config: config}
+}
+
+func (m *smtpMailer) Send(message Message) error {
+	var auth smtp.Auth
+	if m.Config.User != "" {
+		auth = smtp.PlainAuth("", m.Config.User, m.Config.Pass, m.Config.Host)
+	}
+	addr := net.JoinHostPort(m.Config.Host, m.Config.Port)
+	if err := smtp.SendMail(addr, auth, m.Config.From, message.To, buildMessage(m.Config.From, message)); err != nil {
+		return fmt.Errorf("failed to send mail: %w", err)
+	}
+	return nil
+}
+
+func buildMessage(from string, message Message) []byte {
+	var sb strings.Builder
+	sb.WriteString("From: " + from + "\r\n")
+	sb.WriteString("To: " + strings.Join(message.To, ", ") + "\r\n")
+	sb.WriteString("Subject: " + message.Subject + "\r\n")
+	sb.WriteString("MIME-Version: 1.0\r\n")
+	sb.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n")
+	sb.WriteString("\r\n")
+	sb.WriteString(message.Body)
+	return []byte(sb.String())
+}
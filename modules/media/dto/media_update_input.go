@@ -1,5 +1,5 @@
-package dto
-
-type MediaUpdateInput struct {
-	Title string `json:"title"`
-}
+package dto
+
+type MediaUpdateInput struct {
+	Title string `json:"title"`
+}
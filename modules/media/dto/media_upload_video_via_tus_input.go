@@ -1,7 +1,7 @@
-package dto
-
-type MediaUploadVideoViaTusInput struct {
-	UserID   uint   `json:"userID"`
-	Title    string `json:"title"`
-	Filetype string `json:"filetype"`
-}
+package dto
+
+type MediaUploadVideoViaTusInput struct {
+	UserID   uint   `json:"userID"`
+	Title    string `json:"title"`
+	Filetype string `json:"filetype"`
+}
@@ -0,0 +1,10 @@
+package dto
+
+type OidcCallbackInput struct {
+	Code             string `form:"code"`
+	State            string `form:"state" binding:"required"`
+	Error            string `form:"error"`
+	ErrorDescription string `form:"error_description"`
+	// LoginCookie is read from the login cookie, see OidcLoginInput
+	LoginCookie string `form:"-"`
+}
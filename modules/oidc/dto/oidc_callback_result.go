@@ -0,0 +1,8 @@
+package dto
+
+import authDto "github.com/irvanherz/gourze/modules/auth/dto"
+
+type OidcCallbackResult struct {
+	Auth        *authDto.AuthResultDto
+	RedirectURL string
+}
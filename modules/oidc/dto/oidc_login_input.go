@@ -0,0 +1,8 @@
+package dto
+
+type OidcLoginInput struct {
+	// RedirectURL is where the browser is sent after a successful callback, it must be on the frontend
+	RedirectURL string `form:"redirect"`
+	// LoginCookie is the random value of the login cookie, which ties the callback to this browser
+	LoginCookie string `form:"-"`
+}
@@ -0,0 +1,118 @@
+package oidc
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"github.com/irvanherz/gourze/config"
+	"github.com/irvanherz/gourze/modules/auth"
+	"github.com/irvanherz/gourze/modules/oidc/dto"
+)
+
+// loginCookie ties a login to the browser that started it, the callback is a cross-site navigation
+// from the identity provider so the cookie is always SameSite=Lax
+const loginCookie = "oidcLogin"
+
+type OidcController interface {
+	Login(*gin.Context)
+	Callback(*gin.Context)
+}
+
+type oidcController struct {
+	Service OidcService
+	Config  *config.Config
+}
+
+func NewOidcController(service OidcService, conf *config.Config) OidcController {
+	return &oidcController{service, conf}
+}
+
+// Login redirects the browser to the identity provider, the login cookie lets only this browser finish the login
+func (oc *oidcController) Login(c *gin.Context) {
+	var input dto.OidcLoginInput
+	if err := c.ShouldBindQuery(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
+		return
+	}
+	var err error
+	if input.LoginCookie, err = randomString(32); err != nil {
+		respondOidcError(c, err)
+		return
+	}
+	authorizationURL, err := oc.Service.AuthorizationURL(c.Param("provider"), input)
+	if err != nil {
+		respondOidcError(c, err)
+		return
+	}
+	oc.setLoginCookie(c, input.LoginCookie, int(loginStateTTL.Seconds()))
+	c.Redirect(http.StatusFound, authorizationURL)
+}
+
+// Callback signs the user in after the identity provider redirected back. Logins started with a
+// redirect URL are sent back to the frontend, others get the same response as /auth/signin.
+func (oc *oidcController) Callback(c *gin.Context) {
+	var input dto.OidcCallbackInput
+	if err := c.ShouldBindQuery(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
+		return
+	}
+	input.LoginCookie, _ = c.Cookie(loginCookie)
+	oc.setLoginCookie(c, "", -1)
+	result, err := oc.Service.Callback(c.Param("provider"), input)
+	if err != nil {
+		respondOidcError(c, err)
+		return
+	}
+
+	if result.Auth.ChallengeToken != "" && result.RedirectURL != "" {
+		// The fragment keeps the challenge token out of server logs
+		fragment := "#challengeToken=" + url.QueryEscape(result.Auth.ChallengeToken)
+		if result.Auth.PasswordChangeRequired {
+			fragment += "&passwordChangeRequired=true"
+		}
+		c.Redirect(http.StatusFound, result.RedirectURL+fragment)
+		return
+	}
+	if auth.RespondSigninChallenge(c, result.Auth) {
+		return
+	}
+	auth.SetAuthCookies(c, oc.Config, result.Auth)
+	if result.RedirectURL != "" {
+		c.Redirect(http.StatusFound, result.RedirectURL)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Signin successful", "data": result.Auth})
+}
+
+func (oc *oidcController) setLoginCookie(c *gin.Context, value string, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     loginCookie,
+		Value:    value,
+		MaxAge:   maxAge,
+		Path:     "/auth/oidc",
+		Secure:   oc.Config.Auth.CookieSecure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func respondOidcError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrUnknownProvider):
+		c.JSON(http.StatusNotFound, gin.H{"code": "not-found", "message": err.Error()})
+	case errors.Is(err, ErrInvalidState), errors.Is(err, ErrInvalidRedirectURL):
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
+	case errors.Is(err, ErrProviderDenied), errors.Is(err, ErrInvalidIDToken):
+		c.JSON(http.StatusUnauthorized, gin.H{"code": "unauthorized", "message": err.Error()})
+	case errors.Is(err, auth.ErrAccountSuspended):
+		c.JSON(http.StatusForbidden, gin.H{"code": "account-suspended", "message": err.Error()})
+	case errors.Is(err, auth.ErrSignupNotAllowed):
+		c.JSON(http.StatusForbidden, gin.H{"code": "signup-not-allowed", "message": err.Error()})
+	case errors.Is(err, ErrAccountExists):
+		c.JSON(http.StatusConflict, gin.H{"code": "account-exists", "message": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+	}
+}
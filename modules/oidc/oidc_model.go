@@ -0,0 +1,35 @@
+package oidc
+
+import (
+	"time"
+)
+
+// ExternalIdentity links an account at an OIDC provider to a local user
+type ExternalIdentity struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	UserID    uint      `gorm:"index" json:"userId"`
+	Provider  string    `gorm:"type:varchar(64);uniqueIndex:idx_external_identity_subject" json:"provider"`
+	Subject   string    `gorm:"type:varchar(255);uniqueIndex:idx_external_identity_subject" json:"subject"`
+	Email     string    `gorm:"type:varchar(255)" json:"email"`
+	CreatedAt time.Time `gorm:"type:timestamp" json:"createdAt"`
+	UpdatedAt time.Time `gorm:"type:timestamp" json:"updatedAt"`
+}
+
+// LoginState is a pending authorization request, consumed by the callback. CookieHash ties it to the
+// browser that started the login, so nobody can get a victim to finish a login of their own.
+type LoginState struct {
+	ID           uint      `gorm:"primarykey" json:"id"`
+	StateHash    string    `gorm:"unique;type:varchar(64)" json:"-"`
+	CookieHash   string    `gorm:"type:varchar(64)" json:"-"`
+	Provider     string    `gorm:"type:varchar(64)" json:"provider"`
+	Nonce        string    `gorm:"type:varchar(64)" json:"-"`
+	CodeVerifier string    `gorm:"type:varchar(128)" json:"-"`
+	RedirectURL  string    `gorm:"type:text" json:"redirectUrl"`
+	ExpiresAt    time.Time `gorm:"type:timestamp;index" json:"expiresAt"`
+	CreatedAt    time.Time `gorm:"type:timestamp" json:"createdAt"`
+}
+
+// TableName keeps the table recognizable next to the other auth tables
+func (LoginState) TableName() string {
+	return "oidc_login_states"
+}
@@ -0,0 +1,9 @@
+package oidc
+
+import "go.uber.org/fx"
+
+// Module exports dependencies for the oidc module
+var Module = fx.Module("oidc",
+	fx.Provide(NewOidcService),
+	fx.Provide(NewOidcController),
+)
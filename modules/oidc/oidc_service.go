@@ -0,0 +1,344 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	gooidc "github.com/coreos/go-oidc/v3/oidc"
+	"github.com/irvanherz/gourze/config"
+	"github.com/irvanherz/gourze/modules/auth"
+	"github.com/irvanherz/gourze/modules/oidc/dto"
+	"github.com/irvanherz/gourze/modules/user"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+const loginStateTTL = 10 * time.Minute
+
+var (
+	ErrUnknownProvider    = errors.New("unknown identity provider")
+	ErrInvalidState       = errors.New("invalid or expired login state")
+	ErrInvalidRedirectURL = errors.New("redirect URL must point to the frontend")
+	ErrProviderDenied     = errors.New("identity provider denied the signin")
+	ErrInvalidIDToken     = errors.New("invalid ID token")
+	// ErrAccountExists is returned when the provider email belongs to a local account that hasn't
+	// verified it, linking would let whoever registered that account take over the external one
+	ErrAccountExists = errors.New("an account with this email already exists, sign in with your password first")
+)
+
+type OidcService interface {
+	// AuthorizationURL starts a login and returns the provider URL the browser must be sent to
+	AuthorizationURL(provider string, input dto.OidcLoginInput) (string, error)
+	// Callback finishes a login with the authorization code and signs the linked user in
+	Callback(provider string, input dto.OidcCallbackInput) (*dto.OidcCallbackResult, error)
+}
+
+type oidcService struct {
+	Db          *gorm.DB
+	Config      *config.Config
+	AuthService auth.AuthService
+
+	mu        sync.Mutex
+	providers map[string]*gooidc.Provider
+}
+
+// idTokenClaims are the standard claims we read from ID tokens
+type idTokenClaims struct {
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+}
+
+func NewOidcService(db *gorm.DB, conf *config.Config, authService auth.AuthService) OidcService {
+	return &oidcService{Db: db, Config: conf, AuthService: authService, providers: map[string]*gooidc.Provider{}}
+}
+
+// AuthorizationURL implements OidcService. The request is bound to a stored state, nonce and PKCE verifier,
+// and to the login cookie of the browser.
+func (s *oidcService) AuthorizationURL(provider string, input dto.OidcLoginInput) (string, error) {
+	providerConfig, err := s.providerConfig(provider)
+	if err != nil {
+		return "", err
+	}
+	if input.LoginCookie == "" {
+		return "", errors.New("login cookie is required")
+	}
+	if input.RedirectURL != "" && !s.isFrontendURL(input.RedirectURL) {
+		return "", ErrInvalidRedirectURL
+	}
+	oauthConfig, _, err := s.oauthConfig(providerConfig)
+	if err != nil {
+		return "", err
+	}
+
+	state, err := randomString(32)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := randomString(32)
+	if err != nil {
+		return "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+	loginState := LoginState{
+		StateHash:    hashString(state),
+		CookieHash:   hashString(input.LoginCookie),
+		Provider:     providerConfig.Name,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		RedirectURL:  input.RedirectURL,
+		ExpiresAt:    time.Now().Add(loginStateTTL),
+	}
+	// Drop states of logins that were never finished
+	if err := s.Db.Where("expires_at < ?", time.Now()).Delete(&LoginState{}).Error; err != nil {
+		return "", err
+	}
+	if err := s.Db.Create(&loginState).Error; err != nil {
+		return "", err
+	}
+	return oauthConfig.AuthCodeURL(state, gooidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), nil
+}
+
+// Callback implements OidcService.
+func (s *oidcService) Callback(provider string, input dto.OidcCallbackInput) (*dto.OidcCallbackResult, error) {
+	providerConfig, err := s.providerConfig(provider)
+	if err != nil {
+		return nil, err
+	}
+	loginState, err := s.consumeLoginState(providerConfig.Name, input.State, input.LoginCookie)
+	if err != nil {
+		return nil, err
+	}
+	if input.Error != "" {
+		return nil, fmt.Errorf("%w: %s %s", ErrProviderDenied, input.Error, input.ErrorDescription)
+	}
+	if input.Code == "" {
+		return nil, ErrProviderDenied
+	}
+
+	oauthConfig, oidcProvider, err := s.oauthConfig(providerConfig)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	token, err := oauthConfig.Exchange(ctx, input.Code, oauth2.VerifierOption(loginState.CodeVerifier))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrProviderDenied, err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, ErrInvalidIDToken
+	}
+	idToken, err := oidcProvider.Verifier(&gooidc.Config{ClientID: providerConfig.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	if idToken.Nonce != loginState.Nonce {
+		return nil, ErrInvalidIDToken
+	}
+	var claims idTokenClaims
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	linkedUser, err := s.findOrCreateUser(providerConfig.Name, idToken.Subject, claims)
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.AuthService.IssueTokens(*linkedUser)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.OidcCallbackResult{Auth: result, RedirectURL: loginState.RedirectURL}, nil
+}
+
+// findOrCreateUser returns the user linked to the external identity. Unknown identities are linked
+// to the local account with the same verified email, or get a new account.
+func (s *oidcService) findOrCreateUser(provider, subject string, claims idTokenClaims) (*user.User, error) {
+	var linkedUser user.User
+	err := s.Db.Transaction(func(tx *gorm.DB) error {
+		var identity ExternalIdentity
+		err := tx.Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error
+		if err == nil {
+			return tx.First(&linkedUser, identity.UserID).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		if claims.Email == "" || !claims.EmailVerified {
+			return fmt.Errorf("%w: the provider did not return a verified email", ErrProviderDenied)
+		}
+		err = tx.Where("email = ?", claims.Email).First(&linkedUser).Error
+		switch {
+		case err == nil:
+			if linkedUser.EmailVerifiedAt == nil {
+				return ErrAccountExists
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if err := s.createUser(tx, &linkedUser, claims); err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		identity = ExternalIdentity{UserID: linkedUser.ID, Provider: provider, Subject: subject, Email: claims.Email}
+		return tx.Create(&identity).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &linkedUser, nil
+}
+
+func (s *oidcService) createUser(tx *gorm.DB, newUser *user.User, claims idTokenClaims) error {
+	if err := auth.CheckSignupAllowed(s.Config, claims.Email, false); err != nil {
+		return err
+	}
+	username, err := s.availableUsername(tx, claims)
+	if err != nil {
+		return err
+	}
+	// Accounts created through a provider have no usable password until the user resets it
+	password, err := randomString(32)
+	if err != nil {
+		return err
+	}
+	hashedPassword, err := s.AuthService.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	*newUser = user.User{
+		Username:        username,
+		Email:           claims.Email,
+		FullName:        claims.Name,
+		Password:        hashedPassword,
+		Role:            user.Generic,
+		EmailVerifiedAt: &now,
+	}
+	return tx.Create(newUser).Error
+}
+
+var usernameInvalidChars = regexp.MustCompile(`[^a-z0-9_.]+`)
+
+// availableUsername derives a free username from the preferred username or the email
+func (s *oidcService) availableUsername(tx *gorm.DB, claims idTokenClaims) (string, error) {
+	base := claims.PreferredUsername
+	if base == "" {
+		base, _, _ = strings.Cut(claims.Email, "@")
+	}
+	base = usernameInvalidChars.ReplaceAllString(strings.ToLower(base), "_")
+	if base == "" {
+		base = "user"
+	}
+	username := base
+	for i := 0; i < 5; i++ {
+		var count int64
+		if err := tx.Model(&user.User{}).Where("username = ?", username).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return username, nil
+		}
+		suffix := make([]byte, 3)
+		if _, err := rand.Read(suffix); err != nil {
+			return "", err
+		}
+		username = base + "_" + hex.EncodeToString(suffix)
+	}
+	return "", fmt.Errorf("could not find a free username for %s", base)
+}
+
+// consumeLoginState deletes the state so it can't be replayed and returns it when still valid and
+// the callback comes from the browser that started the login
+func (s *oidcService) consumeLoginState(provider, state, loginCookie string) (*LoginState, error) {
+	var loginState LoginState
+	if err := s.Db.Where("state_hash = ? AND provider = ?", hashString(state), provider).First(&loginState).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidState
+		}
+		return nil, err
+	}
+	result := s.Db.Delete(&loginState)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 || time.Now().After(loginState.ExpiresAt) {
+		return nil, ErrInvalidState
+	}
+	if loginCookie == "" || subtle.ConstantTimeCompare([]byte(hashString(loginCookie)), []byte(loginState.CookieHash)) != 1 {
+		return nil, ErrInvalidState
+	}
+	return &loginState, nil
+}
+
+// isFrontendURL reports whether rawURL has the origin of Config.App.FrontendURL, so logins can't be used as open redirects
+func (s *oidcService) isFrontendURL(rawURL string) bool {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	frontend, err := url.Parse(s.Config.App.FrontendURL)
+	if err != nil {
+		return false
+	}
+	return target.Scheme == frontend.Scheme && target.Host == frontend.Host
+}
+
+func (s *oidcService) providerConfig(name string) (*config.OIDCProviderConfig, error) {
+	for _, provider := range s.Config.OIDC.Providers {
+		if provider.Name == name {
+			return &provider, nil
+		}
+	}
+	return nil, ErrUnknownProvider
+}
+
+// oauthConfig builds the OAuth2 client of a provider, fetching its discovery document on first use
+func (s *oidcService) oauthConfig(providerConfig *config.OIDCProviderConfig) (*oauth2.Config, *gooidc.Provider, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	provider, ok := s.providers[providerConfig.Name]
+	if !ok {
+		var err error
+		provider, err = gooidc.NewProvider(context.Background(), providerConfig.IssuerURL)
+		if err != nil {
+			return nil, nil, err
+		}
+		s.providers[providerConfig.Name] = provider
+	}
+	return &oauth2.Config{
+		ClientID:     providerConfig.ClientID,
+		ClientSecret: providerConfig.ClientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  fmt.Sprintf("%s/auth/oidc/%s/callback", strings.TrimSuffix(s.Config.OIDC.RedirectBaseURL, "/"), providerConfig.Name),
+		Scopes:       providerConfig.Scopes,
+	}, provider, nil
+}
+
+func randomString(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashString(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,230 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/irvanherz/gourze/config"
+	"github.com/irvanherz/gourze/modules/auth"
+	"github.com/irvanherz/gourze/modules/invite"
+	"github.com/irvanherz/gourze/modules/mail"
+	"github.com/irvanherz/gourze/modules/oidc/dto"
+	"github.com/irvanherz/gourze/modules/password"
+	"github.com/irvanherz/gourze/modules/user"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// stubProvider is a minimal OpenID provider: discovery, JWKS and a token endpoint checking PKCE
+type stubProvider struct {
+	server        *httptest.Server
+	key           *rsa.PrivateKey
+	challenge     string
+	nonce         string
+	subject       string
+	email         string
+	emailVerified bool
+}
+
+func newStubProvider() *stubProvider {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	p := &stubProvider{key: key, subject: "external-1", email: "jane@doe.com", emailVerified: true}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                p.server.URL,
+			"authorization_endpoint":                p.server.URL + "/authorize",
+			"token_endpoint":                        p.server.URL + "/token",
+			"jwks_uri":                              p.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test",
+				"alg": "RS256",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if r.PostForm.Get("code") != "valid-code" || base64.RawURLEncoding.EncodeToString(sum[:]) != p.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":            p.server.URL,
+			"sub":            p.subject,
+			"aud":            "gourze-client",
+			"exp":            time.Now().Add(time.Hour).Unix(),
+			"iat":            time.Now().Unix(),
+			"nonce":          p.nonce,
+			"email":          p.email,
+			"email_verified": p.emailVerified,
+			"name":           "Jane Doe",
+		})
+		token.Header["kid"] = "test"
+		idToken, _ := token.SignedString(key)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "provider-access-token",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     idToken,
+		})
+	})
+	p.server = httptest.NewServer(mux)
+	return p
+}
+
+type OidcServiceTestSuite struct {
+	suite.Suite
+	db       *gorm.DB
+	provider *stubProvider
+	service  OidcService
+}
+
+func (suite *OidcServiceTestSuite) SetupTest() {
+	suite.db, _ = gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	suite.db.AutoMigrate(&user.User{}, &auth.RefreshToken{}, &auth.TwoFactorCredential{}, &auth.Session{}, &ExternalIdentity{}, &LoginState{})
+	suite.provider = newStubProvider()
+
+	conf := &config.Config{
+		App:  config.AppConfig{FrontendURL: "http://localhost:3000"},
+		Auth: config.AuthConfig{JWTSecret: "testsecret"},
+		OIDC: config.OIDCConfig{
+			RedirectBaseURL: "http://localhost:8080",
+			Providers: []config.OIDCProviderConfig{{
+				Name:         "stub",
+				IssuerURL:    suite.provider.server.URL,
+				ClientID:     "gourze-client",
+				ClientSecret: "secret",
+				Scopes:       []string{"openid", "email", "profile"},
+			}},
+		},
+	}
+	authService := auth.NewAuthService(suite.db, conf, auth.NewMemoryRevocationStore(), mail.NewLogMailer(""), auth.NewKeyManager(suite.db, conf), auth.NewDatabaseAuditLogger(suite.db), password.NewPasswordPolicy(conf, password.NewBreachedPasswordChecker(conf)), invite.NewInviteService(suite.db))
+	suite.service = NewOidcService(suite.db, conf, authService)
+}
+
+func (suite *OidcServiceTestSuite) TearDownTest() {
+	suite.provider.server.Close()
+}
+
+// browserCookie is the login cookie of the browser the tests sign in with
+const browserCookie = "browser-cookie"
+
+// login runs the authorization request the way a browser would and returns the state
+func (suite *OidcServiceTestSuite) login() string {
+	authorizationURL, err := suite.service.AuthorizationURL("stub", dto.OidcLoginInput{LoginCookie: browserCookie})
+	suite.Require().NoError(err)
+	parsed, _ := url.Parse(authorizationURL)
+	query := parsed.Query()
+	suite.Equal("S256", query.Get("code_challenge_method"))
+	suite.Equal("http://localhost:8080/auth/oidc/stub/callback", query.Get("redirect_uri"))
+	suite.provider.challenge = query.Get("code_challenge")
+	suite.provider.nonce = query.Get("nonce")
+	return query.Get("state")
+}
+
+func (suite *OidcServiceTestSuite) TestCallback_CreatesAndLinksUser() {
+	result, err := suite.service.Callback("stub", dto.OidcCallbackInput{LoginCookie: browserCookie, Code: "valid-code", State: suite.login()})
+	suite.NoError(err)
+	suite.NotEmpty(result.Auth.AccessToken)
+	suite.Equal("jane@doe.com", result.Auth.User.Email)
+	suite.Equal("jane", result.Auth.User.Username)
+
+	// The second login finds the same account through the linked identity
+	suite.provider.email = "jane@other.com"
+	result, err = suite.service.Callback("stub", dto.OidcCallbackInput{LoginCookie: browserCookie, Code: "valid-code", State: suite.login()})
+	suite.NoError(err)
+	suite.Equal("jane@doe.com", result.Auth.User.Email)
+
+	var count int64
+	suite.db.Model(&user.User{}).Count(&count)
+	suite.Equal(int64(1), count)
+}
+
+func (suite *OidcServiceTestSuite) TestCallback_LinksVerifiedLocalAccount() {
+	now := time.Now()
+	suite.db.Create(&user.User{Username: "jane_doe", Email: "jane@doe.com", EmailVerifiedAt: &now})
+
+	result, err := suite.service.Callback("stub", dto.OidcCallbackInput{LoginCookie: browserCookie, Code: "valid-code", State: suite.login()})
+	suite.NoError(err)
+	suite.Equal("jane_doe", result.Auth.User.Username)
+
+	var identity ExternalIdentity
+	suite.NoError(suite.db.Where("provider = ? AND subject = ?", "stub", "external-1").First(&identity).Error)
+	suite.Equal(uint(1), identity.UserID)
+}
+
+func (suite *OidcServiceTestSuite) TestCallback_RefusesUnverifiedLocalAccount() {
+	suite.db.Create(&user.User{Username: "jane_doe", Email: "jane@doe.com"})
+
+	_, err := suite.service.Callback("stub", dto.OidcCallbackInput{LoginCookie: browserCookie, Code: "valid-code", State: suite.login()})
+	suite.ErrorIs(err, ErrAccountExists)
+}
+
+func (suite *OidcServiceTestSuite) TestCallback_StateIsSingleUse() {
+	state := suite.login()
+	_, err := suite.service.Callback("stub", dto.OidcCallbackInput{LoginCookie: browserCookie, Code: "valid-code", State: state})
+	suite.NoError(err)
+	_, err = suite.service.Callback("stub", dto.OidcCallbackInput{LoginCookie: browserCookie, Code: "valid-code", State: state})
+	suite.ErrorIs(err, ErrInvalidState)
+}
+
+func (suite *OidcServiceTestSuite) TestCallback_RequiresLoginCookie() {
+	// A callback URL of somebody else's login must not sign the victim in to that account
+	_, err := suite.service.Callback("stub", dto.OidcCallbackInput{Code: "valid-code", State: suite.login()})
+	suite.ErrorIs(err, ErrInvalidState)
+	_, err = suite.service.Callback("stub", dto.OidcCallbackInput{LoginCookie: "victim-cookie", Code: "valid-code", State: suite.login()})
+	suite.ErrorIs(err, ErrInvalidState)
+
+	var count int64
+	suite.db.Model(&user.User{}).Count(&count)
+	suite.Equal(int64(0), count)
+}
+
+func (suite *OidcServiceTestSuite) TestCallback_RejectsWrongNonce() {
+	state := suite.login()
+	suite.provider.nonce = "another-nonce"
+	_, err := suite.service.Callback("stub", dto.OidcCallbackInput{LoginCookie: browserCookie, Code: "valid-code", State: state})
+	suite.ErrorIs(err, ErrInvalidIDToken)
+}
+
+func (suite *OidcServiceTestSuite) TestCallback_RejectsWrongCode() {
+	_, err := suite.service.Callback("stub", dto.OidcCallbackInput{LoginCookie: browserCookie, Code: "stolen-code", State: suite.login()})
+	suite.ErrorIs(err, ErrProviderDenied)
+}
+
+func (suite *OidcServiceTestSuite) TestAuthorizationURL_Validation() {
+	_, err := suite.service.AuthorizationURL("unknown", dto.OidcLoginInput{})
+	suite.ErrorIs(err, ErrUnknownProvider)
+	_, err = suite.service.AuthorizationURL("stub", dto.OidcLoginInput{LoginCookie: browserCookie, RedirectURL: "http://localhost:3000.evil.example.com"})
+	suite.ErrorIs(err, ErrInvalidRedirectURL)
+	_, err = suite.service.AuthorizationURL("stub", dto.OidcLoginInput{LoginCookie: browserCookie, RedirectURL: "http://localhost:3000/courses"})
+	suite.NoError(err)
+}
+
+func TestOidcServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(OidcServiceTestSuite))
+}
@@ -1,4 +1,4 @@
-package dto
-
-type OrderUpdateInput struct {
-}
+package dto
+
+type OrderUpdateInput struct {
+}
@@ -1,86 +1,120 @@
-package order
-
-import (
-	"github.com/creasty/defaults"
-	"github.com/irvanherz/gourze/modules/order/dto"
-	"github.com/jinzhu/copier"
-	"gorm.io/gorm"
-)
-
-type OrderService interface {
-	FindManyOrders(filter *dto.OrderFilterInput) ([]Order, int64, error)
-	CreateOrder(input *dto.OrderCreateInput) (*Order, error)
-	FindOrderByID(id uint) (*Order, error)
-	UpdateOrderByID(id uint, input *dto.OrderUpdateInput) (*Order, error)
-	DeleteOrderByID(id uint) (*Order, error)
-}
-
-type orderService struct {
-	Db *gorm.DB
-}
-
-func NewOrderService(db *gorm.DB) OrderService {
-	return &orderService{Db: db}
-}
-func (s *orderService) FindManyOrders(filter *dto.OrderFilterInput) ([]Order, int64, error) {
-	var orders []Order
-	var count int64
-
-	if err := defaults.Set(filter); err != nil {
-		return nil, 0, err
-	}
-	query := s.Db
-	query = filter.ApplyFilter(query)
-
-	if err := query.Model(&Order{}).Count(&count).Error; err != nil {
-		return nil, 0, err
-	}
-
-	query = filter.ApplyPagination(query)
-
-	if err := query.Find(&orders).Error; err != nil {
-		return nil, 0, err
-	}
-	return orders, count, nil
-}
-
-func (s *orderService) CreateOrder(input *dto.OrderCreateInput) (*Order, error) {
-	var order Order
-	copier.Copy(&order, &input)
-
-	if err := s.Db.Create(&order).Error; err != nil {
-		return nil, err
-	}
-	return &order, nil
-}
-
-func (s *orderService) FindOrderByID(id uint) (*Order, error) {
-	var order Order
-	if err := s.Db.First(&order, id).Error; err != nil {
-		return nil, err
-	}
-	return &order, nil
-}
-
-func (s *orderService) UpdateOrderByID(id uint, input *dto.OrderUpdateInput) (*Order, error) {
-	var order Order
-	if err := s.Db.First(&order, id).Error; err != nil {
-		return nil, err
-	}
-	copier.Copy(&order, &input)
-	if err := s.Db.Save(&order).Error; err != nil {
-		return nil, err
-	}
-	return &order, nil
-}
-
-func (s *orderService) DeleteOrderByID(id uint) (*Order, error) {
-	var order Order
-	if err := s.Db.First(&order, id).Error; err != nil {
-		return nil, err
-	}
-	if err := s.Db.Delete(&Order{}, id).Error; err != nil {
-		return nil, err
-	}
-	return &order, nil
-}
+package order
+
+import (
+	"github.com/creasty/defaults"
+	"github.com/irvanherz/gourze/modules/order/dto"
+	"github.com/irvanherz/gourze/modules/rbac"
+	"github.com/jinzhu/copier"
+	"gorm.io/gorm"
+)
+
+// OrderService only returns orders of the actor, unless the actor holds order:manage. Orders are
+// changed and deleted with order:manage only, buyers go through payment and refunds instead.
+type OrderService interface {
+	FindManyOrders(actor rbac.Actor, filter *dto.OrderFilterInput) ([]Order, int64, error)
+	CreateOrder(actor rbac.Actor, input *dto.OrderCreateInput) (*Order, error)
+	FindOrderByID(actor rbac.Actor, id uint) (*Order, error)
+	UpdateOrderByID(actor rbac.Actor, id uint, input *dto.OrderUpdateInput) (*Order, error)
+	DeleteOrderByID(actor rbac.Actor, id uint) (*Order, error)
+}
+
+type orderService struct {
+	Db     *gorm.DB
+	Policy rbac.Policy
+}
+
+func NewOrderService(db *gorm.DB, policy rbac.Policy) OrderService {
+	return &orderService{Db: db, Policy: policy}
+}
+func (s *orderService) FindManyOrders(actor rbac.Actor, filter *dto.OrderFilterInput) ([]Order, int64, error) {
+	var orders []Order
+	var count int64
+
+	if err := defaults.Set(filter); err != nil {
+		return nil, 0, err
+	}
+	query, err := s.Policy.Scope(s.Db, actor, rbac.OrderManage, "user_id")
+	if err != nil {
+		return nil, 0, err
+	}
+	query = filter.ApplyFilter(query)
+
+	if err := query.Model(&Order{}).Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+
+	query = filter.ApplyPagination(query)
+
+	if err := query.Find(&orders).Error; err != nil {
+		return nil, 0, err
+	}
+	return orders, count, nil
+}
+
+func (s *orderService) CreateOrder(actor rbac.Actor, input *dto.OrderCreateInput) (*Order, error) {
+	if input.UserID == 0 {
+		input.UserID = actor.ID
+	}
+	if err := s.Policy.Authorize(actor, rbac.OrderManage, input.UserID); err != nil {
+		return nil, err
+	}
+	var order Order
+	copier.Copy(&order, &input)
+
+	if err := s.Db.Create(&order).Error; err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+func (s *orderService) FindOrderByID(actor rbac.Actor, id uint) (*Order, error) {
+	return s.findOrder(actor, id)
+}
+
+func (s *orderService) UpdateOrderByID(actor rbac.Actor, id uint, input *dto.OrderUpdateInput) (*Order, error) {
+	order, err := s.findManagedOrder(actor, id)
+	if err != nil {
+		return nil, err
+	}
+	copier.Copy(order, &input)
+	if err := s.Db.Save(order).Error; err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+func (s *orderService) DeleteOrderByID(actor rbac.Actor, id uint) (*Order, error) {
+	order, err := s.findManagedOrder(actor, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Db.Delete(&Order{}, id).Error; err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// findOrder loads an order within the scope of the actor, orders of other users are not found
+func (s *orderService) findOrder(actor rbac.Actor, id uint) (*Order, error) {
+	query, err := s.Policy.Scope(s.Db, actor, rbac.OrderManage, "user_id")
+	if err != nil {
+		return nil, err
+	}
+	var order Order
+	if err := query.First(&order, id).Error; err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// findManagedOrder loads an order the actor may change, which takes order:manage even for their own
+func (s *orderService) findManagedOrder(actor rbac.Actor, id uint) (*Order, error) {
+	order, err := s.findOrder(actor, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Policy.Authorize(actor, rbac.OrderManage); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
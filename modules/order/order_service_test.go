@@ -0,0 +1,88 @@
+package order
+
+import (
+	"testing"
+
+	"github.com/irvanherz/gourze/modules/order/dto"
+	"github.com/irvanherz/gourze/modules/rbac"
+	"github.com/irvanherz/gourze/modules/user"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type OrderServiceTestSuite struct {
+	suite.Suite
+	db      *gorm.DB
+	service OrderService
+	john    rbac.Actor
+	jane    rbac.Actor
+	admin   rbac.Actor
+}
+
+func (suite *OrderServiceTestSuite) SetupTest() {
+	suite.db, _ = gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	suite.db.AutoMigrate(&user.User{}, &Order{}, &OrderItem{}, &rbac.Permission{}, &rbac.Role{})
+	rbac.SeedRoles(suite.db)
+	suite.service = NewOrderService(suite.db, rbac.NewPolicy(rbac.NewRbacService(suite.db)))
+
+	suite.john = rbac.Actor{ID: 1, Role: user.Generic}
+	suite.jane = rbac.Actor{ID: 2, Role: user.Generic}
+	suite.admin = rbac.Actor{ID: 3, Role: user.Admin}
+	suite.db.Create(&Order{UserID: 1, Amount: 10})
+	suite.db.Create(&Order{UserID: 2, Amount: 20})
+}
+
+func (suite *OrderServiceTestSuite) TestFindManyOrders_ScopedToOwner() {
+	orders, count, err := suite.service.FindManyOrders(suite.john, &dto.OrderFilterInput{})
+	suite.NoError(err)
+	suite.Equal(int64(1), count)
+	suite.Equal(uint(1), orders[0].UserID)
+
+	// Filtering by another user doesn't widen the scope
+	_, count, _ = suite.service.FindManyOrders(suite.john, &dto.OrderFilterInput{UserId: &dto.UserIdFilter{Op: "equals", Val: []uint{2}}})
+	suite.Equal(int64(0), count)
+
+	_, count, _ = suite.service.FindManyOrders(suite.admin, &dto.OrderFilterInput{})
+	suite.Equal(int64(2), count)
+}
+
+func (suite *OrderServiceTestSuite) TestFindOrderByID_OtherUser() {
+	_, err := suite.service.FindOrderByID(suite.john, 2)
+	suite.ErrorIs(err, gorm.ErrRecordNotFound)
+	_, err = suite.service.DeleteOrderByID(suite.john, 2)
+	suite.ErrorIs(err, gorm.ErrRecordNotFound)
+
+	order, err := suite.service.FindOrderByID(suite.jane, 2)
+	suite.NoError(err)
+	suite.Equal(uint(2), order.ID)
+	_, err = suite.service.DeleteOrderByID(suite.admin, 2)
+	suite.NoError(err)
+}
+
+func (suite *OrderServiceTestSuite) TestDeleteOrderByID_PaidByOwner() {
+	suite.db.Model(&Order{}).Where("id = ?", 1).Update("status", Paid)
+
+	_, err := suite.service.DeleteOrderByID(suite.john, 1)
+	suite.ErrorIs(err, rbac.ErrForbidden)
+	_, err = suite.service.UpdateOrderByID(suite.john, 1, &dto.OrderUpdateInput{})
+	suite.ErrorIs(err, rbac.ErrForbidden)
+	var order Order
+	suite.NoError(suite.db.First(&order, 1).Error)
+	suite.Equal(Paid, order.Status)
+}
+
+func (suite *OrderServiceTestSuite) TestCreateOrder_OnBehalfOfOthers() {
+	order, err := suite.service.CreateOrder(suite.john, &dto.OrderCreateInput{})
+	suite.NoError(err)
+	suite.Equal(uint(1), order.UserID)
+
+	_, err = suite.service.CreateOrder(suite.john, &dto.OrderCreateInput{UserID: 2})
+	suite.ErrorIs(err, rbac.ErrForbidden)
+	_, err = suite.service.CreateOrder(suite.admin, &dto.OrderCreateInput{UserID: 2})
+	suite.NoError(err)
+}
+
+func TestOrderServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(OrderServiceTestSuite))
+}
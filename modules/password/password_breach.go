@@ -0,0 +1,86 @@
+package password
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/irvanherz/gourze/config"
+)
+
+// hashPrefixLength is the number of hex characters of the SHA-1 hash passwords are looked up by
+const hashPrefixLength = 5
+
+//go:embed password_breached_hashes.txt
+var bundledBreachedHashes []byte
+
+// BreachedPasswordChecker tells whether a password is known from data breaches. Lookups never
+// leave the server: like the k-anonymity model of Have I Been Pwned, the SHA-1 hash of the password
+// is looked up by its 5 character prefix in a local list of hash suffixes.
+type BreachedPasswordChecker interface {
+	IsBreached(password string) (bool, error)
+}
+
+type breachedPasswordChecker struct {
+	Config *config.Config
+	// bundled maps hash prefixes to the hash suffixes of the bundled list
+	bundled map[string]map[string]struct{}
+}
+
+func NewBreachedPasswordChecker(conf *config.Config) BreachedPasswordChecker {
+	bundled := map[string]map[string]struct{}{}
+	scanner := bufio.NewScanner(bytes.NewReader(bundledBreachedHashes))
+	for scanner.Scan() {
+		hash := strings.TrimSpace(scanner.Text())
+		if len(hash) != sha1.Size*2 || strings.HasPrefix(hash, "#") {
+			continue
+		}
+		prefix, suffix := hash[:hashPrefixLength], hash[hashPrefixLength:]
+		if bundled[prefix] == nil {
+			bundled[prefix] = map[string]struct{}{}
+		}
+		bundled[prefix][suffix] = struct{}{}
+	}
+	return &breachedPasswordChecker{Config: conf, bundled: bundled}
+}
+
+func (c *breachedPasswordChecker) IsBreached(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:hashPrefixLength], hash[hashPrefixLength:]
+	if _, ok := c.bundled[prefix][suffix]; ok {
+		return true, nil
+	}
+	if c.Config.Password.BreachedHashesDir == "" {
+		return false, nil
+	}
+	return rangeFileContains(filepath.Join(c.Config.Password.BreachedHashesDir, prefix+".txt"), suffix)
+}
+
+// rangeFileContains looks for a hash suffix in a range file, which lists one "SUFFIX:COUNT"
+// per line like the files of the Have I Been Pwned downloader
+func rangeFileContains(path string, suffix string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lineSuffix, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if strings.EqualFold(lineSuffix, suffix) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
@@ -0,0 +1,9 @@
+package password
+
+import "go.uber.org/fx"
+
+// Module exports dependencies for the password module
+var Module = fx.Module("password",
+	fx.Provide(NewBreachedPasswordChecker),
+	fx.Provide(NewPasswordPolicy),
+)
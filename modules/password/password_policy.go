@@ -0,0 +1,113 @@
+package password
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/irvanherz/gourze/config"
+)
+
+// maxLength is the number of bytes bcrypt hashes, longer passwords would be silently truncated
+const maxLength = 72
+
+var (
+	ErrWeakPassword     = errors.New("password is too weak")
+	ErrBreachedPassword = errors.New("password has appeared in a data breach, choose another one")
+)
+
+// PasswordPolicy validates new passwords against Config.Password
+type PasswordPolicy interface {
+	// Validate checks a password chosen by the user identified by identifiers, such as their
+	// username and email, which the password must not contain
+	Validate(password string, identifiers ...string) error
+}
+
+type passwordPolicy struct {
+	Config          *config.Config
+	BreachedChecker BreachedPasswordChecker
+}
+
+func NewPasswordPolicy(conf *config.Config, breachedChecker BreachedPasswordChecker) PasswordPolicy {
+	return &passwordPolicy{Config: conf, BreachedChecker: breachedChecker}
+}
+
+func (p *passwordPolicy) Validate(password string, identifiers ...string) error {
+	if utf8.RuneCountInString(password) < p.minLength() {
+		return fmt.Errorf("%w: it must be at least %d characters long", ErrWeakPassword, p.minLength())
+	}
+	if len(password) > maxLength {
+		return fmt.Errorf("%w: it must be at most %d bytes long", ErrWeakPassword, maxLength)
+	}
+	if minClasses := int(p.Config.Password.MinCharacterClasses); characterClasses(password) < minClasses {
+		return fmt.Errorf("%w: it must mix at least %d of lowercase letters, uppercase letters, digits and symbols", ErrWeakPassword, minClasses)
+	}
+	lowered := strings.ToLower(password)
+	for _, identifier := range identifiers {
+		for _, part := range identifierParts(identifier) {
+			if strings.Contains(lowered, part) {
+				return fmt.Errorf("%w: it must not contain your username or email address", ErrWeakPassword)
+			}
+		}
+	}
+	breached, err := p.BreachedChecker.IsBreached(password)
+	if err != nil {
+		// The list of breached passwords is a safety net, an unreadable list doesn't block users
+		fmt.Println("Failed to check breached passwords:", err)
+		return nil
+	}
+	if breached {
+		return ErrBreachedPassword
+	}
+	return nil
+}
+
+func (p *passwordPolicy) minLength() int {
+	if p.Config.Password.MinLength == 0 {
+		return 10
+	}
+	return int(p.Config.Password.MinLength)
+}
+
+// characterClasses counts which of lowercase letters, uppercase letters, digits and symbols the password uses
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	count := 0
+	for _, used := range []bool{lower, upper, digit, symbol} {
+		if used {
+			count++
+		}
+	}
+	return count
+}
+
+// identifierParts returns the lowercased identifier, and the local part of email addresses.
+// Parts shorter than 3 characters are ignored, they would match too many passwords.
+func identifierParts(identifier string) []string {
+	identifier = strings.ToLower(strings.TrimSpace(identifier))
+	parts := []string{identifier}
+	if localPart, _, found := strings.Cut(identifier, "@"); found {
+		parts = append(parts, localPart)
+	}
+	var result []string
+	for _, part := range parts {
+		if len(part) >= 3 {
+			result = append(result, part)
+		}
+	}
+	return result
+}
@@ -0,0 +1,71 @@
+package password
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/irvanherz/gourze/config"
+	"github.com/stretchr/testify/suite"
+)
+
+type PasswordPolicyTestSuite struct {
+	suite.Suite
+	config *config.Config
+	policy PasswordPolicy
+}
+
+func (suite *PasswordPolicyTestSuite) SetupTest() {
+	suite.config = &config.Config{
+		Password: config.PasswordConfig{MinLength: 10, MinCharacterClasses: 3},
+	}
+	suite.policy = NewPasswordPolicy(suite.config, NewBreachedPasswordChecker(suite.config))
+}
+
+func (suite *PasswordPolicyTestSuite) TestValidate_Strong() {
+	suite.NoError(suite.policy.Validate("Correct-Horse-42", "john_doe", "john@doe.com"))
+}
+
+func (suite *PasswordPolicyTestSuite) TestValidate_Length() {
+	suite.ErrorIs(suite.policy.Validate("Sh0rt-pw"), ErrWeakPassword)
+	suite.ErrorIs(suite.policy.Validate("A1-"+strings.Repeat("x", 70)), ErrWeakPassword)
+}
+
+func (suite *PasswordPolicyTestSuite) TestValidate_CharacterClasses() {
+	suite.ErrorIs(suite.policy.Validate("correcthorsebattery"), ErrWeakPassword)
+	suite.NoError(suite.policy.Validate("correct horse battery 9"))
+
+	suite.config.Password.MinCharacterClasses = 0
+	suite.NoError(suite.policy.Validate("correcthorsebattery"))
+}
+
+func (suite *PasswordPolicyTestSuite) TestValidate_Identifiers() {
+	suite.ErrorIs(suite.policy.Validate("John_Doe-2024!", "john_doe", "jd@doe.com"), ErrWeakPassword)
+	suite.ErrorIs(suite.policy.Validate("Johnny-Mail-99", "jd", "johnny@doe.com"), ErrWeakPassword)
+	// Short identifiers would match too many passwords
+	suite.NoError(suite.policy.Validate("Correct-Horse-42", "jd", "co@doe.com"))
+}
+
+func (suite *PasswordPolicyTestSuite) TestValidate_BundledBreachedList() {
+	suite.ErrorIs(suite.policy.Validate("Password123!"), ErrBreachedPassword)
+}
+
+func (suite *PasswordPolicyTestSuite) TestValidate_BreachedHashesDir() {
+	sum := sha1.Sum([]byte("Correct-Horse-42"))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	dir := suite.T().TempDir()
+	content := "0018A45C4D1DEF81644B54AB7F969B88D65:3\n" + hash[hashPrefixLength:] + ":12\n"
+	suite.Require().NoError(os.WriteFile(filepath.Join(dir, hash[:hashPrefixLength]+".txt"), []byte(content), 0o644))
+
+	suite.config.Password.BreachedHashesDir = dir
+	suite.ErrorIs(suite.policy.Validate("Correct-Horse-42"), ErrBreachedPassword)
+	// Prefixes without a range file are not breached
+	suite.NoError(suite.policy.Validate("Staple-Battery-77"))
+}
+
+func TestPasswordPolicyTestSuite(t *testing.T) {
+	suite.Run(t, new(PasswordPolicyTestSuite))
+}
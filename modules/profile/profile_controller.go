@@ -0,0 +1,201 @@
+package profile
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/irvanherz/gourze/config"
+	"github.com/irvanherz/gourze/modules/auth"
+	authDto "github.com/irvanherz/gourze/modules/auth/dto"
+	"github.com/irvanherz/gourze/modules/password"
+	"github.com/irvanherz/gourze/modules/user"
+	"github.com/irvanherz/gourze/modules/user/dto"
+	"github.com/irvanherz/gourze/utils"
+	"gorm.io/gorm"
+)
+
+type ProfileController interface {
+	FindProfile(*gin.Context)
+	UpdateProfile(*gin.Context)
+	ChangePassword(*gin.Context)
+	ChangeEmail(*gin.Context)
+	DeleteAccount(*gin.Context)
+	ExportData(*gin.Context)
+	FindPublicProfile(*gin.Context)
+}
+
+type profileController struct {
+	Service ProfileService
+	Config  *config.Config
+}
+
+func NewProfileController(service ProfileService, conf *config.Config) ProfileController {
+	return &profileController{service, conf}
+}
+
+func (pc *profileController) FindProfile(c *gin.Context) {
+	currentUser, err := utils.GetCurrentUser(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"code": "unauthorized", "message": "Unauthorized"})
+		return
+	}
+	profile, err := pc.Service.FindProfile(currentUser.Actor())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Success", "data": profile})
+}
+
+func (pc *profileController) UpdateProfile(c *gin.Context) {
+	currentUser, err := utils.GetCurrentUser(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"code": "unauthorized", "message": "Unauthorized"})
+		return
+	}
+	var input dto.UserProfileUpdateInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
+		return
+	}
+	profile, err := pc.Service.UpdateProfile(currentUser.Actor(), &input)
+	if err != nil {
+		switch {
+		case errors.Is(err, user.ErrInvalidUsername), errors.Is(err, ErrInvalidAvatar):
+			c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
+		case errors.Is(err, user.ErrUsernameTaken):
+			c.JSON(http.StatusConflict, gin.H{"code": "username-taken", "message": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Profile updated successfully", "data": profile})
+}
+
+// ChangePassword signs out every other session of the current user and returns new tokens
+func (pc *profileController) ChangePassword(c *gin.Context) {
+	currentUser, err := utils.GetCurrentUser(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"code": "unauthorized", "message": "Unauthorized"})
+		return
+	}
+	var input authDto.AuthChangePasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
+		return
+	}
+	result, err := pc.Service.ChangePassword(currentUser.Actor(), input)
+	if err != nil {
+		if errors.Is(err, password.ErrWeakPassword) || errors.Is(err, password.ErrBreachedPassword) {
+			c.JSON(http.StatusBadRequest, gin.H{"code": "weak-password", "message": err.Error()})
+			return
+		}
+		auth.RespondSigninError(c, err)
+		return
+	}
+	if !input.SkipCookies {
+		auth.SetAuthCookies(c, pc.Config, result)
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Password changed successfully", "data": result})
+}
+
+// ChangeEmail switches the current user to an unverified email address and sends a verification link to it
+func (pc *profileController) ChangeEmail(c *gin.Context) {
+	currentUser, err := utils.GetCurrentUser(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"code": "unauthorized", "message": "Unauthorized"})
+		return
+	}
+	var input dto.UserEmailChangeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
+		return
+	}
+	profile, err := pc.Service.ChangeEmail(currentUser.Actor(), &input)
+	if err != nil {
+		switch {
+		case errors.Is(err, user.ErrIncorrectPassword):
+			c.JSON(http.StatusUnauthorized, gin.H{"code": "invalid-credentials", "message": err.Error()})
+		case errors.Is(err, user.ErrEmailTaken):
+			c.JSON(http.StatusConflict, gin.H{"code": "email-taken", "message": err.Error()})
+		case errors.Is(err, auth.ErrEmailNotAllowed):
+			c.JSON(http.StatusForbidden, gin.H{"code": "email-not-allowed", "message": err.Error()})
+		default:
+			auth.RespondSigninError(c, err)
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Email changed, check your inbox to verify it", "data": profile})
+}
+
+// DeleteAccount anonymizes the current user and signs them out everywhere
+func (pc *profileController) DeleteAccount(c *gin.Context) {
+	currentUser, err := utils.GetCurrentUser(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"code": "unauthorized", "message": "Unauthorized"})
+		return
+	}
+	var input dto.UserAccountDeleteInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
+		return
+	}
+	if err := pc.Service.DeleteAccount(currentUser.Actor(), &input); err != nil {
+		if errors.Is(err, user.ErrIncorrectPassword) {
+			c.JSON(http.StatusUnauthorized, gin.H{"code": "invalid-credentials", "message": err.Error()})
+			return
+		}
+		auth.RespondSigninError(c, err)
+		return
+	}
+	auth.ClearAuthCookies(c, pc.Config)
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Account deleted successfully"})
+}
+
+// ExportData downloads a ZIP archive of everything stored about the current user
+func (pc *profileController) ExportData(c *gin.Context) {
+	currentUser, err := utils.GetCurrentUser(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"code": "unauthorized", "message": "Unauthorized"})
+		return
+	}
+	export, err := pc.Service.ExportData(currentUser.Actor())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+		return
+	}
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="gourze-export-%d.zip"`, currentUser.ID))
+	c.Status(http.StatusOK)
+	if err := export.WriteZip(c.Writer); err != nil {
+		// The response has started, the client gets a truncated archive
+		fmt.Println("Failed to write data export:", err)
+	}
+}
+
+// FindPublicProfile serves the profile of any user, visitors don't need to sign in
+func (pc *profileController) FindPublicProfile(c *gin.Context) {
+	uid, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": "Invalid user ID"})
+		return
+	}
+	var viewerID uint
+	if currentUser, err := utils.GetCurrentUser(c); err == nil {
+		viewerID = currentUser.ID
+	}
+	profile, err := pc.Service.FindPublicProfile(viewerID, uint(uid))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"code": "not-found", "message": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Success", "data": profile})
+}
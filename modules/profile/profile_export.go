@@ -0,0 +1,103 @@
+package profile
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+
+	"github.com/irvanherz/gourze/modules/apikey"
+	"github.com/irvanherz/gourze/modules/auth"
+	"github.com/irvanherz/gourze/modules/course"
+	"github.com/irvanherz/gourze/modules/follow"
+	"github.com/irvanherz/gourze/modules/instructor"
+	"github.com/irvanherz/gourze/modules/media"
+	"github.com/irvanherz/gourze/modules/oidc"
+	"github.com/irvanherz/gourze/modules/order"
+	"github.com/irvanherz/gourze/modules/rbac"
+	"github.com/irvanherz/gourze/modules/user"
+	"gorm.io/gorm"
+)
+
+// AccountExport is everything stored about a user, as handed out by GET /me/export.
+// Secrets such as password hashes and keys are left out by the json tags of the models.
+type AccountExport struct {
+	Profile     *user.User
+	Orders      []order.Order
+	Enrollments []course.CourseUser
+	Courses     []course.Course
+	Media       []media.Media
+	Sessions    []auth.Session
+	Passkeys    []auth.PasskeyCredential
+	Identities  []oidc.ExternalIdentity
+	ApiKeys     []apikey.ApiKey
+	Following   []follow.Follow
+	// InstructorApplications include the payout details the user applied with
+	InstructorApplications []instructor.Application
+}
+
+// ExportData implements ProfileService
+func (s *profileService) ExportData(actor rbac.Actor) (*AccountExport, error) {
+	profile, err := s.UserService.FindUserByID(actor.ID)
+	if err != nil {
+		return nil, err
+	}
+	export := &AccountExport{Profile: profile}
+	queries := []struct {
+		query *gorm.DB
+		dest  interface{}
+	}{
+		{s.Db.Preload("Items"), &export.Orders},
+		{s.Db.Preload("Course"), &export.Enrollments},
+		{s.Db.Preload("Chapters"), &export.Courses},
+		{s.Db, &export.Media},
+		{s.Db, &export.Sessions},
+		{s.Db, &export.Passkeys},
+		{s.Db, &export.Identities},
+		{s.Db, &export.ApiKeys},
+		{s.Db, &export.InstructorApplications},
+	}
+	for _, q := range queries {
+		if err := q.query.Where("user_id = ?", actor.ID).Order("id").Find(q.dest).Error; err != nil {
+			return nil, err
+		}
+	}
+	if err := s.Db.Where("follower_id = ?", actor.ID).Order("id").Find(&export.Following).Error; err != nil {
+		return nil, err
+	}
+	return export, nil
+}
+
+// WriteZip writes the export as a ZIP archive holding one JSON file per kind of data
+func (e *AccountExport) WriteZip(w io.Writer) error {
+	archive := zip.NewWriter(w)
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", e.Profile},
+		{"orders.json", e.Orders},
+		{"enrollments.json", e.Enrollments},
+		{"courses.json", e.Courses},
+		{"media.json", e.Media},
+		{"sessions.json", e.Sessions},
+		{"passkeys.json", e.Passkeys},
+		{"identities.json", e.Identities},
+		{"api-keys.json", e.ApiKeys},
+		{"following.json", e.Following},
+		{"instructor-applications.json", e.InstructorApplications},
+	}
+	for _, file := range files {
+		content, err := json.MarshalIndent(file.data, "", "  ")
+		if err != nil {
+			return err
+		}
+		fw, err := archive.Create(file.name)
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(content); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
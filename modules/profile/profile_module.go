@@ -0,0 +1,9 @@
+package profile
+
+import "go.uber.org/fx"
+
+// Module exports dependencies for the profile module
+var Module = fx.Module("profile",
+	fx.Provide(NewProfileService),
+	fx.Provide(NewProfileController),
+)
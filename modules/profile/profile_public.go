@@ -0,0 +1,133 @@
+package profile
+
+import (
+	"errors"
+	"time"
+
+	"github.com/irvanherz/gourze/modules/course"
+	"github.com/irvanherz/gourze/modules/follow"
+	"github.com/irvanherz/gourze/modules/media"
+	"github.com/irvanherz/gourze/modules/user/dto"
+	"gorm.io/gorm"
+)
+
+// PublicProfile is what anyone sees of a user, as served by GET /profiles/:id
+type PublicProfile struct {
+	ID          uint                `json:"id"`
+	Username    string              `json:"username"`
+	FullName    string              `json:"fullName"`
+	Bio         string              `json:"bio"`
+	Avatar      *media.Media        `json:"avatar"`
+	Headline    string              `json:"headline"`
+	SocialLinks dto.UserSocialLinks `json:"socialLinks"`
+	Courses     []PublishedCourse   `json:"courses"`
+	Stats       PublicProfileStats  `json:"stats"`
+	// Following tells whether the signed in viewer follows the user
+	Following bool      `json:"following"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type PublishedCourse struct {
+	ID          uint      `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Price       float64   `json:"price"`
+	CategoryID  uint      `json:"categoryId"`
+	PublishedAt time.Time `json:"publishedAt"`
+	Students    int64     `json:"students"`
+}
+
+type PublicProfileStats struct {
+	Courses int64 `json:"courses"`
+	// Students counts every learner once, however many of the courses they are enrolled in
+	Students  int64 `json:"students"`
+	Followers int64 `json:"followers"`
+}
+
+// FindPublicProfile implements ProfileService. Suspended users have no public profile. viewerID is 0
+// for visitors who aren't signed in.
+func (s *profileService) FindPublicProfile(viewerID uint, id uint) (*PublicProfile, error) {
+	found, err := s.UserService.FindUserByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if found.IsSuspended() {
+		return nil, gorm.ErrRecordNotFound
+	}
+	meta, err := found.ProfileMeta()
+	if err != nil {
+		return nil, err
+	}
+	profile := &PublicProfile{
+		ID:          found.ID,
+		Username:    found.Username,
+		FullName:    found.FullName,
+		Bio:         found.Bio,
+		Headline:    meta.Headline,
+		SocialLinks: meta.SocialLinks,
+		Courses:     []PublishedCourse{},
+		CreatedAt:   found.CreatedAt,
+	}
+	if found.AvatarID != nil {
+		var avatar media.Media
+		if err := s.Db.First(&avatar, *found.AvatarID).Error; err == nil {
+			profile.Avatar = &avatar
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+
+	var courses []course.Course
+	if err := s.Db.Where("user_id = ? AND published_at IS NOT NULL", id).Order("published_at DESC").Find(&courses).Error; err != nil {
+		return nil, err
+	}
+	if len(courses) > 0 {
+		courseIDs := make([]uint, len(courses))
+		for i, c := range courses {
+			courseIDs[i] = c.ID
+		}
+		var enrollments []struct {
+			CourseID uint
+			Students int64
+		}
+		err := s.Db.Model(&course.CourseUser{}).
+			Select("course_id, COUNT(DISTINCT user_id) AS students").
+			Where("course_id IN ?", courseIDs).
+			Group("course_id").
+			Scan(&enrollments).Error
+		if err != nil {
+			return nil, err
+		}
+		students := map[uint]int64{}
+		for _, e := range enrollments {
+			students[e.CourseID] = e.Students
+		}
+		for _, c := range courses {
+			profile.Courses = append(profile.Courses, PublishedCourse{
+				ID:          c.ID,
+				Name:        c.Name,
+				Description: c.Description,
+				Price:       c.Price,
+				CategoryID:  c.CategoryID,
+				PublishedAt: *c.PublishedAt,
+				Students:    students[c.ID],
+			})
+		}
+		if err := s.Db.Model(&course.CourseUser{}).Where("course_id IN ?", courseIDs).Distinct("user_id").Count(&profile.Stats.Students).Error; err != nil {
+			return nil, err
+		}
+	}
+	profile.Stats.Courses = int64(len(courses))
+
+	if err := s.Db.Model(&follow.Follow{}).Where("instructor_id = ?", id).Count(&profile.Stats.Followers).Error; err != nil {
+		return nil, err
+	}
+	if viewerID != 0 {
+		var following int64
+		if err := s.Db.Model(&follow.Follow{}).Where("follower_id = ? AND instructor_id = ?", viewerID, id).Count(&following).Error; err != nil {
+			return nil, err
+		}
+		profile.Following = following > 0
+	}
+	return profile, nil
+}
@@ -0,0 +1,122 @@
+package profile
+
+import (
+	"errors"
+
+	"github.com/irvanherz/gourze/config"
+	"github.com/irvanherz/gourze/modules/apikey"
+	"github.com/irvanherz/gourze/modules/auth"
+	authDto "github.com/irvanherz/gourze/modules/auth/dto"
+	"github.com/irvanherz/gourze/modules/follow"
+	"github.com/irvanherz/gourze/modules/instructor"
+	"github.com/irvanherz/gourze/modules/media"
+	"github.com/irvanherz/gourze/modules/oidc"
+	"github.com/irvanherz/gourze/modules/rbac"
+	"github.com/irvanherz/gourze/modules/user"
+	"github.com/irvanherz/gourze/modules/user/dto"
+	"gorm.io/gorm"
+)
+
+var ErrInvalidAvatar = errors.New("avatar must be an image you uploaded")
+
+// ProfileService lets users manage their own account
+type ProfileService interface {
+	FindProfile(actor rbac.Actor) (*user.User, error)
+	UpdateProfile(actor rbac.Actor, input *dto.UserProfileUpdateInput) (*user.User, error)
+	ChangePassword(actor rbac.Actor, input authDto.AuthChangePasswordInput) (*authDto.AuthResultDto, error)
+	ChangeEmail(actor rbac.Actor, input *dto.UserEmailChangeInput) (*user.User, error)
+	DeleteAccount(actor rbac.Actor, input *dto.UserAccountDeleteInput) error
+	ExportData(actor rbac.Actor) (*AccountExport, error)
+	FindPublicProfile(viewerID uint, id uint) (*PublicProfile, error)
+}
+
+type profileService struct {
+	Db           *gorm.DB
+	Config       *config.Config
+	UserService  user.UserService
+	MediaService media.MediaService
+	AuthService  auth.AuthService
+}
+
+func NewProfileService(db *gorm.DB, conf *config.Config, userService user.UserService, mediaService media.MediaService, authService auth.AuthService) ProfileService {
+	return &profileService{Db: db, Config: conf, UserService: userService, MediaService: mediaService, AuthService: authService}
+}
+
+func (s *profileService) FindProfile(actor rbac.Actor) (*user.User, error) {
+	return s.UserService.FindUserByID(actor.ID)
+}
+
+// UpdateProfile implements ProfileService. Admins can see media of other users, but can only
+// pick their own as avatar.
+func (s *profileService) UpdateProfile(actor rbac.Actor, input *dto.UserProfileUpdateInput) (*user.User, error) {
+	if input.AvatarID != nil && *input.AvatarID != 0 {
+		avatar, err := s.MediaService.FindMediaByID(actor, *input.AvatarID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, rbac.ErrForbidden) {
+				return nil, ErrInvalidAvatar
+			}
+			return nil, err
+		}
+		if avatar.UserID != actor.ID || avatar.Type != media.Image {
+			return nil, ErrInvalidAvatar
+		}
+	}
+	return s.UserService.UpdateProfile(actor.ID, input)
+}
+
+// ChangePassword implements ProfileService. Other sessions are signed out, see AuthService.ChangePassword.
+func (s *profileService) ChangePassword(actor rbac.Actor, input authDto.AuthChangePasswordInput) (*authDto.AuthResultDto, error) {
+	return s.AuthService.ChangePassword(input, actor.ID)
+}
+
+// ChangeEmail implements ProfileService. A verification link is sent to the new address, which
+// must satisfy the signup domain rule, see auth.CheckEmailAllowed.
+func (s *profileService) ChangeEmail(actor rbac.Actor, input *dto.UserEmailChangeInput) (*user.User, error) {
+	if err := auth.CheckEmailAllowed(s.Config, input.Email); err != nil {
+		return nil, err
+	}
+	if err := s.AuthService.ConfirmPassword(actor.ID, input.CurrentPassword); err != nil {
+		return nil, err
+	}
+	previous, err := s.UserService.FindUserByID(actor.ID)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := s.UserService.ChangeEmail(actor.ID, input)
+	if err != nil {
+		return nil, err
+	}
+	if updated.Email == previous.Email {
+		return updated, nil
+	}
+	if err := s.AuthService.ResendEmailVerification(actor.ID); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// DeleteAccount implements ProfileService. The user is anonymized along with their credentials, see
+// UserService.DeleteAccount, then signed out everywhere. Like ChangeEmail, password guesses count
+// towards the signin lockout. Follows go both ways. Orders are kept for accounting.
+func (s *profileService) DeleteAccount(actor rbac.Actor, input *dto.UserAccountDeleteInput) error {
+	if err := s.AuthService.ConfirmPassword(actor.ID, input.CurrentPassword); err != nil {
+		return err
+	}
+	err := s.UserService.DeleteAccount(actor.ID, input, func(tx *gorm.DB) error {
+		credentials := []interface{}{
+			&auth.Session{}, &auth.RefreshToken{}, &auth.OneTimeToken{}, &auth.TwoFactorCredential{},
+			&auth.RecoveryCode{}, &auth.PasskeyCredential{}, &oidc.ExternalIdentity{}, &apikey.ApiKey{},
+			&instructor.Application{},
+		}
+		for _, model := range credentials {
+			if err := tx.Where("user_id = ?", actor.ID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Where("follower_id = ? OR instructor_id = ?", actor.ID, actor.ID).Delete(&follow.Follow{}).Error
+	})
+	if err != nil {
+		return err
+	}
+	return s.AuthService.SignoutAll(actor.ID)
+}
@@ -0,0 +1,257 @@
+package profile
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/irvanherz/gourze/config"
+	"github.com/irvanherz/gourze/modules/apikey"
+	"github.com/irvanherz/gourze/modules/auth"
+	"github.com/irvanherz/gourze/modules/course"
+	"github.com/irvanherz/gourze/modules/follow"
+	"github.com/irvanherz/gourze/modules/instructor"
+	"github.com/irvanherz/gourze/modules/media"
+	"github.com/irvanherz/gourze/modules/oidc"
+	"github.com/irvanherz/gourze/modules/order"
+	"github.com/irvanherz/gourze/modules/password"
+	"github.com/irvanherz/gourze/modules/rbac"
+	"github.com/irvanherz/gourze/modules/user"
+	"github.com/irvanherz/gourze/modules/user/dto"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/datatypes"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// fakeMediaService serves media from a map, regardless of the actor
+type fakeMediaService struct {
+	media.MediaService
+	medias map[uint]media.Media
+}
+
+func (s *fakeMediaService) FindMediaByID(actor rbac.Actor, id uint) (*media.Media, error) {
+	found, ok := s.medias[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &found, nil
+}
+
+// fakeAuthService records the users verification emails are sent to, the users signed out and the
+// users whose password was confirmed
+type fakeAuthService struct {
+	auth.AuthService
+	verificationsSent  []uint
+	signedOut          []uint
+	passwordsConfirmed []uint
+}
+
+func (s *fakeAuthService) ConfirmPassword(userID uint, currentPassword string) error {
+	s.passwordsConfirmed = append(s.passwordsConfirmed, userID)
+	return nil
+}
+
+func (s *fakeAuthService) ResendEmailVerification(userID uint) error {
+	s.verificationsSent = append(s.verificationsSent, userID)
+	return nil
+}
+
+func (s *fakeAuthService) SignoutAll(userID uint) error {
+	s.signedOut = append(s.signedOut, userID)
+	return nil
+}
+
+type ProfileServiceTestSuite struct {
+	suite.Suite
+	db          *gorm.DB
+	config      *config.Config
+	authService *fakeAuthService
+	service     ProfileService
+	actor       rbac.Actor
+}
+
+func (suite *ProfileServiceTestSuite) SetupTest() {
+	suite.db, _ = gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	suite.db.AutoMigrate(&user.User{}, &order.Order{}, &order.OrderItem{}, &course.Course{}, &course.CourseUser{}, &course.Chapter{}, &media.Media{},
+		&auth.Session{}, &auth.RefreshToken{}, &auth.OneTimeToken{}, &auth.TwoFactorCredential{}, &auth.RecoveryCode{}, &auth.PasskeyCredential{},
+		&oidc.ExternalIdentity{}, &apikey.ApiKey{}, &follow.Follow{}, &instructor.Application{})
+	suite.config = &config.Config{}
+	suite.authService = &fakeAuthService{}
+	userService := user.NewUserService(suite.db, password.NewPasswordPolicy(suite.config, password.NewBreachedPasswordChecker(suite.config)), suite.authService)
+	mediaService := &fakeMediaService{medias: map[uint]media.Media{
+		1: {ID: 1, UserID: 1, Type: media.Image},
+		2: {ID: 2, UserID: 2, Type: media.Image},
+		3: {ID: 3, UserID: 1, Type: media.Document},
+	}}
+	suite.service = NewProfileService(suite.db, suite.config, userService, mediaService, suite.authService)
+
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("Correct-Horse-42"), bcrypt.DefaultCost)
+	suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com", Password: string(hashedPassword)})
+	// Admins can see every media, which must not let them use it as avatar
+	suite.actor = rbac.Actor{ID: 1, Role: user.Admin}
+}
+
+func (suite *ProfileServiceTestSuite) TestUpdateProfile_Avatar() {
+	for _, avatarID := range []uint{2, 3, 99} {
+		_, err := suite.service.UpdateProfile(suite.actor, &dto.UserProfileUpdateInput{AvatarID: &avatarID})
+		suite.ErrorIs(err, ErrInvalidAvatar)
+	}
+
+	avatarID := uint(1)
+	profile, err := suite.service.UpdateProfile(suite.actor, &dto.UserProfileUpdateInput{AvatarID: &avatarID})
+	suite.NoError(err)
+	suite.Equal(&avatarID, profile.AvatarID)
+}
+
+func (suite *ProfileServiceTestSuite) TestUpdateProfile_SocialLinks() {
+	// The links are served to visitors of the public profile, scripts must not get through as links
+	for _, link := range []string{"javascript:alert(document.cookie)", "data:text/html,<script>alert(1)</script>", "ftp://files.doe.com"} {
+		input := dto.UserProfileUpdateInput{Meta: &dto.UserMeta{SocialLinks: dto.UserSocialLinks{Website: link}}}
+		suite.Error(binding.Validator.ValidateStruct(&input), link)
+	}
+	input := dto.UserProfileUpdateInput{Meta: &dto.UserMeta{SocialLinks: dto.UserSocialLinks{Website: "https://john.doe.com", Github: "http://github.com/john"}}}
+	suite.NoError(binding.Validator.ValidateStruct(&input))
+}
+
+func (suite *ProfileServiceTestSuite) TestChangeEmail_SendsVerification() {
+	_, err := suite.service.ChangeEmail(suite.actor, &dto.UserEmailChangeInput{Email: "john@doe.com", CurrentPassword: "Correct-Horse-42"})
+	suite.NoError(err)
+	suite.Empty(suite.authService.verificationsSent)
+
+	profile, err := suite.service.ChangeEmail(suite.actor, &dto.UserEmailChangeInput{Email: "john@smith.com", CurrentPassword: "Correct-Horse-42"})
+	suite.NoError(err)
+	suite.Equal("john@smith.com", profile.Email)
+	suite.Equal([]uint{1}, suite.authService.verificationsSent)
+	// Password guesses go through the signin lockout
+	suite.Equal([]uint{1, 1}, suite.authService.passwordsConfirmed)
+}
+
+func (suite *ProfileServiceTestSuite) TestChangeEmail_SignupDomain() {
+	suite.config.Auth.SignupMode = auth.SignupDomain
+	suite.config.Auth.SignupAllowedDomains = []string{"doe.com"}
+
+	// Signing up with an address of the organization must not let users move to another one
+	_, err := suite.service.ChangeEmail(suite.actor, &dto.UserEmailChangeInput{Email: "john@smith.com", CurrentPassword: "Correct-Horse-42"})
+	suite.ErrorIs(err, auth.ErrEmailNotAllowed)
+	profile, _ := suite.service.FindProfile(suite.actor)
+	suite.Equal("john@doe.com", profile.Email)
+
+	profile, err = suite.service.ChangeEmail(suite.actor, &dto.UserEmailChangeInput{Email: "johnny@DOE.com", CurrentPassword: "Correct-Horse-42"})
+	suite.NoError(err)
+	suite.Equal("johnny@DOE.com", profile.Email)
+}
+
+func (suite *ProfileServiceTestSuite) TestDeleteAccount() {
+	suite.db.Create(&order.Order{UserID: 1, Amount: 10, Status: order.Paid})
+	suite.db.Create(&course.CourseUser{UserID: 1, CourseID: 1})
+	suite.db.Create(&auth.PasskeyCredential{UserID: 1, CredentialID: "credential"})
+	suite.db.Create(&oidc.ExternalIdentity{UserID: 1, Provider: "google", Subject: "123", Email: "john@doe.com"})
+	suite.db.Create(&follow.Follow{FollowerID: 1, InstructorID: 2})
+	suite.Require().NoError(suite.db.Create(&instructor.Application{UserID: 1, PayoutMethod: "bank", PayoutDetails: datatypes.JSONMap{"account": "123"}}).Error)
+
+	err := suite.service.DeleteAccount(suite.actor, &dto.UserAccountDeleteInput{CurrentPassword: "wrong"})
+	suite.ErrorIs(err, user.ErrIncorrectPassword)
+	suite.Empty(suite.authService.signedOut)
+
+	suite.NoError(suite.service.DeleteAccount(suite.actor, &dto.UserAccountDeleteInput{CurrentPassword: "Correct-Horse-42"}))
+	suite.Equal([]uint{1}, suite.authService.signedOut)
+	suite.Equal([]uint{1, 1}, suite.authService.passwordsConfirmed)
+	_, err = suite.service.FindProfile(suite.actor)
+	suite.ErrorIs(err, gorm.ErrRecordNotFound)
+
+	var deleted user.User
+	suite.db.Unscoped().First(&deleted, 1)
+	suite.True(deleted.DeletedAt.Valid)
+	suite.Equal("deleted-1", deleted.Username)
+	suite.NotContains(deleted.Email, "john")
+	suite.Empty(deleted.Password)
+
+	// Financial records and enrollments stay, credentials and payout details are gone
+	var orders, enrollments, passkeys, identities, follows, applications int64
+	suite.db.Model(&order.Order{}).Where("user_id = ?", 1).Count(&orders)
+	suite.db.Model(&course.CourseUser{}).Where("user_id = ?", 1).Count(&enrollments)
+	suite.db.Model(&auth.PasskeyCredential{}).Count(&passkeys)
+	suite.db.Model(&oidc.ExternalIdentity{}).Count(&identities)
+	suite.db.Model(&follow.Follow{}).Count(&follows)
+	suite.db.Model(&instructor.Application{}).Count(&applications)
+	suite.Equal([]int64{1, 1, 0, 0, 0, 0}, []int64{orders, enrollments, passkeys, identities, follows, applications})
+
+	// The email address can be used for a new account
+	suite.NoError(suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com"}).Error)
+}
+
+func (suite *ProfileServiceTestSuite) TestExportData() {
+	suite.db.Create(&user.User{Username: "jane_doe", Email: "jane@doe.com"})
+	suite.db.Create(&order.Order{UserID: 1, Amount: 10, Items: []order.OrderItem{{CourseID: 1, Quantity: 1, Price: 10}}})
+	suite.db.Create(&order.Order{UserID: 2, Amount: 20})
+	suite.db.Create(&course.CourseUser{UserID: 1, CourseID: 1})
+	suite.db.Create(&apikey.ApiKey{UserID: 1, Name: "lms", Prefix: "gz_1", SecretHash: "secret-hash"})
+	suite.db.Create(&instructor.Application{UserID: 1, Headline: "Go teacher", PayoutDetails: datatypes.JSONMap{}})
+	suite.db.Create(&instructor.Application{UserID: 2, Headline: "Rust teacher", PayoutDetails: datatypes.JSONMap{}})
+
+	export, err := suite.service.ExportData(suite.actor)
+	suite.Require().NoError(err)
+	suite.Len(export.Orders, 1)
+	suite.Len(export.Orders[0].Items, 1)
+	suite.Len(export.Enrollments, 1)
+
+	var buf bytes.Buffer
+	suite.Require().NoError(export.WriteZip(&buf))
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	suite.Require().NoError(err)
+	contents := map[string]string{}
+	for _, file := range archive.File {
+		reader, _ := file.Open()
+		content, _ := io.ReadAll(reader)
+		contents[file.Name] = string(content)
+	}
+	suite.Contains(contents["profile.json"], `"email": "john@doe.com"`)
+	suite.NotContains(contents["profile.json"], "$2a$")
+	suite.Contains(contents["api-keys.json"], `"name": "lms"`)
+	suite.NotContains(contents["api-keys.json"], "secret-hash")
+	suite.Contains(contents, "orders.json")
+	suite.Contains(contents["instructor-applications.json"], `"headline": "Go teacher"`)
+	suite.NotContains(contents["instructor-applications.json"], "Rust teacher")
+}
+
+func (suite *ProfileServiceTestSuite) TestFindPublicProfile() {
+	published := time.Now()
+	avatarID := uint(1)
+	suite.db.Create(&user.User{Username: "jane_doe", Email: "jane@doe.com", Bio: "Gopher", AvatarID: &avatarID, Role: user.Instructor,
+		Meta: datatypes.JSON(`{"headline":"Go developer","socialLinks":{"github":"https://github.com/jane"}}`)})
+	suite.db.Create(&media.Media{UserID: 2, Type: media.Image, Data: datatypes.JSON(`{}`)})
+	suite.db.Create(&course.Course{Name: "Go", UserID: 2, PublishedAt: &published})
+	suite.db.Create(&course.Course{Name: "Rust", UserID: 2, PublishedAt: &published})
+	suite.db.Create(&course.Course{Name: "Draft", UserID: 2})
+	suite.db.Create(&course.CourseUser{UserID: 1, CourseID: 1})
+	suite.db.Create(&course.CourseUser{UserID: 1, CourseID: 2})
+	suite.db.Create(&course.CourseUser{UserID: 1, CourseID: 3})
+	suite.db.Create(&follow.Follow{FollowerID: 1, InstructorID: 2})
+
+	profile, err := suite.service.FindPublicProfile(0, 2)
+	suite.Require().NoError(err)
+	suite.Equal("Go developer", profile.Headline)
+	suite.Equal("https://github.com/jane", profile.SocialLinks.Github)
+	suite.NotNil(profile.Avatar)
+	suite.Len(profile.Courses, 2)
+	suite.Equal(int64(1), profile.Courses[0].Students)
+	// Drafts aren't counted, and the learner enrolled in both courses counts once
+	suite.Equal(PublicProfileStats{Courses: 2, Students: 1, Followers: 1}, profile.Stats)
+	suite.False(profile.Following)
+
+	profile, _ = suite.service.FindPublicProfile(1, 2)
+	suite.True(profile.Following)
+
+	suite.db.Model(&user.User{}).Where("id = ?", 2).Update("suspended_at", time.Now())
+	_, err = suite.service.FindPublicProfile(0, 2)
+	suite.ErrorIs(err, gorm.ErrRecordNotFound)
+}
+
+func TestProfileServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(ProfileServiceTestSuite))
+}
@@ -0,0 +1,6 @@
+package dto
+
+type RoleCreateInput struct {
+	Name        string   `json:"name" binding:"required,min=2,max=64"`
+	Permissions []string `json:"permissions"`
+}
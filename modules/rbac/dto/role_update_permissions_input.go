@@ -0,0 +1,5 @@
+package dto
+
+type RoleUpdatePermissionsInput struct {
+	Permissions []string `json:"permissions" binding:"required"`
+}
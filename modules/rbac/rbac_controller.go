@@ -0,0 +1,95 @@
+package rbac
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/irvanherz/gourze/modules/rbac/dto"
+	"gorm.io/gorm"
+)
+
+type RbacController interface {
+	FindManyRoles(*gin.Context)
+	FindManyPermissions(*gin.Context)
+	CreateRole(*gin.Context)
+	UpdateRolePermissions(*gin.Context)
+	DeleteRole(*gin.Context)
+}
+
+type rbacController struct {
+	Service RbacService
+}
+
+func NewRbacController(service RbacService) RbacController {
+	return &rbacController{service}
+}
+
+func (rc *rbacController) FindManyRoles(c *gin.Context) {
+	roles, err := rc.Service.FindManyRoles()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Success", "data": roles})
+}
+
+func (rc *rbacController) FindManyPermissions(c *gin.Context) {
+	permissions, err := rc.Service.FindManyPermissions()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Success", "data": permissions})
+}
+
+func (rc *rbacController) CreateRole(c *gin.Context) {
+	var input dto.RoleCreateInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
+		return
+	}
+	role, err := rc.Service.CreateRole(&input)
+	if err != nil {
+		respondRbacError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"code": "ok", "message": "Role created successfully", "data": role})
+}
+
+func (rc *rbacController) UpdateRolePermissions(c *gin.Context) {
+	var input dto.RoleUpdatePermissionsInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
+		return
+	}
+	role, err := rc.Service.UpdateRolePermissions(c.Param("name"), &input)
+	if err != nil {
+		respondRbacError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Role updated successfully", "data": role})
+}
+
+func (rc *rbacController) DeleteRole(c *gin.Context) {
+	if err := rc.Service.DeleteRole(c.Param("name")); err != nil {
+		respondRbacError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Role deleted successfully"})
+}
+
+func respondRbacError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"code": "not-found", "message": "Role not found"})
+	case errors.Is(err, ErrUnknownPermission), errors.Is(err, ErrImmutableRole), errors.Is(err, ErrInvalidRoleName), errors.Is(err, ErrBuiltinRole):
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
+	case errors.Is(err, ErrRoleExists):
+		c.JSON(http.StatusConflict, gin.H{"code": "role-exists", "message": err.Error()})
+	case errors.Is(err, ErrRoleInUse):
+		c.JSON(http.StatusConflict, gin.H{"code": "role-in-use", "message": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+	}
+}
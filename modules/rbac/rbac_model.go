@@ -0,0 +1,22 @@
+package rbac
+
+import (
+	"time"
+)
+
+type Permission struct {
+	ID          uint      `gorm:"primarykey" json:"id"`
+	Name        string    `gorm:"unique;type:varchar(64)" json:"name"`
+	Description string    `gorm:"type:varchar(255)" json:"description"`
+	CreatedAt   time.Time `gorm:"type:timestamp" json:"createdAt"`
+	UpdatedAt   time.Time `gorm:"type:timestamp" json:"updatedAt"`
+}
+
+// Role is the permission set of a user.UserRole, matched by name
+type Role struct {
+	ID          uint         `gorm:"primarykey" json:"id"`
+	Name        string       `gorm:"unique;type:varchar(64)" json:"name"`
+	Permissions []Permission `gorm:"many2many:role_permissions" json:"permissions"`
+	CreatedAt   time.Time    `gorm:"type:timestamp" json:"createdAt"`
+	UpdatedAt   time.Time    `gorm:"type:timestamp" json:"updatedAt"`
+}
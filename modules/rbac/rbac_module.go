@@ -0,0 +1,11 @@
+package rbac
+
+import "go.uber.org/fx"
+
+// Module exports dependencies for the rbac module
+var Module = fx.Module("rbac",
+	fx.Provide(NewRbacService),
+	fx.Provide(NewPermissionChecker),
+	fx.Provide(NewPolicy),
+	fx.Provide(NewRbacController),
+)
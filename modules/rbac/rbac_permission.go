@@ -0,0 +1,46 @@
+package rbac
+
+import "github.com/irvanherz/gourze/modules/user"
+
+// Permissions checked by the application. Roles are granted a subset of them, see SeedRoles.
+const (
+	CourseCreate   = "course:create"
+	CourseManage   = "course:manage"
+	CoursePublish  = "course:publish"
+	CategoryManage = "category:manage"
+	OrderManage    = "order:manage"
+	OrderRefund    = "order:refund"
+	MediaManage    = "media:manage"
+	UserRead       = "user:read"
+	UserManage     = "user:manage"
+	RbacManage     = "rbac:manage"
+	// InstructorReview approves and rejects instructor applications
+	InstructorReview = "instructor:review"
+)
+
+// permissionDescriptions documents every permission, it is the source of the permissions table
+var permissionDescriptions = map[string]string{
+	CourseCreate:     "Create own courses",
+	CourseManage:     "Edit and delete courses of any user",
+	CoursePublish:    "Publish courses of any user",
+	CategoryManage:   "Create, edit and delete course categories",
+	OrderManage:      "View, edit and delete orders of any user",
+	OrderRefund:      "Refund orders",
+	MediaManage:      "Manage media of any user",
+	UserRead:         "View user accounts",
+	UserManage:       "Create, edit, sign out and unlock user accounts",
+	RbacManage:       "Manage roles and their permissions",
+	InstructorReview: "Review instructor applications",
+}
+
+// defaultRolePermissions are granted when a role is seeded for the first time. Super users
+// implicitly hold every permission and have no entry here.
+var defaultRolePermissions = map[user.UserRole][]string{
+	user.Admin: {
+		CourseCreate, CourseManage, CoursePublish, CategoryManage,
+		OrderManage, OrderRefund, MediaManage, UserRead, UserManage, InstructorReview,
+	},
+	// Generic users apply to become instructors before they can create courses
+	user.Instructor: {CourseCreate},
+	user.Generic:    {},
+}
@@ -0,0 +1,59 @@
+package rbac
+
+import (
+	"errors"
+	"slices"
+
+	"github.com/irvanherz/gourze/modules/user"
+	"gorm.io/gorm"
+)
+
+var ErrForbidden = errors.New("you don't have permission to access this resource")
+
+// Actor is the user a service call is made for. It is declared by the user module, whose
+// services can't depend on rbac.
+type Actor = user.Actor
+
+// Policy decides what an actor may do with resources that belong to users. Owners always have
+// access, everyone else needs the override permission of the resource, e.g. order:manage.
+type Policy interface {
+	// Authorize returns ErrForbidden unless the actor is one of the owners or holds the override permission
+	Authorize(actor Actor, override string, ownerIDs ...uint) error
+	// Scope restricts query to the rows the actor owns, unless the actor holds the override permission
+	Scope(query *gorm.DB, actor Actor, override string, ownerColumn string) (*gorm.DB, error)
+}
+
+type policy struct {
+	PermissionChecker PermissionChecker
+}
+
+func NewPolicy(permissionChecker PermissionChecker) Policy {
+	return &policy{PermissionChecker: permissionChecker}
+}
+
+// Authorize implements Policy.
+func (p *policy) Authorize(actor Actor, override string, ownerIDs ...uint) error {
+	if actor.ID != 0 && slices.Contains(ownerIDs, actor.ID) {
+		return nil
+	}
+	allowed, err := p.PermissionChecker.HasPermission(actor.Role, override)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// Scope implements Policy.
+func (p *policy) Scope(query *gorm.DB, actor Actor, override string, ownerColumn string) (*gorm.DB, error) {
+	allowed, err := p.PermissionChecker.HasPermission(actor.Role, override)
+	if err != nil {
+		return nil, err
+	}
+	if allowed {
+		return query, nil
+	}
+	return query.Where(ownerColumn+" = ?", actor.ID), nil
+}
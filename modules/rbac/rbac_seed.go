@@ -0,0 +1,84 @@
+package rbac
+
+import (
+	"errors"
+
+	"github.com/irvanherz/gourze/modules/user"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SeedRoles creates missing permissions, and roles with their default permissions. Roles that
+// already exist are left alone so changes made through the API survive restarts, except for the
+// one-time upgrade of upgradeToInstructors.
+func SeedRoles(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for name, description := range permissionDescriptions {
+			permission := Permission{Name: name, Description: description}
+			if err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "name"}},
+				DoUpdates: clause.AssignmentColumns([]string{"description", "updated_at"}),
+			}).Create(&permission).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, roleName := range user.BuiltinRoles {
+			err := tx.Where("name = ?", roleName).First(&Role{}).Error
+			if err == nil {
+				continue
+			}
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+			if roleName == user.Instructor {
+				if err := upgradeToInstructors(tx); err != nil {
+					return err
+				}
+			}
+			var permissions []Permission
+			if names := defaultRolePermissions[roleName]; len(names) > 0 {
+				if err := tx.Where("name IN ?", names).Find(&permissions).Error; err != nil {
+					return err
+				}
+			}
+			if err := tx.Create(&Role{Name: string(roleName), Permissions: permissions}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// upgradeToInstructors updates databases seeded before the instructor role existed, where generic
+// users could create courses and admins couldn't review instructor applications. It runs when the
+// instructor role is created, so it neither repeats nor undoes later changes made through the API.
+func upgradeToInstructors(tx *gorm.DB) error {
+	var courseCreate, instructorReview Permission
+	if err := tx.Where("name = ?", CourseCreate).First(&courseCreate).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("name = ?", InstructorReview).First(&instructorReview).Error; err != nil {
+		return err
+	}
+
+	var generic Role
+	err := tx.Where("name = ?", user.Generic).First(&generic).Error
+	if err == nil {
+		if err := tx.Model(&generic).Association("Permissions").Delete(&courseCreate); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	var admin Role
+	err = tx.Where("name = ?", user.Admin).First(&admin).Error
+	if err == nil {
+		return tx.Model(&admin).Association("Permissions").Append(&instructorReview)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	return nil
+}
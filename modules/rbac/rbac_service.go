@@ -0,0 +1,231 @@
+package rbac
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/irvanherz/gourze/modules/rbac/dto"
+	"github.com/irvanherz/gourze/modules/user"
+	"gorm.io/gorm"
+)
+
+// permissionCacheTTL bounds how long other instances keep using a permission set after it changed
+const permissionCacheTTL = time.Minute
+
+var (
+	ErrUnknownPermission = errors.New("unknown permission")
+	ErrImmutableRole     = errors.New("the super role always holds every permission")
+	ErrInvalidRoleName   = errors.New("role names may only contain lowercase letters, digits, dashes and underscores")
+	ErrRoleExists        = errors.New("role already exists")
+	ErrBuiltinRole       = errors.New("built-in roles can't be deleted")
+	ErrRoleInUse         = errors.New("role is still held by users")
+)
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+// PermissionChecker answers whether a role holds permissions. It is what middlewares and
+// services depend on, so the rules live in the roles table only.
+type PermissionChecker interface {
+	// HasPermission reports whether the role holds all of the given permissions
+	HasPermission(role user.UserRole, permissions ...string) (bool, error)
+}
+
+type RbacService interface {
+	PermissionChecker
+	FindManyRoles() ([]Role, error)
+	FindManyPermissions() ([]Permission, error)
+	CreateRole(input *dto.RoleCreateInput) (*Role, error)
+	UpdateRolePermissions(roleName string, input *dto.RoleUpdatePermissionsInput) (*Role, error)
+	DeleteRole(roleName string) error
+}
+
+type rbacService struct {
+	Db *gorm.DB
+
+	mu    sync.Mutex
+	cache map[user.UserRole]cachedPermissions
+}
+
+type cachedPermissions struct {
+	names    map[string]bool
+	loadedAt time.Time
+}
+
+func NewRbacService(db *gorm.DB) RbacService {
+	return &rbacService{Db: db, cache: map[user.UserRole]cachedPermissions{}}
+}
+
+func NewPermissionChecker(service RbacService) PermissionChecker {
+	return service
+}
+
+// HasPermission implements PermissionChecker.
+func (s *rbacService) HasPermission(role user.UserRole, permissions ...string) (bool, error) {
+	if role == user.Super {
+		return true, nil
+	}
+	granted, err := s.rolePermissions(role)
+	if err != nil {
+		return false, err
+	}
+	for _, permission := range permissions {
+		if !granted[permission] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (s *rbacService) FindManyRoles() ([]Role, error) {
+	var roles []Role
+	if err := s.Db.Preload("Permissions").Order("id asc").Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+func (s *rbacService) FindManyPermissions() ([]Permission, error) {
+	var permissions []Permission
+	if err := s.Db.Order("name asc").Find(&permissions).Error; err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
+// CreateRole implements RbacService. New roles can be granted to users like the built-in ones.
+func (s *rbacService) CreateRole(input *dto.RoleCreateInput) (*Role, error) {
+	if !roleNamePattern.MatchString(input.Name) {
+		return nil, ErrInvalidRoleName
+	}
+	var count int64
+	if err := s.Db.Model(&Role{}).Where("name = ?", input.Name).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrRoleExists
+	}
+	permissions, err := s.findPermissions(input.Permissions)
+	if err != nil {
+		return nil, err
+	}
+	role := Role{Name: input.Name, Permissions: permissions}
+	if err := s.Db.Create(&role).Error; err != nil {
+		return nil, err
+	}
+	s.forget(user.UserRole(role.Name))
+	return &role, nil
+}
+
+// UpdateRolePermissions implements RbacService. It replaces the whole permission set of a role.
+func (s *rbacService) UpdateRolePermissions(roleName string, input *dto.RoleUpdatePermissionsInput) (*Role, error) {
+	if roleName == string(user.Super) {
+		return nil, ErrImmutableRole
+	}
+	var role Role
+	if err := s.Db.Where("name = ?", roleName).First(&role).Error; err != nil {
+		return nil, err
+	}
+	permissions, err := s.findPermissions(input.Permissions)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Db.Model(&role).Association("Permissions").Replace(permissions); err != nil {
+		return nil, err
+	}
+	s.forget(user.UserRole(roleName))
+
+	if err := s.Db.Preload("Permissions").First(&role, role.ID).Error; err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// DeleteRole implements RbacService. Only roles created through the API, and held by nobody, can be deleted.
+func (s *rbacService) DeleteRole(roleName string) error {
+	for _, builtin := range user.BuiltinRoles {
+		if roleName == string(builtin) {
+			return ErrBuiltinRole
+		}
+	}
+	var role Role
+	if err := s.Db.Where("name = ?", roleName).First(&role).Error; err != nil {
+		return err
+	}
+	var holders int64
+	if err := s.Db.Model(&user.User{}).Where("role = ?", roleName).Count(&holders).Error; err != nil {
+		return err
+	}
+	if holders > 0 {
+		return ErrRoleInUse
+	}
+	err := s.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&role).Association("Permissions").Clear(); err != nil {
+			return err
+		}
+		return tx.Delete(&role).Error
+	})
+	if err != nil {
+		return err
+	}
+	s.forget(user.UserRole(roleName))
+	return nil
+}
+
+// findPermissions loads the named permissions, failing on unknown names
+func (s *rbacService) findPermissions(names []string) ([]Permission, error) {
+	var permissions []Permission
+	if len(names) > 0 {
+		if err := s.Db.Where("name IN ?", names).Find(&permissions).Error; err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range names {
+		if !containsPermission(permissions, name) {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownPermission, name)
+		}
+	}
+	return permissions, nil
+}
+
+// forget drops the cached permission set of a role, other instances catch up within permissionCacheTTL
+func (s *rbacService) forget(role user.UserRole) {
+	s.mu.Lock()
+	delete(s.cache, role)
+	s.mu.Unlock()
+}
+
+func (s *rbacService) rolePermissions(role user.UserRole) (map[string]bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cached, ok := s.cache[role]; ok && time.Since(cached.loadedAt) < permissionCacheTTL {
+		return cached.names, nil
+	}
+
+	var names []string
+	err := s.Db.Model(&Permission{}).
+		Joins("JOIN role_permissions ON role_permissions.permission_id = permissions.id").
+		Joins("JOIN roles ON roles.id = role_permissions.role_id").
+		Where("roles.name = ?", role).
+		Pluck("permissions.name", &names).Error
+	if err != nil {
+		return nil, err
+	}
+	granted := make(map[string]bool, len(names))
+	for _, name := range names {
+		granted[name] = true
+	}
+	s.cache[role] = cachedPermissions{names: granted, loadedAt: time.Now()}
+	return granted, nil
+}
+
+func containsPermission(permissions []Permission, name string) bool {
+	for _, permission := range permissions {
+		if permission.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+package rbac
+
+import (
+	"testing"
+
+	"github.com/irvanherz/gourze/modules/rbac/dto"
+	"github.com/irvanherz/gourze/modules/user"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type RbacServiceTestSuite struct {
+	suite.Suite
+	db      *gorm.DB
+	service RbacService
+}
+
+func (suite *RbacServiceTestSuite) SetupTest() {
+	suite.db, _ = gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	suite.db.AutoMigrate(&Permission{}, &Role{})
+	suite.Require().NoError(SeedRoles(suite.db))
+	suite.service = NewRbacService(suite.db)
+}
+
+func (suite *RbacServiceTestSuite) TestSeedRoles_Defaults() {
+	allowed, err := suite.service.HasPermission(user.Admin, CourseManage, OrderRefund)
+	suite.NoError(err)
+	suite.True(allowed)
+
+	allowed, _ = suite.service.HasPermission(user.Admin, RbacManage)
+	suite.False(allowed)
+	allowed, _ = suite.service.HasPermission(user.Generic, CourseCreate)
+	suite.False(allowed)
+	allowed, _ = suite.service.HasPermission(user.Instructor, CourseCreate)
+	suite.True(allowed)
+	allowed, _ = suite.service.HasPermission(user.Instructor, CourseCreate, CoursePublish)
+	suite.False(allowed)
+
+	// Seeding again keeps the roles as they are
+	suite.NoError(SeedRoles(suite.db))
+	roles, _ := suite.service.FindManyRoles()
+	suite.Len(roles, 4)
+}
+
+func (suite *RbacServiceTestSuite) TestSeedRoles_UpgradeToInstructors() {
+	// The roles as seeded before instructor applications were added
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(&Permission{}, &Role{})
+	permissions := map[string]*Permission{}
+	for _, name := range []string{CourseCreate, CourseManage, UserManage} {
+		permissions[name] = &Permission{Name: name}
+		db.Create(permissions[name])
+	}
+	db.Create(&Role{Name: string(user.Super)})
+	db.Create(&Role{Name: string(user.Admin), Permissions: []Permission{*permissions[CourseCreate], *permissions[CourseManage], *permissions[UserManage]}})
+	db.Create(&Role{Name: string(user.Generic), Permissions: []Permission{*permissions[CourseCreate]}})
+
+	suite.Require().NoError(SeedRoles(db))
+	service := NewRbacService(db)
+	allowed, _ := service.HasPermission(user.Generic, CourseCreate)
+	suite.False(allowed)
+	allowed, _ = service.HasPermission(user.Instructor, CourseCreate)
+	suite.True(allowed)
+	allowed, _ = service.HasPermission(user.Admin, CourseCreate, CourseManage, UserManage, InstructorReview)
+	suite.True(allowed)
+
+	// The upgrade runs once, permissions granted again through the API are kept
+	_, err := service.UpdateRolePermissions(string(user.Generic), &dto.RoleUpdatePermissionsInput{Permissions: []string{CourseCreate}})
+	suite.NoError(err)
+	suite.NoError(SeedRoles(db))
+	allowed, _ = NewRbacService(db).HasPermission(user.Generic, CourseCreate)
+	suite.True(allowed)
+}
+
+func (suite *RbacServiceTestSuite) TestHasPermission_SuperBypass() {
+	allowed, err := suite.service.HasPermission(user.Super, RbacManage, "anything:else")
+	suite.NoError(err)
+	suite.True(allowed)
+}
+
+func (suite *RbacServiceTestSuite) TestUpdateRolePermissions() {
+	// Load the cache first so the update has to invalidate it
+	allowed, _ := suite.service.HasPermission(user.Generic, CoursePublish)
+	suite.False(allowed)
+
+	role, err := suite.service.UpdateRolePermissions(string(user.Generic), &dto.RoleUpdatePermissionsInput{Permissions: []string{CoursePublish}})
+	suite.NoError(err)
+	suite.Len(role.Permissions, 1)
+
+	allowed, _ = suite.service.HasPermission(user.Generic, CoursePublish)
+	suite.True(allowed)
+	allowed, _ = suite.service.HasPermission(user.Generic, CourseCreate)
+	suite.False(allowed)
+}
+
+func (suite *RbacServiceTestSuite) TestUpdateRolePermissions_Validation() {
+	_, err := suite.service.UpdateRolePermissions(string(user.Generic), &dto.RoleUpdatePermissionsInput{Permissions: []string{"course:fly"}})
+	suite.ErrorIs(err, ErrUnknownPermission)
+
+	_, err = suite.service.UpdateRolePermissions(string(user.Super), &dto.RoleUpdatePermissionsInput{})
+	suite.ErrorIs(err, ErrImmutableRole)
+
+	_, err = suite.service.UpdateRolePermissions("unknown", &dto.RoleUpdatePermissionsInput{})
+	suite.ErrorIs(err, gorm.ErrRecordNotFound)
+}
+
+func (suite *RbacServiceTestSuite) TestCreateRole() {
+	role, err := suite.service.CreateRole(&dto.RoleCreateInput{Name: "moderator", Permissions: []string{UserRead, MediaManage}})
+	suite.NoError(err)
+	suite.Len(role.Permissions, 2)
+	allowed, _ := suite.service.HasPermission("moderator", UserRead, MediaManage)
+	suite.True(allowed)
+
+	_, err = suite.service.CreateRole(&dto.RoleCreateInput{Name: "moderator"})
+	suite.ErrorIs(err, ErrRoleExists)
+	_, err = suite.service.CreateRole(&dto.RoleCreateInput{Name: "Support Team"})
+	suite.ErrorIs(err, ErrInvalidRoleName)
+	_, err = suite.service.CreateRole(&dto.RoleCreateInput{Name: "support", Permissions: []string{"course:fly"}})
+	suite.ErrorIs(err, ErrUnknownPermission)
+}
+
+func (suite *RbacServiceTestSuite) TestDeleteRole() {
+	suite.db.AutoMigrate(&user.User{})
+	suite.service.CreateRole(&dto.RoleCreateInput{Name: "moderator", Permissions: []string{UserRead}})
+	suite.db.Create(&user.User{Username: "john_doe", Email: "john@doe.com", Role: "moderator"})
+
+	suite.ErrorIs(suite.service.DeleteRole(string(user.Generic)), ErrBuiltinRole)
+	suite.ErrorIs(suite.service.DeleteRole("moderator"), ErrRoleInUse)
+	suite.ErrorIs(suite.service.DeleteRole("unknown"), gorm.ErrRecordNotFound)
+
+	suite.db.Model(&user.User{}).Where("id = ?", 1).Update("role", user.Generic)
+	suite.NoError(suite.service.DeleteRole("moderator"))
+	allowed, _ := suite.service.HasPermission("moderator", UserRead)
+	suite.False(allowed)
+}
+
+func TestRbacServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(RbacServiceTestSuite))
+}
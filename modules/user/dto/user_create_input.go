@@ -1,7 +1,11 @@
-package dto
-
-type UserCreateInput struct {
-	Username string `json:"username"`
-	Email    string `json:"email"`
-	FullName string `json:"fullName"`
-}
+package dto
+
+type UserCreateInput struct {
+	Username string `json:"username" binding:"required,min=3,max=255"`
+	Email    string `json:"email" binding:"required,email"`
+	FullName string `json:"fullName" binding:"max=255"`
+	// Password is optional, users created without one sign in with a magic link or a password reset
+	Password string `json:"password"`
+	// Role defaults to generic
+	Role string `json:"role"`
+}
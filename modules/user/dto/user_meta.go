@@ -0,0 +1,16 @@
+package dto
+
+// UserMeta is the schema of the meta column of users, shown on their public profile
+type UserMeta struct {
+	Headline    string          `json:"headline" binding:"max=120"`
+	SocialLinks UserSocialLinks `json:"socialLinks"`
+}
+
+// UserSocialLinks are rendered as links by frontends, so only http and https URLs are accepted
+type UserSocialLinks struct {
+	Website  string `json:"website,omitempty" binding:"omitempty,http_url,max=255"`
+	Github   string `json:"github,omitempty" binding:"omitempty,http_url,max=255"`
+	Linkedin string `json:"linkedin,omitempty" binding:"omitempty,http_url,max=255"`
+	X        string `json:"x,omitempty" binding:"omitempty,http_url,max=255"`
+	Youtube  string `json:"youtube,omitempty" binding:"omitempty,http_url,max=255"`
+}
@@ -0,0 +1,23 @@
+package dto
+
+// UserProfileUpdateInput only changes the fields that are set
+type UserProfileUpdateInput struct {
+	FullName *string `json:"fullName" binding:"omitempty,min=1,max=255"`
+	Username *string `json:"username" binding:"omitempty,min=3,max=255"`
+	Bio      *string `json:"bio" binding:"omitempty,max=2000"`
+	// AvatarID 0 removes the avatar
+	AvatarID *uint   `json:"avatarId"`
+	Locale   *string `json:"locale" binding:"omitempty,bcp47_language_tag"`
+	Timezone *string `json:"timezone" binding:"omitempty,timezone"`
+	// Meta replaces the headline and social links as a whole
+	Meta *UserMeta `json:"meta"`
+}
+
+type UserEmailChangeInput struct {
+	Email           string `json:"email" binding:"required,email"`
+	CurrentPassword string `json:"currentPassword" binding:"required"`
+}
+
+type UserAccountDeleteInput struct {
+	CurrentPassword string `json:"currentPassword" binding:"required"`
+}
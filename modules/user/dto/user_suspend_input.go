@@ -0,0 +1,9 @@
+package dto
+
+import "time"
+
+type UserSuspendInput struct {
+	Reason string `json:"reason" binding:"required,max=500"`
+	// Until is when the suspension ends, without it the user is banned until unsuspended
+	Until *time.Time `json:"until"`
+}
@@ -1,5 +1,8 @@
-package dto
-
-type UserUpdateInput struct {
-	FullName string `json:"fullName"`
-}
+package dto
+
+type UserUpdateInput struct {
+	// FullName is left unchanged when omitted
+	FullName *string `json:"fullName" binding:"omitempty,min=1,max=255"`
+	// Role is left unchanged when empty
+	Role string `json:"role"`
+}
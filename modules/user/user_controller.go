@@ -1,118 +1,219 @@
-package user
-
-import (
-	"net/http"
-	"strconv"
-
-	"github.com/gin-gonic/gin"
-	"github.com/irvanherz/gourze/modules/user/dto"
-)
-
-type UserController interface {
-	FindManyUsers(*gin.Context)
-	CreateUser(*gin.Context)
-	FindUserByID(*gin.Context)
-	UpdateUserByID(*gin.Context)
-	DeleteUserByID(*gin.Context)
-}
-
-type userController struct {
-	Service UserService
-}
-
-func NewUserController(service UserService) UserController {
-	return &userController{service}
-}
-
-func (uc *userController) FindManyUsers(c *gin.Context) {
-	var filter dto.UserFilterInput
-	if err := c.ShouldBindQuery(&filter); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
-		return
-	}
-	users, count, err := uc.Service.FindManyUsers(&filter)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
-		return
-	}
-	page := filter.Page
-	take := filter.Take
-	numPages := (count + int64(take) - 1) / int64(take)
-
-	c.JSON(http.StatusOK, gin.H{
-		"code":    "ok",
-		"message": "Success",
-		"data":    users,
-		"meta": gin.H{
-			"numItems": count,
-			"page":     page,
-			"numPages": numPages,
-			"take":     take,
-		},
-	})
-}
-
-func (uc *userController) CreateUser(c *gin.Context) {
-	var userInput dto.UserCreateInput
-	if err := c.ShouldBindJSON(&userInput); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
-		return
-	}
-	user, err := uc.Service.CreateUser(&userInput)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
-		return
-	}
-	c.JSON(http.StatusCreated, gin.H{"code": "ok", "message": "User created successfully", "data": user})
-}
-
-func (uc *userController) FindUserByID(c *gin.Context) {
-	id := c.Param("id")
-	uid, err := strconv.ParseUint(id, 10, 32)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": "Invalid user ID"})
-		return
-	}
-	user, err := uc.Service.FindUserByID(uint(uid))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
-		return
-	}
-	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Success", "data": user})
-}
-
-func (uc *userController) UpdateUserByID(c *gin.Context) {
-	id := c.Param("id")
-	uid, err := strconv.ParseUint(id, 10, 32)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": "Invalid user ID"})
-		return
-	}
-
-	var userInput dto.UserUpdateInput
-	if err := c.ShouldBindJSON(&userInput); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
-		return
-	}
-	user, err := uc.Service.UpdateUserByID(uint(uid), &userInput)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
-		return
-	}
-	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "User updated successfully", "data": user})
-}
-
-func (uc *userController) DeleteUserByID(c *gin.Context) {
-	id := c.Param("id")
-	uid, err := strconv.ParseUint(id, 10, 32)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"code": "ok", "message": "Invalid user ID"})
-		return
-	}
-	user, err := uc.Service.DeleteUserByID(uint(uid))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
-		return
-	}
-	c.JSON(http.StatusNoContent, gin.H{"code": "ok", "message": "User deleted successfully", "data": user})
-}
+package user
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/irvanherz/gourze/modules/password"
+	"github.com/irvanherz/gourze/modules/user/dto"
+	"gorm.io/gorm"
+)
+
+type UserController interface {
+	FindManyUsers(*gin.Context)
+	CreateUser(*gin.Context)
+	FindUserByID(*gin.Context)
+	UpdateUserByID(*gin.Context)
+	DeleteUserByID(*gin.Context)
+	SuspendUser(*gin.Context)
+	UnsuspendUser(*gin.Context)
+}
+
+// actorProvider is implemented by utils.CurrentUser, which the auth middleware stores in the
+// context. The user module can't import utils, which depends on it.
+type actorProvider interface {
+	Actor() Actor
+}
+
+// currentActor returns the signed in user making the request
+func currentActor(c *gin.Context) (Actor, bool) {
+	value, _ := c.Get("user")
+	provider, ok := value.(actorProvider)
+	if !ok {
+		return Actor{}, false
+	}
+	return provider.Actor(), true
+}
+
+type userController struct {
+	Service UserService
+}
+
+func NewUserController(service UserService) UserController {
+	return &userController{service}
+}
+
+func (uc *userController) FindManyUsers(c *gin.Context) {
+	var filter dto.UserFilterInput
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
+		return
+	}
+	users, count, err := uc.Service.FindManyUsers(&filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+		return
+	}
+	page := filter.Page
+	take := filter.Take
+	numPages := (count + int64(take) - 1) / int64(take)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    "ok",
+		"message": "Success",
+		"data":    users,
+		"meta": gin.H{
+			"numItems": count,
+			"page":     page,
+			"numPages": numPages,
+			"take":     take,
+		},
+	})
+}
+
+func (uc *userController) CreateUser(c *gin.Context) {
+	actor, ok := currentActor(c)
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"code": "unauthorized", "message": "Unauthorized"})
+		return
+	}
+	var userInput dto.UserCreateInput
+	if err := c.ShouldBindJSON(&userInput); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
+		return
+	}
+	user, err := uc.Service.CreateUser(actor, &userInput)
+	if err != nil {
+		if errors.Is(err, password.ErrWeakPassword) || errors.Is(err, password.ErrBreachedPassword) {
+			c.JSON(http.StatusBadRequest, gin.H{"code": "weak-password", "message": err.Error()})
+			return
+		}
+		respondUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"code": "ok", "message": "User created successfully", "data": user})
+}
+
+func (uc *userController) FindUserByID(c *gin.Context) {
+	id := c.Param("id")
+	uid, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": "Invalid user ID"})
+		return
+	}
+	user, err := uc.Service.FindUserByID(uint(uid))
+	if err != nil {
+		respondUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "Success", "data": user})
+}
+
+func (uc *userController) UpdateUserByID(c *gin.Context) {
+	actor, ok := currentActor(c)
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"code": "unauthorized", "message": "Unauthorized"})
+		return
+	}
+	id := c.Param("id")
+	uid, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": "Invalid user ID"})
+		return
+	}
+
+	var userInput dto.UserUpdateInput
+	if err := c.ShouldBindJSON(&userInput); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
+		return
+	}
+	user, err := uc.Service.UpdateUserByID(actor, uint(uid), &userInput)
+	if err != nil {
+		respondUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "User updated successfully", "data": user})
+}
+
+func (uc *userController) DeleteUserByID(c *gin.Context) {
+	actor, ok := currentActor(c)
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"code": "unauthorized", "message": "Unauthorized"})
+		return
+	}
+	id := c.Param("id")
+	uid, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": "Invalid user ID"})
+		return
+	}
+	user, err := uc.Service.DeleteUserByID(actor, uint(uid))
+	if err != nil {
+		respondUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusNoContent, gin.H{"code": "ok", "message": "User deleted successfully", "data": user})
+}
+
+// SuspendUser blocks the given user from signing in and using the API, until the given time or indefinitely
+func (uc *userController) SuspendUser(c *gin.Context) {
+	actor, ok := currentActor(c)
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"code": "unauthorized", "message": "Unauthorized"})
+		return
+	}
+	uid, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": "Invalid user ID"})
+		return
+	}
+	var input dto.UserSuspendInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
+		return
+	}
+	user, err := uc.Service.SuspendUser(actor, uint(uid), &input)
+	if err != nil {
+		respondUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "User suspended", "data": user})
+}
+
+func (uc *userController) UnsuspendUser(c *gin.Context) {
+	actor, ok := currentActor(c)
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"code": "unauthorized", "message": "Unauthorized"})
+		return
+	}
+	uid, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": "Invalid user ID"})
+		return
+	}
+	user, err := uc.Service.UnsuspendUser(actor, uint(uid))
+	if err != nil {
+		respondUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": "ok", "message": "User unsuspended", "data": user})
+}
+
+func respondUserError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"code": "not-found", "message": "User not found"})
+	case errors.Is(err, ErrInvalidRole), errors.Is(err, ErrInvalidSuspension), errors.Is(err, ErrInvalidUsername):
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid-params", "message": err.Error()})
+	case errors.Is(err, ErrUsernameTaken):
+		c.JSON(http.StatusConflict, gin.H{"code": "username-taken", "message": err.Error()})
+	case errors.Is(err, ErrEmailTaken):
+		c.JSON(http.StatusConflict, gin.H{"code": "email-taken", "message": err.Error()})
+	case errors.Is(err, ErrRoleHierarchy), errors.Is(err, ErrCannotManageSelf):
+		c.JSON(http.StatusForbidden, gin.H{"code": "forbidden", "message": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "internal-server-error", "message": err.Error()})
+	}
+}
@@ -8,11 +8,20 @@ import (
 	"testing"
 
 	"github.com/gin-gonic/gin"
+	"github.com/irvanherz/gourze/config"
+	"github.com/irvanherz/gourze/modules/password"
 	"github.com/irvanherz/gourze/modules/user/dto"
 	"github.com/stretchr/testify/suite"
 	"gorm.io/gorm"
 )
 
+// testActor stands in for utils.CurrentUser, which the auth middleware stores in the context
+type testActor Actor
+
+func (a testActor) Actor() Actor {
+	return Actor(a)
+}
+
 type UserControllerTestSuite struct {
 	suite.Suite
 	DB         *gorm.DB
@@ -23,17 +32,21 @@ type UserControllerTestSuite struct {
 
 func (suite *UserControllerTestSuite) SetupTest() {
 	suite.DB = setupTestDB()
-	suite.Service = NewUserService(suite.DB)
+	conf := &config.Config{}
+	suite.Service = NewUserService(suite.DB, password.NewPasswordPolicy(conf, password.NewBreachedPasswordChecker(conf)), &fakeSessionRevoker{})
 	suite.Controller = NewUserController(suite.Service)
 	suite.Router = gin.Default()
+	suite.Router.Use(func(c *gin.Context) { c.Set("user", testActor{ID: 99, Role: Super}) })
 	suite.Router.PUT("/users/:id", suite.Controller.UpdateUserByID)
+	suite.Router.POST("/users/:id/suspend", suite.Controller.SuspendUser)
 
 	// Seed data
 	suite.DB.Create(&User{FullName: "John Doe"})
 }
 
 func (suite *UserControllerTestSuite) TestUpdateUserByID_Success() {
-	userInput := dto.UserUpdateInput{FullName: "John Smith"}
+	fullName := "John Smith"
+	userInput := dto.UserUpdateInput{FullName: &fullName}
 	jsonValue, _ := json.Marshal(userInput)
 	req, _ := http.NewRequest(http.MethodPut, "/users/1", bytes.NewBuffer(jsonValue))
 	req.Header.Set("Content-Type", "application/json")
@@ -49,7 +62,8 @@ func (suite *UserControllerTestSuite) TestUpdateUserByID_Success() {
 }
 
 func (suite *UserControllerTestSuite) TestUpdateUserByID_InvalidUserID() {
-	userInput := dto.UserUpdateInput{FullName: "John Smith"}
+	fullName := "John Smith"
+	userInput := dto.UserUpdateInput{FullName: &fullName}
 	jsonValue, _ := json.Marshal(userInput)
 	req, _ := http.NewRequest(http.MethodPut, "/users/abc", bytes.NewBuffer(jsonValue))
 	req.Header.Set("Content-Type", "application/json")
@@ -78,17 +92,55 @@ func (suite *UserControllerTestSuite) TestUpdateUserByID_InvalidInputData() {
 }
 
 func (suite *UserControllerTestSuite) TestUpdateUserByID_UserNotFound() {
-	userInput := dto.UserUpdateInput{FullName: "John Smith"}
+	fullName := "John Smith"
+	userInput := dto.UserUpdateInput{FullName: &fullName}
 	jsonValue, _ := json.Marshal(userInput)
 	req, _ := http.NewRequest(http.MethodPut, "/users/999", bytes.NewBuffer(jsonValue))
 	req.Header.Set("Content-Type", "application/json")
 	resp := httptest.NewRecorder()
 	suite.Router.ServeHTTP(resp, req)
 
-	suite.Equal(http.StatusInternalServerError, resp.Code)
+	suite.Equal(http.StatusNotFound, resp.Code)
+	var response map[string]interface{}
+	json.Unmarshal(resp.Body.Bytes(), &response)
+	suite.Equal("not-found", response["code"])
+}
+
+func (suite *UserControllerTestSuite) TestUpdateUserByID_RoleHierarchy() {
+	suite.Router = gin.Default()
+	suite.Router.Use(func(c *gin.Context) { c.Set("user", testActor{ID: 99, Role: Admin}) })
+	suite.Router.PUT("/users/:id", suite.Controller.UpdateUserByID)
+
+	jsonValue, _ := json.Marshal(dto.UserUpdateInput{Role: string(Super)})
+	req, _ := http.NewRequest(http.MethodPut, "/users/1", bytes.NewBuffer(jsonValue))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	suite.Router.ServeHTTP(resp, req)
+
+	suite.Equal(http.StatusForbidden, resp.Code)
+	var response map[string]interface{}
+	json.Unmarshal(resp.Body.Bytes(), &response)
+	suite.Equal("forbidden", response["code"])
+}
+
+func (suite *UserControllerTestSuite) TestSuspendUser() {
+	jsonValue, _ := json.Marshal(map[string]interface{}{"reason": "Spam"})
+	req, _ := http.NewRequest(http.MethodPost, "/users/1/suspend", bytes.NewBuffer(jsonValue))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	suite.Router.ServeHTTP(resp, req)
+
+	suite.Equal(http.StatusOK, resp.Code)
 	var response map[string]interface{}
 	json.Unmarshal(resp.Body.Bytes(), &response)
-	suite.Equal("internal-server-error", response["code"])
+	suite.Equal("Spam", response["data"].(map[string]interface{})["suspensionReason"])
+
+	// A reason is required
+	req, _ = http.NewRequest(http.MethodPost, "/users/1/suspend", bytes.NewBufferString("{}"))
+	req.Header.Set("Content-Type", "application/json")
+	resp = httptest.NewRecorder()
+	suite.Router.ServeHTTP(resp, req)
+	suite.Equal(http.StatusBadRequest, resp.Code)
 }
 
 func TestUserControllerTestSuite(t *testing.T) {
@@ -1,41 +1,106 @@
-package user
-
-import (
-	"errors"
-	"time"
-
-	"gorm.io/datatypes"
-)
-
-type UserRole string
-
-const (
-	Super   UserRole = "super"
-	Admin   UserRole = "admin"
-	Generic UserRole = "generic"
-)
-
-type User struct {
-	ID        uint           `gorm:"primarykey" json:"id"`
-	Username  string         `gorm:"unique;type:varchar(255)" json:"username"`
-	Email     string         `gorm:"unique;type:varchar(255)" json:"email"`
-	FullName  string         `gorm:"type:varchar(255)" json:"fullName"`
-	Password  string         `gorm:"type:varchar(255)" json:"-"`
-	Role      UserRole       `json:"role" gorm:"type:user_role;default:'generic'"`
-	Meta      datatypes.JSON `gorm:"type:jsonb;not null;default:'{}'" json:"meta"`
-	CreatedAt time.Time      `gorm:"type:timestamp" json:"createdAt"`
-	UpdatedAt time.Time      `gorm:"type:timestamp" json:"updatedAt"`
-}
-
-func ParseUserRole(roleStr string) (UserRole, error) {
-	switch roleStr {
-	case string(Super):
-		return Super, nil
-	case string(Admin):
-		return Admin, nil
-	case string(Generic):
-		return Generic, nil
-	default:
-		return "", errors.New("invalid user role")
-	}
-}
+package user
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/irvanherz/gourze/modules/user/dto"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+type UserRole string
+
+const (
+	Super   UserRole = "super"
+	Admin   UserRole = "admin"
+	Generic UserRole = "generic"
+	// Instructor is granted to users whose instructor application was approved
+	Instructor UserRole = "instructor"
+)
+
+// BuiltinRoles are the roles the code relies on, further roles are created through the rbac API
+var BuiltinRoles = []UserRole{Super, Admin, Instructor, Generic}
+
+type User struct {
+	ID              uint       `gorm:"primarykey" json:"id"`
+	Username        string     `gorm:"unique;type:varchar(255)" json:"username"`
+	Email           string     `gorm:"unique;type:varchar(255)" json:"email"`
+	FullName        string     `gorm:"type:varchar(255)" json:"fullName"`
+	Password        string     `gorm:"type:varchar(255)" json:"-"`
+	Role            UserRole   `json:"role" gorm:"type:varchar(64);default:'generic'"`
+	EmailVerifiedAt *time.Time `gorm:"type:timestamp" json:"emailVerifiedAt"`
+	// PasswordChangeRequired makes the next signin end with a password change, see auth.ChangePassword
+	PasswordChangeRequired bool `gorm:"not null;default:false" json:"passwordChangeRequired"`
+	// InviteID is the invite the user signed up with
+	InviteID *uint  `gorm:"index" json:"inviteId"`
+	Bio      string `gorm:"type:text" json:"bio"`
+	// AvatarID is an image media uploaded by the user
+	AvatarID *uint  `gorm:"type:integer" json:"avatarId"`
+	Locale   string `gorm:"type:varchar(35)" json:"locale"`
+	Timezone string `gorm:"type:varchar(64)" json:"timezone"`
+	// SuspendedAt is set while the account is suspended, until SuspendedUntil or indefinitely (a ban) when it is nil
+	SuspendedAt      *time.Time     `gorm:"type:timestamp" json:"suspendedAt"`
+	SuspendedUntil   *time.Time     `gorm:"type:timestamp" json:"suspendedUntil"`
+	SuspensionReason string         `gorm:"type:varchar(500)" json:"suspensionReason"`
+	Meta             datatypes.JSON `gorm:"type:jsonb;not null;default:'{}'" json:"meta"`
+	CreatedAt        time.Time      `gorm:"type:timestamp" json:"createdAt"`
+	UpdatedAt        time.Time      `gorm:"type:timestamp" json:"updatedAt"`
+	// DeletedAt soft deletes the user, so courses, orders and enrollments keep referring to an existing row
+	DeletedAt gorm.DeletedAt `gorm:"type:timestamp;index" json:"-"`
+}
+
+// ProfileMeta parses the meta column, see dto.UserMeta
+func (u *User) ProfileMeta() (dto.UserMeta, error) {
+	var meta dto.UserMeta
+	if len(u.Meta) == 0 {
+		return meta, nil
+	}
+	err := json.Unmarshal(u.Meta, &meta)
+	return meta, err
+}
+
+// IsSuspended reports whether the user is currently suspended, suspensions end on their own once expired
+func (u *User) IsSuspended() bool {
+	return u.SuspendedAt != nil && (u.SuspendedUntil == nil || time.Now().Before(*u.SuspendedUntil))
+}
+
+// Actor is the user a service call is made for, see rbac.Policy
+type Actor struct {
+	ID   uint
+	Role UserRole
+}
+
+// CanManage tells whether the actor may manage accounts of role, and grant it. Super users manage
+// everyone, other users only roles below their own. Roles created through the rbac API rank with generic.
+func (a Actor) CanManage(role UserRole) bool {
+	return a.Role == Super || roleRank(a.Role) > roleRank(role)
+}
+
+func roleRank(role UserRole) int {
+	switch role {
+	case Super:
+		return 2
+	case Admin:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// ParseUserRole parses the built-in roles, see BuiltinRoles
+func ParseUserRole(roleStr string) (UserRole, error) {
+	switch roleStr {
+	case string(Super):
+		return Super, nil
+	case string(Admin):
+		return Admin, nil
+	case string(Generic):
+		return Generic, nil
+	case string(Instructor):
+		return Instructor, nil
+	default:
+		return "", errors.New("invalid user role")
+	}
+}
@@ -1,87 +1,413 @@
-package user
-
-import (
-	"github.com/creasty/defaults"
-	"github.com/irvanherz/gourze/modules/user/dto"
-	"github.com/jinzhu/copier"
-	"gorm.io/gorm"
-)
-
-type UserService interface {
-	FindManyUsers(filter *dto.UserFilterInput) ([]User, int64, error)
-	CreateUser(input *dto.UserCreateInput) (*User, error)
-	FindUserByID(id uint) (*User, error)
-	UpdateUserByID(id uint, input *dto.UserUpdateInput) (*User, error)
-	DeleteUserByID(id uint) (*User, error)
-}
-
-type userService struct {
-	Db *gorm.DB
-}
-
-func NewUserService(db *gorm.DB) UserService {
-	return &userService{Db: db}
-}
-
-func (s *userService) FindManyUsers(filter *dto.UserFilterInput) ([]User, int64, error) {
-	var users []User
-	var count int64
-
-	if err := defaults.Set(filter); err != nil {
-		return nil, 0, err
-	}
-	query := s.Db
-	query = filter.ApplyFilter(query)
-
-	if err := query.Model(&User{}).Count(&count).Error; err != nil {
-		return nil, 0, err
-	}
-
-	query = filter.ApplyPagination(query)
-
-	if err := query.Find(&users).Error; err != nil {
-		return nil, 0, err
-	}
-	return users, count, nil
-}
-
-func (s *userService) CreateUser(input *dto.UserCreateInput) (*User, error) {
-	var user User
-	copier.Copy(&user, &input)
-
-	if err := s.Db.Create(&user).Error; err != nil {
-		return nil, err
-	}
-	return &user, nil
-}
-
-func (s *userService) FindUserByID(id uint) (*User, error) {
-	var user User
-	if err := s.Db.First(&user, id).Error; err != nil {
-		return nil, err
-	}
-	return &user, nil
-}
-
-func (s *userService) UpdateUserByID(id uint, input *dto.UserUpdateInput) (*User, error) {
-	var user User
-	if err := s.Db.First(&user, id).Error; err != nil {
-		return nil, err
-	}
-	copier.Copy(&user, &input)
-	if err := s.Db.Save(&user).Error; err != nil {
-		return nil, err
-	}
-	return &user, nil
-}
-
-func (s *userService) DeleteUserByID(id uint) (*User, error) {
-	var user User
-	if err := s.Db.First(&user, id).Error; err != nil {
-		return nil, err
-	}
-	if err := s.Db.Delete(&User{}, id).Error; err != nil {
-		return nil, err
-	}
-	return &user, nil
-}
+package user
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/creasty/defaults"
+	"github.com/irvanherz/gourze/modules/password"
+	"github.com/irvanherz/gourze/modules/user/dto"
+	"github.com/jinzhu/copier"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUsernameTaken     = errors.New("username is already taken")
+	ErrInvalidUsername   = errors.New("username may only contain letters, digits, dots, dashes and underscores")
+	ErrEmailTaken        = errors.New("email is already used by another account")
+	ErrIncorrectPassword = errors.New("current password is incorrect")
+	ErrInvalidRole       = errors.New("invalid user role")
+	ErrRoleHierarchy     = errors.New("you can't manage users of this role")
+	ErrCannotManageSelf  = errors.New("you can't do this to your own account")
+	ErrInvalidSuspension = errors.New("suspension must end in the future")
+)
+
+// usernamePattern keeps usernames from looking like email addresses, which signin accepts as well
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+type UserService interface {
+	FindManyUsers(filter *dto.UserFilterInput) ([]User, int64, error)
+	CreateUser(actor Actor, input *dto.UserCreateInput) (*User, error)
+	FindUserByID(id uint) (*User, error)
+	UpdateUserByID(actor Actor, id uint, input *dto.UserUpdateInput) (*User, error)
+	DeleteUserByID(actor Actor, id uint) (*User, error)
+	SuspendUser(actor Actor, id uint, input *dto.UserSuspendInput) (*User, error)
+	UnsuspendUser(actor Actor, id uint) (*User, error)
+	UpdateProfile(id uint, input *dto.UserProfileUpdateInput) (*User, error)
+	ChangeEmail(id uint, input *dto.UserEmailChangeInput) (*User, error)
+	DeleteAccount(id uint, input *dto.UserAccountDeleteInput, erase func(tx *gorm.DB) error) error
+}
+
+// SessionRevoker signs a user out everywhere. It is implemented by the auth module, which can't be
+// imported from here.
+type SessionRevoker interface {
+	SignoutAll(userID uint) error
+}
+
+type userService struct {
+	Db             *gorm.DB
+	PasswordPolicy password.PasswordPolicy
+	SessionRevoker SessionRevoker
+}
+
+func NewUserService(db *gorm.DB, passwordPolicy password.PasswordPolicy, sessionRevoker SessionRevoker) UserService {
+	return &userService{Db: db, PasswordPolicy: passwordPolicy, SessionRevoker: sessionRevoker}
+}
+
+func (s *userService) FindManyUsers(filter *dto.UserFilterInput) ([]User, int64, error) {
+	var users []User
+	var count int64
+
+	if err := defaults.Set(filter); err != nil {
+		return nil, 0, err
+	}
+	query := s.Db
+	query = filter.ApplyFilter(query)
+
+	if err := query.Model(&User{}).Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+
+	query = filter.ApplyPagination(query)
+
+	if err := query.Find(&users).Error; err != nil {
+		return nil, 0, err
+	}
+	return users, count, nil
+}
+
+// CreateUser implements UserService. The actor can only create users of roles they manage.
+func (s *userService) CreateUser(actor Actor, input *dto.UserCreateInput) (*User, error) {
+	role := Generic
+	if input.Role != "" {
+		parsedRole, err := s.parseRole(input.Role)
+		if err != nil {
+			return nil, err
+		}
+		role = parsedRole
+	}
+	if !actor.CanManage(role) {
+		return nil, ErrRoleHierarchy
+	}
+	if !usernamePattern.MatchString(input.Username) {
+		return nil, ErrInvalidUsername
+	}
+	if err := s.checkUnique("username", input.Username, 0, ErrUsernameTaken); err != nil {
+		return nil, err
+	}
+	if err := s.checkUnique("email", input.Email, 0, ErrEmailTaken); err != nil {
+		return nil, err
+	}
+
+	var user User
+	copier.Copy(&user, &input)
+	user.Role = role
+	if input.Password != "" {
+		if err := s.PasswordPolicy.Validate(input.Password, input.Username, input.Email); err != nil {
+			return nil, err
+		}
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, err
+		}
+		user.Password = string(hashedPassword)
+	}
+
+	if err := s.Db.Create(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *userService) FindUserByID(id uint) (*User, error) {
+	var user User
+	if err := s.Db.First(&user, id).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// UpdateUserByID implements UserService. Roles can only be changed to roles the actor manages,
+// and never by users for themselves.
+func (s *userService) UpdateUserByID(actor Actor, id uint, input *dto.UserUpdateInput) (*User, error) {
+	user, err := s.findManagedUser(actor, id, true)
+	if err != nil {
+		return nil, err
+	}
+	role := user.Role
+	if input.Role != "" {
+		if role, err = s.parseRole(input.Role); err != nil {
+			return nil, err
+		}
+		if role != user.Role && actor.ID == id {
+			return nil, ErrCannotManageSelf
+		}
+		if !actor.CanManage(role) {
+			return nil, ErrRoleHierarchy
+		}
+	}
+	roleChanged := role != user.Role
+	if input.FullName != nil {
+		user.FullName = *input.FullName
+	}
+	user.Role = role
+	if err := s.Db.Save(user).Error; err != nil {
+		return nil, err
+	}
+	// Tokens carry the role, the user signs in again to get the new one
+	if roleChanged {
+		if err := s.SessionRevoker.SignoutAll(id); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// DeleteUserByID implements UserService. The user is soft deleted and signed out everywhere, their
+// records stay as they are.
+func (s *userService) DeleteUserByID(actor Actor, id uint) (*User, error) {
+	user, err := s.findManagedUser(actor, id, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Db.Delete(&User{}, id).Error; err != nil {
+		return nil, err
+	}
+	if err := s.SessionRevoker.SignoutAll(id); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// SuspendUser implements UserService. Suspended users can't sign in or use their tokens and API
+// keys, which is enforced by the auth module.
+func (s *userService) SuspendUser(actor Actor, id uint, input *dto.UserSuspendInput) (*User, error) {
+	if input.Until != nil && !input.Until.After(time.Now()) {
+		return nil, ErrInvalidSuspension
+	}
+	user, err := s.findManagedUser(actor, id, false)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	user.SuspendedAt = &now
+	user.SuspendedUntil = input.Until
+	user.SuspensionReason = input.Reason
+	err = s.Db.Model(user).Updates(map[string]interface{}{
+		"suspended_at":      user.SuspendedAt,
+		"suspended_until":   user.SuspendedUntil,
+		"suspension_reason": user.SuspensionReason,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *userService) UnsuspendUser(actor Actor, id uint) (*User, error) {
+	user, err := s.findManagedUser(actor, id, false)
+	if err != nil {
+		return nil, err
+	}
+	user.SuspendedAt, user.SuspendedUntil, user.SuspensionReason = nil, nil, ""
+	err = s.Db.Model(user).Updates(map[string]interface{}{"suspended_at": nil, "suspended_until": nil, "suspension_reason": ""}).Error
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// findManagedUser loads a user the actor manages. Users manage their own account only when allowSelf is set.
+func (s *userService) findManagedUser(actor Actor, id uint, allowSelf bool) (*User, error) {
+	user, err := s.FindUserByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if actor.ID == id {
+		if !allowSelf {
+			return nil, ErrCannotManageSelf
+		}
+		return user, nil
+	}
+	if !actor.CanManage(user.Role) {
+		return nil, ErrRoleHierarchy
+	}
+	return user, nil
+}
+
+// UpdateProfile implements UserService. Callers check that AvatarID is an image of the user.
+func (s *userService) UpdateProfile(id uint, input *dto.UserProfileUpdateInput) (*User, error) {
+	var user User
+	if err := s.Db.First(&user, id).Error; err != nil {
+		return nil, err
+	}
+	updates := map[string]interface{}{}
+	if input.FullName != nil {
+		updates["full_name"] = strings.TrimSpace(*input.FullName)
+	}
+	if input.Username != nil && *input.Username != user.Username {
+		if !usernamePattern.MatchString(*input.Username) {
+			return nil, ErrInvalidUsername
+		}
+		if err := s.checkUnique("username", *input.Username, id, ErrUsernameTaken); err != nil {
+			return nil, err
+		}
+		updates["username"] = *input.Username
+	}
+	if input.Bio != nil {
+		updates["bio"] = *input.Bio
+	}
+	if input.AvatarID != nil {
+		if *input.AvatarID == 0 {
+			updates["avatar_id"] = nil
+		} else {
+			updates["avatar_id"] = *input.AvatarID
+		}
+	}
+	if input.Locale != nil {
+		updates["locale"] = *input.Locale
+	}
+	if input.Timezone != nil {
+		updates["timezone"] = *input.Timezone
+	}
+	if input.Meta != nil {
+		meta, err := mergeMeta(user.Meta, input.Meta)
+		if err != nil {
+			return nil, err
+		}
+		updates["meta"] = meta
+	}
+	if len(updates) > 0 {
+		if err := s.Db.Model(&user).Updates(updates).Error; err != nil {
+			return nil, err
+		}
+	}
+	return s.FindUserByID(id)
+}
+
+// parseRole accepts the built-in roles and the ones created through the rbac API. The roles table
+// belongs to the rbac module, which depends on this one.
+func (s *userService) parseRole(name string) (UserRole, error) {
+	if role, err := ParseUserRole(name); err == nil {
+		return role, nil
+	}
+	var count int64
+	if err := s.Db.Table("roles").Where("name = ?", name).Count(&count).Error; err != nil {
+		return "", err
+	}
+	if count == 0 {
+		return "", ErrInvalidRole
+	}
+	return UserRole(name), nil
+}
+
+// mergeMeta writes the profile fields of input into meta, keys outside of dto.UserMeta are kept
+func mergeMeta(meta datatypes.JSON, input *dto.UserMeta) (datatypes.JSON, error) {
+	merged := map[string]interface{}{}
+	if len(meta) > 0 {
+		if err := json.Unmarshal(meta, &merged); err != nil {
+			return nil, err
+		}
+	}
+	input.Headline = strings.TrimSpace(input.Headline)
+	profile, err := json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(profile, &merged); err != nil {
+		return nil, err
+	}
+	raw, err := json.Marshal(merged)
+	if err != nil {
+		return nil, err
+	}
+	return datatypes.JSON(raw), nil
+}
+
+// ChangeEmail implements UserService. The new address is unverified until the user confirms it.
+func (s *userService) ChangeEmail(id uint, input *dto.UserEmailChangeInput) (*User, error) {
+	var user User
+	if err := s.Db.First(&user, id).Error; err != nil {
+		return nil, err
+	}
+	if err := checkPassword(user, input.CurrentPassword); err != nil {
+		return nil, err
+	}
+	email := strings.TrimSpace(input.Email)
+	if strings.EqualFold(email, user.Email) {
+		return &user, nil
+	}
+	if err := s.checkUnique("email", email, id, ErrEmailTaken); err != nil {
+		return nil, err
+	}
+	err := s.Db.Model(&user).Updates(map[string]interface{}{"email": email, "email_verified_at": nil}).Error
+	if err != nil {
+		return nil, err
+	}
+	return s.FindUserByID(id)
+}
+
+// DeleteAccount implements UserService. The personal data of the user is scrubbed and the account
+// soft deleted, orders and enrollments keep referring to the anonymized row. erase removes what
+// other modules hold about the user, in the same transaction.
+func (s *userService) DeleteAccount(id uint, input *dto.UserAccountDeleteInput, erase func(tx *gorm.DB) error) error {
+	var user User
+	if err := s.Db.First(&user, id).Error; err != nil {
+		return err
+	}
+	if err := checkPassword(user, input.CurrentPassword); err != nil {
+		return err
+	}
+	return s.Db.Transaction(func(tx *gorm.DB) error {
+		// The placeholders keep the unique username and email free for new accounts
+		err := tx.Model(&user).Updates(map[string]interface{}{
+			"username":                 fmt.Sprintf("deleted-%d", id),
+			"email":                    fmt.Sprintf("deleted-%d@deleted.invalid", id),
+			"full_name":                "",
+			"password":                 "",
+			"email_verified_at":        nil,
+			"password_change_required": false,
+			"bio":                      "",
+			"avatar_id":                nil,
+			"locale":                   "",
+			"timezone":                 "",
+			"meta":                     datatypes.JSON("{}"),
+		}).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Delete(&user).Error; err != nil {
+			return err
+		}
+		return erase(tx)
+	})
+}
+
+// checkPassword confirms a sensitive change with the current password of the user. Accounts created
+// through an identity provider have a random password, their users reset it first. Callers put the
+// attempts through the signin lockout with AuthService.ConfirmPassword.
+func checkPassword(user User, password string) error {
+	if user.Password == "" || bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+		return ErrIncorrectPassword
+	}
+	return nil
+}
+
+// checkUnique returns takenErr when another user already has value in column. Soft deleted users
+// keep their values until anonymized, which the unique index still sees.
+func (s *userService) checkUnique(column, value string, id uint, takenErr error) error {
+	var count int64
+	if err := s.Db.Unscoped().Model(&User{}).Where(column+" = ? AND id <> ?", value, id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return takenErr
+	}
+	return nil
+}
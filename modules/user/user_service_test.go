@@ -1,89 +1,293 @@
-package user
-
-import (
-	"testing"
-
-	"github.com/irvanherz/gourze/modules/user/dto"
-	"github.com/stretchr/testify/suite"
-	"gorm.io/driver/sqlite"
-	"gorm.io/gorm"
-)
-
-type UserServiceTestSuite struct {
-	suite.Suite
-	db      *gorm.DB
-	service UserService
-}
-
-func (suite *UserServiceTestSuite) SetupTest() {
-	suite.db = setupTestDB()
-	suite.service = NewUserService(suite.db)
-}
-
-func setupTestDB() *gorm.DB {
-	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
-	db.AutoMigrate(&User{})
-	return db
-}
-
-func (suite *UserServiceTestSuite) TestFindManyUsers() {
-	// Seed data
-	suite.db.Create(&User{Username: "john_doe", Email: "john@doe.com", FullName: "John Doe"})
-	suite.db.Create(&User{Username: "jane_doe", Email: "jane@doe.com", FullName: "Jane Doe"})
-
-	filter := &dto.UserFilterInput{
-		SortBy:    "username",
-		SortOrder: "asc",
-		Page:      1,
-		Take:      10,
-	}
-
-	users, count, err := suite.service.FindManyUsers(filter)
-	suite.NoError(err)
-	suite.Len(users, 2)
-	suite.Equal(int64(2), count)
-}
-
-func (suite *UserServiceTestSuite) TestCreateUser() {
-	input := &dto.UserCreateInput{FullName: "John Doe"}
-	user, err := suite.service.CreateUser(input)
-	suite.NoError(err)
-	suite.Equal("John Doe", user.FullName)
-}
-
-func (suite *UserServiceTestSuite) TestFindUserByID() {
-	// Seed data
-	suite.db.Create(&User{FullName: "John Doe"})
-
-	user, err := suite.service.FindUserByID(1)
-	suite.NoError(err)
-	suite.Equal("John Doe", user.FullName)
-}
-
-func (suite *UserServiceTestSuite) TestUpdateUserByID() {
-	// Seed data
-	suite.db.Create(&User{FullName: "John Doe"})
-
-	input := &dto.UserUpdateInput{FullName: "John Smith"}
-	user, err := suite.service.UpdateUserByID(1, input)
-	suite.NoError(err)
-	suite.Equal("John Smith", user.FullName)
-}
-
-func (suite *UserServiceTestSuite) TestDeleteUserByID() {
-	// Seed data
-	suite.db.Create(&User{FullName: "John Doe"})
-
-	user, err := suite.service.DeleteUserByID(1)
-	suite.NoError(err)
-	suite.Equal("John Doe", user.FullName)
-
-	// Verify user is deleted
-	var count int64
-	suite.db.Model(&User{}).Count(&count)
-	suite.Equal(int64(0), count)
-}
-
-func TestUserServiceTestSuite(t *testing.T) {
-	suite.Run(t, new(UserServiceTestSuite))
-}
+package user
+
+import (
+	"testing"
+	"time"
+
+	"github.com/irvanherz/gourze/config"
+	"github.com/irvanherz/gourze/modules/password"
+	"github.com/irvanherz/gourze/modules/user/dto"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/datatypes"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// superActor is a super user without an account in the test database
+var superActor = Actor{ID: 99, Role: Super}
+
+// fakeSessionRevoker records the users signed out everywhere
+type fakeSessionRevoker struct {
+	signedOut []uint
+}
+
+func (r *fakeSessionRevoker) SignoutAll(userID uint) error {
+	r.signedOut = append(r.signedOut, userID)
+	return nil
+}
+
+type UserServiceTestSuite struct {
+	suite.Suite
+	db       *gorm.DB
+	sessions *fakeSessionRevoker
+	service  UserService
+}
+
+func (suite *UserServiceTestSuite) SetupTest() {
+	suite.db = setupTestDB()
+	conf := &config.Config{}
+	suite.sessions = &fakeSessionRevoker{}
+	suite.service = NewUserService(suite.db, password.NewPasswordPolicy(conf, password.NewBreachedPasswordChecker(conf)), suite.sessions)
+}
+
+func setupTestDB() *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(&User{})
+	// Custom roles are stored by the rbac module, which depends on this package
+	db.Exec("CREATE TABLE roles (id integer PRIMARY KEY, name varchar(64) UNIQUE)")
+	return db
+}
+
+func (suite *UserServiceTestSuite) TestFindManyUsers() {
+	// Seed data
+	suite.db.Create(&User{Username: "john_doe", Email: "john@doe.com", FullName: "John Doe"})
+	suite.db.Create(&User{Username: "jane_doe", Email: "jane@doe.com", FullName: "Jane Doe"})
+
+	filter := &dto.UserFilterInput{
+		SortBy:    "username",
+		SortOrder: "asc",
+		Page:      1,
+		Take:      10,
+	}
+
+	users, count, err := suite.service.FindManyUsers(filter)
+	suite.NoError(err)
+	suite.Len(users, 2)
+	suite.Equal(int64(2), count)
+}
+
+func (suite *UserServiceTestSuite) TestCreateUser() {
+	input := &dto.UserCreateInput{Username: "john_doe", Email: "john@doe.com", FullName: "John Doe"}
+	user, err := suite.service.CreateUser(superActor, input)
+	suite.NoError(err)
+	suite.Equal("John Doe", user.FullName)
+
+	_, err = suite.service.CreateUser(superActor, &dto.UserCreateInput{Username: "john_doe", Email: "jane@doe.com"})
+	suite.ErrorIs(err, ErrUsernameTaken)
+	_, err = suite.service.CreateUser(superActor, &dto.UserCreateInput{Username: "jane_doe", Email: "john@doe.com"})
+	suite.ErrorIs(err, ErrEmailTaken)
+	_, err = suite.service.CreateUser(superActor, &dto.UserCreateInput{Username: "jane@doe.com", Email: "jane@doe.com"})
+	suite.ErrorIs(err, ErrInvalidUsername)
+}
+
+func (suite *UserServiceTestSuite) TestCreateUser_Password() {
+	_, err := suite.service.CreateUser(superActor, &dto.UserCreateInput{Username: "john_doe", FullName: "John Doe", Password: "password123"})
+	suite.ErrorIs(err, password.ErrBreachedPassword)
+
+	_, err = suite.service.CreateUser(superActor, &dto.UserCreateInput{Username: "john_doe", FullName: "John Doe", Password: "Correct-Horse-42"})
+	suite.NoError(err)
+	var created User
+	suite.db.First(&created)
+	suite.NoError(bcrypt.CompareHashAndPassword([]byte(created.Password), []byte("Correct-Horse-42")))
+}
+
+func (suite *UserServiceTestSuite) TestFindUserByID() {
+	// Seed data
+	suite.db.Create(&User{FullName: "John Doe"})
+
+	user, err := suite.service.FindUserByID(1)
+	suite.NoError(err)
+	suite.Equal("John Doe", user.FullName)
+}
+
+func (suite *UserServiceTestSuite) TestUpdateUserByID() {
+	// Seed data
+	suite.db.Create(&User{FullName: "John Doe"})
+
+	fullName := "John Smith"
+	input := &dto.UserUpdateInput{FullName: &fullName}
+	user, err := suite.service.UpdateUserByID(superActor, 1, input)
+	suite.NoError(err)
+	suite.Equal("John Smith", user.FullName)
+	suite.Empty(suite.sessions.signedOut)
+
+	// Changing the role signs the user out, their tokens carry the previous one
+	user, err = suite.service.UpdateUserByID(superActor, 1, &dto.UserUpdateInput{Role: string(Admin)})
+	suite.NoError(err)
+	suite.Equal(Admin, user.Role)
+	suite.Equal("John Smith", user.FullName)
+	var stored User
+	suite.db.First(&stored, 1)
+	suite.Equal("John Smith", stored.FullName)
+	suite.Equal([]uint{1}, suite.sessions.signedOut)
+	_, err = suite.service.UpdateUserByID(superActor, 1, &dto.UserUpdateInput{Role: string(Admin)})
+	suite.NoError(err)
+	suite.Equal([]uint{1}, suite.sessions.signedOut)
+}
+
+func (suite *UserServiceTestSuite) TestDeleteUserByID() {
+	// Seed data
+	suite.db.Create(&User{FullName: "John Doe"})
+
+	user, err := suite.service.DeleteUserByID(superActor, 1)
+	suite.NoError(err)
+	suite.Equal("John Doe", user.FullName)
+	suite.Equal([]uint{1}, suite.sessions.signedOut)
+
+	// Verify user is deleted
+	var count int64
+	suite.db.Model(&User{}).Count(&count)
+	suite.Equal(int64(0), count)
+	// The row is kept for the records referring to it
+	suite.db.Unscoped().Model(&User{}).Count(&count)
+	suite.Equal(int64(1), count)
+}
+
+func (suite *UserServiceTestSuite) TestRoleHierarchy() {
+	suite.db.Create(&User{Username: "admin", Email: "admin@doe.com", Role: Admin})
+	suite.db.Create(&User{Username: "super", Email: "super@doe.com", Role: Super})
+	suite.db.Create(&User{Username: "john_doe", Email: "john@doe.com", Role: Generic})
+	admin := Actor{ID: 1, Role: Admin}
+
+	_, err := suite.service.CreateUser(admin, &dto.UserCreateInput{Username: "jane_doe", Email: "jane@doe.com", Role: string(Super)})
+	suite.ErrorIs(err, ErrRoleHierarchy)
+	_, err = suite.service.CreateUser(admin, &dto.UserCreateInput{Username: "jane_doe", Email: "jane@doe.com", Role: string(Admin)})
+	suite.ErrorIs(err, ErrRoleHierarchy)
+	_, err = suite.service.CreateUser(admin, &dto.UserCreateInput{Username: "jane_doe", Email: "jane@doe.com", Role: "owner"})
+	suite.ErrorIs(err, ErrInvalidRole)
+	created, err := suite.service.CreateUser(admin, &dto.UserCreateInput{Username: "jane_doe", Email: "jane@doe.com"})
+	suite.NoError(err)
+	suite.Equal(Generic, created.Role)
+	// Roles created through the rbac API are granted like generic
+	suite.db.Exec("INSERT INTO roles (name) VALUES ('moderator')")
+	moderator, err := suite.service.UpdateUserByID(admin, 3, &dto.UserUpdateInput{Role: "moderator"})
+	suite.NoError(err)
+	suite.Equal(UserRole("moderator"), moderator.Role)
+
+	_, err = suite.service.UpdateUserByID(admin, 3, &dto.UserUpdateInput{Role: string(Super)})
+	suite.ErrorIs(err, ErrRoleHierarchy)
+	fullName := "Super"
+	_, err = suite.service.UpdateUserByID(admin, 2, &dto.UserUpdateInput{FullName: &fullName})
+	suite.ErrorIs(err, ErrRoleHierarchy)
+	_, err = suite.service.DeleteUserByID(admin, 2)
+	suite.ErrorIs(err, ErrRoleHierarchy)
+	// Users keep their own role
+	_, err = suite.service.UpdateUserByID(Actor{ID: 2, Role: Super}, 2, &dto.UserUpdateInput{Role: string(Generic)})
+	suite.ErrorIs(err, ErrCannotManageSelf)
+	_, err = suite.service.DeleteUserByID(admin, 1)
+	suite.ErrorIs(err, ErrCannotManageSelf)
+
+	promoted, err := suite.service.UpdateUserByID(superActor, 3, &dto.UserUpdateInput{Role: string(Admin)})
+	suite.NoError(err)
+	suite.Equal(Admin, promoted.Role)
+
+	_, err = suite.service.UpdateUserByID(superActor, 999, &dto.UserUpdateInput{})
+	suite.ErrorIs(err, gorm.ErrRecordNotFound)
+}
+
+func (suite *UserServiceTestSuite) TestSuspendUser() {
+	suite.db.Create(&User{Username: "john_doe", Email: "john@doe.com"})
+	suite.db.Create(&User{Username: "admin", Email: "admin@doe.com", Role: Admin})
+
+	past := time.Now().Add(-time.Hour)
+	_, err := suite.service.SuspendUser(superActor, 1, &dto.UserSuspendInput{Reason: "Spam", Until: &past})
+	suite.ErrorIs(err, ErrInvalidSuspension)
+	_, err = suite.service.SuspendUser(Actor{ID: 2, Role: Admin}, 2, &dto.UserSuspendInput{Reason: "Spam"})
+	suite.ErrorIs(err, ErrCannotManageSelf)
+
+	until := time.Now().Add(time.Hour)
+	_, err = suite.service.SuspendUser(Actor{ID: 2, Role: Admin}, 1, &dto.UserSuspendInput{Reason: "Spam", Until: &until})
+	suite.NoError(err)
+	user, _ := suite.service.FindUserByID(1)
+	suite.True(user.IsSuspended())
+	suite.Equal("Spam", user.SuspensionReason)
+
+	// Suspensions end on their own
+	suite.db.Model(&User{}).Where("id = ?", 1).Update("suspended_until", past)
+	user, _ = suite.service.FindUserByID(1)
+	suite.False(user.IsSuspended())
+
+	_, err = suite.service.SuspendUser(superActor, 1, &dto.UserSuspendInput{Reason: "Ban"})
+	suite.NoError(err)
+	user, _ = suite.service.FindUserByID(1)
+	suite.True(user.IsSuspended())
+
+	_, err = suite.service.UnsuspendUser(superActor, 1)
+	suite.NoError(err)
+	user, _ = suite.service.FindUserByID(1)
+	suite.False(user.IsSuspended())
+	suite.Empty(user.SuspensionReason)
+}
+
+func (suite *UserServiceTestSuite) TestUpdateProfile() {
+	suite.db.Create(&User{Username: "john_doe", Email: "john@doe.com", FullName: "John Doe", Bio: "Teacher"})
+	suite.db.Create(&User{Username: "jane_doe", Email: "jane@doe.com"})
+
+	fullName, locale, avatarID := "John Smith", "en-GB", uint(7)
+	user, err := suite.service.UpdateProfile(1, &dto.UserProfileUpdateInput{FullName: &fullName, Locale: &locale, AvatarID: &avatarID})
+	suite.NoError(err)
+	suite.Equal("John Smith", user.FullName)
+	suite.Equal("en-GB", user.Locale)
+	suite.Equal(&avatarID, user.AvatarID)
+	// Fields left out are kept
+	suite.Equal("Teacher", user.Bio)
+
+	noAvatar := uint(0)
+	user, err = suite.service.UpdateProfile(1, &dto.UserProfileUpdateInput{AvatarID: &noAvatar})
+	suite.NoError(err)
+	suite.Nil(user.AvatarID)
+
+	taken, invalid := "jane_doe", "jane@doe.com"
+	_, err = suite.service.UpdateProfile(1, &dto.UserProfileUpdateInput{Username: &taken})
+	suite.ErrorIs(err, ErrUsernameTaken)
+	_, err = suite.service.UpdateProfile(1, &dto.UserProfileUpdateInput{Username: &invalid})
+	suite.ErrorIs(err, ErrInvalidUsername)
+}
+
+func (suite *UserServiceTestSuite) TestUpdateProfile_Meta() {
+	suite.db.Create(&User{Username: "john_doe", Email: "john@doe.com", Meta: datatypes.JSON(`{"theme":"dark","headline":"Teacher"}`)})
+
+	user, err := suite.service.UpdateProfile(1, &dto.UserProfileUpdateInput{Meta: &dto.UserMeta{
+		Headline:    " Go developer ",
+		SocialLinks: dto.UserSocialLinks{Github: "https://github.com/john"},
+	}})
+	suite.NoError(err)
+	meta, err := user.ProfileMeta()
+	suite.NoError(err)
+	suite.Equal("Go developer", meta.Headline)
+	suite.Equal("https://github.com/john", meta.SocialLinks.Github)
+	// Keys outside of the profile schema are kept
+	suite.Contains(string(user.Meta), `"theme":"dark"`)
+
+	user, err = suite.service.UpdateProfile(1, &dto.UserProfileUpdateInput{Meta: &dto.UserMeta{}})
+	suite.NoError(err)
+	meta, _ = user.ProfileMeta()
+	suite.Empty(meta.Headline)
+	suite.Empty(meta.SocialLinks.Github)
+}
+
+func (suite *UserServiceTestSuite) TestChangeEmail() {
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("Correct-Horse-42"), bcrypt.DefaultCost)
+	now := time.Now()
+	suite.db.Create(&User{Username: "john_doe", Email: "john@doe.com", Password: string(hashedPassword), EmailVerifiedAt: &now})
+	suite.db.Create(&User{Username: "jane_doe", Email: "jane@doe.com"})
+
+	_, err := suite.service.ChangeEmail(1, &dto.UserEmailChangeInput{Email: "john@smith.com", CurrentPassword: "wrong"})
+	suite.ErrorIs(err, ErrIncorrectPassword)
+	_, err = suite.service.ChangeEmail(1, &dto.UserEmailChangeInput{Email: "jane@doe.com", CurrentPassword: "Correct-Horse-42"})
+	suite.ErrorIs(err, ErrEmailTaken)
+
+	user, err := suite.service.ChangeEmail(1, &dto.UserEmailChangeInput{Email: "john@smith.com", CurrentPassword: "Correct-Horse-42"})
+	suite.NoError(err)
+	suite.Equal("john@smith.com", user.Email)
+	suite.Nil(user.EmailVerifiedAt)
+
+	// Accounts without a password can't confirm the change
+	_, err = suite.service.ChangeEmail(2, &dto.UserEmailChangeInput{Email: "jane@smith.com", CurrentPassword: ""})
+	suite.ErrorIs(err, ErrIncorrectPassword)
+}
+
+func TestUserServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(UserServiceTestSuite))
+}
@@ -2,53 +2,71 @@ package utils
 
 import (
 	"errors"
-	"strconv"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/irvanherz/gourze/modules/rbac"
 	"github.com/irvanherz/gourze/modules/user"
 )
 
-// CurrentUser represents the authenticated user extracted from JWT
+// CurrentUser represents the authenticated user of a request, built by the auth middleware
+// from the validated token claims
 type CurrentUser struct {
-	ID   uint
-	Role user.UserRole
+	ID      uint
+	Role    user.UserRole
+	TokenID string
+	// SessionID is the refresh token family the access token belongs to, empty for API keys
+	SessionID string
+	ExpiresAt time.Time
+	// Scopes restricts requests made with an API key, it is empty for regular signins
+	Scopes []string
+	// ImpersonatorID is the super user actually making the request with an impersonation
+	// token, it is 0 when users act as themselves
+	ImpersonatorID uint
+
+	loadUser func() (*user.User, error)
+	once     sync.Once
+	user     *user.User
+	err      error
+}
+
+// SetUserLoader sets how the user record is loaded, it is called at most once by User
+func (u *CurrentUser) SetUserLoader(load func() (*user.User, error)) {
+	u.loadUser = load
+}
+
+// User loads the user record on first use and caches it for the rest of the request
+func (u *CurrentUser) User() (*user.User, error) {
+	u.once.Do(func() {
+		if u.loadUser == nil {
+			u.err = errors.New("user loader not set")
+			return
+		}
+		u.user, u.err = u.loadUser()
+	})
+	return u.user, u.err
+}
+
+// IsImpersonated reports whether the request is made by an admin impersonating the user
+func (u *CurrentUser) IsImpersonated() bool {
+	return u.ImpersonatorID != 0
 }
 
-// GetCurrentUser extracts user claims from Gin context and converts them to CurrentUser
+// Actor returns the user as the actor of service calls checked by rbac.Policy
+func (u *CurrentUser) Actor() rbac.Actor {
+	return rbac.Actor{ID: u.ID, Role: u.Role}
+}
+
+// GetCurrentUser returns the CurrentUser the auth middleware stored in the Gin context
 func GetCurrentUser(c *gin.Context) (*CurrentUser, error) {
-	currentUser, exists := c.Get("user")
+	value, exists := c.Get("user")
 	if !exists {
 		return nil, errors.New("unauthorized: user not found")
 	}
-
-	// Type assertion for jwt.MapClaims
-	claims, ok := currentUser.(jwt.MapClaims)
+	currentUser, ok := value.(*CurrentUser)
 	if !ok {
-		return nil, errors.New("unauthorized: invalid token data")
+		return nil, errors.New("unauthorized: invalid user data")
 	}
-
-	// Extract and convert "sub" (User ID)
-	var userID uint
-	if subStr, ok := claims["sub"].(string); ok {
-		// Convert string to uint
-		id, err := strconv.ParseUint(subStr, 10, 64)
-		if err != nil {
-			return nil, errors.New("unauthorized: invalid user ID format")
-		}
-		userID = uint(id)
-	} else if subFloat, ok := claims["sub"].(float64); ok {
-		// If stored as float64 (common with JSON numbers)
-		userID = uint(subFloat)
-	} else {
-		return nil, errors.New("unauthorized: user ID missing or invalid")
-	}
-
-	// Extract "aud" (User Role) as string
-	userRole, _ := claims["aud"].(string)
-	parsedUserRole, _ := user.ParseUserRole(userRole)
-	return &CurrentUser{
-		ID:   userID,
-		Role: parsedUserRole,
-	}, nil
+	return currentUser, nil
 }